@@ -10,7 +10,9 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/emiago/sipgo/sip"
 	"github.com/emiago/sipgo/siptest"
@@ -352,3 +354,134 @@ func BenchmarkClientTransactionRequestBuild(t *testing.B) {
 		clientRequestBuildReq(c, req)
 	}
 }
+
+func TestClientTransactionFakeClock(t *testing.T) {
+	// Destination never responds
+	sink, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer sink.Close()
+
+	var received atomic.Int32
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			if _, _, err := sink.ReadFrom(buf); err != nil {
+				return
+			}
+			received.Add(1)
+		}
+	}()
+
+	clock := siptest.NewFakeClock(time.Now())
+	timers := sip.NewTimers(500*time.Millisecond, 4*time.Second, 5*time.Second)
+	ua, err := NewUA(WithUserAgentTransactionLayerOptions(
+		sip.WithTransactionLayerClock(clock),
+		sip.WithTransactionLayerTimers(timers),
+	))
+	require.NoError(t, err)
+	defer ua.Close()
+	c, err := NewClient(ua)
+	require.NoError(t, err)
+
+	req := sip.NewRequest(sip.OPTIONS, sip.Uri{Host: "127.0.0.1", Port: sink.LocalAddr().(*net.UDPAddr).Port})
+	tx, err := c.TransactionRequest(context.Background(), req)
+	require.NoError(t, err)
+	defer tx.Terminate()
+
+	waitReceived := func(n int32) {
+		require.Eventually(t, func() bool { return received.Load() == n }, time.Second, time.Millisecond)
+	}
+	waitReceived(1)
+
+	// Timer E retransmissions 500ms, 1s, 2s, 4s, 4s ...
+	clock.Advance(499 * time.Millisecond)
+	clock.Advance(time.Millisecond)
+	waitReceived(2)
+	clock.Advance(time.Second)
+	waitReceived(3)
+	clock.Advance(2 * time.Second)
+	waitReceived(4)
+	clock.Advance(4 * time.Second)
+	waitReceived(5)
+
+	select {
+	case <-tx.Done():
+		t.Fatal("transaction terminated before Timer F")
+	default:
+	}
+
+	// Timer F 64*T1
+	clock.Advance(timers.F - 7500*time.Millisecond)
+	select {
+	case <-tx.Done():
+		assert.ErrorIs(t, tx.Err(), sip.ErrTransactionTimeout)
+	case <-time.After(time.Second):
+		t.Fatal("transaction did not time out")
+	}
+	assert.Zero(t, clock.Timers())
+}
+
+func TestClientTransactionInviteFakeClock(t *testing.T) {
+	// Destination never responds
+	sink, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer sink.Close()
+
+	var received atomic.Int32
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			if _, _, err := sink.ReadFrom(buf); err != nil {
+				return
+			}
+			received.Add(1)
+		}
+	}()
+
+	clock := siptest.NewFakeClock(time.Now())
+	timers := sip.NewTimers(500*time.Millisecond, 4*time.Second, 5*time.Second)
+	ua, err := NewUA(WithUserAgentTransactionLayerOptions(
+		sip.WithTransactionLayerClock(clock),
+		sip.WithTransactionLayerTimers(timers),
+	))
+	require.NoError(t, err)
+	defer ua.Close()
+	c, err := NewClient(ua)
+	require.NoError(t, err)
+
+	req := sip.NewRequest(sip.INVITE, sip.Uri{Host: "127.0.0.1", Port: sink.LocalAddr().(*net.UDPAddr).Port})
+	tx, err := c.TransactionRequest(context.Background(), req)
+	require.NoError(t, err)
+	defer tx.Terminate()
+
+	waitReceived := func(n int32) {
+		require.Eventually(t, func() bool { return received.Load() == n }, time.Second, time.Millisecond)
+	}
+	waitReceived(1)
+
+	// Timer A retransmissions 500ms, 1s, 2s, 4s, 8s, 16s are not capped by T2
+	elapsed := time.Duration(0)
+	for i, d := range []time.Duration{500 * time.Millisecond, time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second} {
+		clock.Advance(d)
+		elapsed += d
+		waitReceived(int32(i + 2))
+	}
+
+	// Timer B 64*T1
+	clock.Advance(timers.B - elapsed - time.Millisecond)
+	select {
+	case <-tx.Done():
+		t.Fatal("transaction terminated before Timer B")
+	default:
+	}
+
+	clock.Advance(time.Millisecond)
+	select {
+	case <-tx.Done():
+		assert.ErrorIs(t, tx.Err(), sip.ErrTransactionTimeout)
+	case <-time.After(time.Second):
+		t.Fatal("transaction did not time out")
+	}
+	assert.Equal(t, int32(7), received.Load())
+	assert.Zero(t, clock.Timers())
+}
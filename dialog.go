@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
 	"sync/atomic"
 
 	"github.com/emiago/sipgo/sip"
@@ -46,6 +47,16 @@ type Dialog struct {
 	cancel context.CancelCauseFunc
 
 	onStatePointer atomic.Pointer[DialogStateFn]
+
+	metrics    sip.Metrics
+	spanTracer sip.SpanTracer
+	span       *dialogSpan
+}
+
+// dialogSpan is tracing span of dialog
+type dialogSpan struct {
+	span sip.Span
+	once sync.Once
 }
 
 // Init setups dialog state
@@ -88,9 +99,13 @@ func (d *Dialog) setState(s sip.DialogState) {
 		// Safety
 		return
 	}
+	if d.metrics != nil {
+		d.metrics.DialogStateChanged(sip.DialogState(old), s)
+	}
 
 	if s == sip.DialogStateEnded {
 		d.cancel(nil)
+		d.spanEnd(nil)
 	}
 
 	if f := d.onStatePointer.Load(); f != nil {
@@ -108,7 +123,11 @@ func (d *Dialog) endWithCause(err error) {
 		// Safety
 		return
 	}
+	if d.metrics != nil {
+		d.metrics.DialogStateChanged(sip.DialogState(old), s)
+	}
 	d.cancel(err)
+	d.spanEnd(err)
 
 	if f := d.onStatePointer.Load(); f != nil {
 		cb := *f
@@ -116,6 +135,44 @@ func (d *Dialog) endWithCause(err error) {
 	}
 }
 
+// spanStart starts dialog span as child of span in ctx. Returned ctx carries dialog span
+func (d *Dialog) spanStart(ctx context.Context) context.Context {
+	if d.spanTracer == nil {
+		return ctx
+	}
+	var attrs []sip.SpanAttribute
+	if callid := d.InviteRequest.CallID(); callid != nil {
+		attrs = append(attrs, sip.SpanAttribute{Key: sip.SpanAttrCallID, Value: callid.Value()})
+	}
+	ctx, span := d.spanTracer.Start(ctx, "sip.dialog", attrs...)
+	d.span = &dialogSpan{span: span}
+	return ctx
+}
+
+// spanLink links transaction span to dialog span
+func (d *Dialog) spanLink(tx any) {
+	if d.span == nil {
+		return
+	}
+	if t, ok := tx.(interface{ TraceContext() context.Context }); ok {
+		d.span.span.AddLink(t.TraceContext())
+	}
+}
+
+// spanEnd ends dialog span once, either when dialog ends or it is closed
+func (d *Dialog) spanEnd(err error) {
+	if d.span == nil {
+		return
+	}
+	d.span.once.Do(func() {
+		d.span.span.SetAttributes(
+			sip.SpanAttribute{Key: sip.SpanAttrDialogID, Value: d.ID},
+			sip.SpanAttribute{Key: sip.SpanAttrDialogState, Value: d.LoadState().String()},
+		)
+		d.span.span.End(err)
+	})
+}
+
 // Err returns error that caused dialog termination
 func (d *Dialog) err() error {
 	return context.Cause(d.Context())
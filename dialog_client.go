@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 	"sync"
-	"time"
 
 	"github.com/emiago/sipgo/sip"
 	"github.com/icholy/digest"
@@ -22,6 +21,7 @@ type DialogClientSession struct {
 }
 
 func (s *DialogClientSession) ReadBye(req *sip.Request, tx sip.ServerTransaction) error {
+	s.spanLink(tx)
 	s.setState(sip.DialogStateEnded)
 
 	res := sip.NewResponseFromRequest(req, 200, "OK", nil)
@@ -74,7 +74,12 @@ func (s *DialogClientSession) TransactionRequest(ctx context.Context, req *sip.R
 	s.buildReq(req)
 
 	// Passing option to avoid CSEQ apply
-	return s.UA.Client.TransactionRequest(ctx, req, s.requestValidate)
+	tx, err := s.UA.Client.TransactionRequest(ctx, req, s.requestValidate)
+	if err != nil {
+		return nil, err
+	}
+	s.spanLink(tx)
+	return tx, nil
 }
 
 func (s *DialogClientSession) WriteRequest(req *sip.Request) error {
@@ -172,6 +177,7 @@ func (s *DialogClientSession) Close() error {
 	if s.onClose != nil {
 		s.onClose()
 	}
+	s.spanEnd(nil)
 	// s.ua.dialogs.Delete(s.ID)
 	// s.setState(sip.DialogStateEnded)
 	// ctx, _ := context.WithTimeout(context.Background(), sip.Timer_B)
@@ -211,6 +217,7 @@ func (d *DialogClientSession) Invite(ctx context.Context, options ...ClientReque
 
 	if err == nil {
 		d.lastCSeqNo.Store(inviteReq.CSeq().SeqNo)
+		d.spanLink(d.inviteTx)
 	}
 
 	return err
@@ -381,6 +388,9 @@ func (s *DialogClientSession) inviteCancel(ctx context.Context, tx sip.ClientTra
 	// Terminated) response for the original request, as an RFC 2543-
 	// compliant UAS will not generate such a response.  If there is no
 	// final response for the original request in 64*T1 seconds
+	txl := s.UA.Client.TransactionLayer()
+	timeout := txl.Clock().NewTimer(64 * txl.Timers().T1)
+	defer timeout.Stop()
 loop_487:
 	for {
 		select {
@@ -392,7 +402,7 @@ loop_487:
 			break loop_487
 		case <-tx.Done():
 			return tx.Err()
-		case <-time.After(64 * sip.T1):
+		case <-timeout.C():
 			break loop_487
 		}
 	}
@@ -640,6 +650,11 @@ func (s *DialogClientCache) dialogsLen() int {
 	return leftItems
 }
 
+// Len returns number of active dialogs
+func (s *DialogClientCache) Len() int {
+	return s.dialogsLen()
+}
+
 func (s *DialogClientCache) loadDialog(id string) *DialogClientSession {
 	val, ok := s.dialogs.Load(id)
 	if !ok || val == nil {
@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 	"sync"
-	"time"
 
 	"github.com/emiago/sipgo/sip"
 	"github.com/icholy/digest"
@@ -39,6 +38,7 @@ func (s *DialogServerSession) ReadBye(req *sip.Request, tx sip.ServerTransaction
 		return err
 	}
 
+	s.spanLink(tx)
 	defer s.Close()
 	defer s.inviteTx.Terminate() // Terminat`es Invite transaction
 
@@ -81,7 +81,7 @@ func (s *DialogServerSession) Do(ctx context.Context, req *sip.Request) (*sip.Re
 func (s *DialogServerSession) TransactionRequest(ctx context.Context, req *sip.Request) (sip.ClientTransaction, error) {
 	s.buildReq(req)
 	// Passing option to avoid CSEQ apply
-	return s.ua.Client.TransactionRequest(ctx, req, func(c *Client, req *sip.Request) error {
+	tx, err := s.ua.Client.TransactionRequest(ctx, req, func(c *Client, req *sip.Request) error {
 		if req.Via() == nil {
 			ClientRequestAddVia(c, req)
 		}
@@ -91,6 +91,11 @@ func (s *DialogServerSession) TransactionRequest(ctx context.Context, req *sip.R
 		}
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+	s.spanLink(tx)
+	return tx, nil
 }
 
 func (s *DialogServerSession) WriteRequest(req *sip.Request) error {
@@ -190,6 +195,7 @@ func (s *DialogServerSession) Close() error {
 	if s.onClose != nil {
 		s.onClose()
 	}
+	s.spanEnd(nil)
 	return nil
 }
 
@@ -323,13 +329,18 @@ func (s *DialogServerSession) WriteResponse(res *sip.Response) error {
 	// https://datatracker.ietf.org/doc/html/rfc3261#section-13.3.1.4
 
 	// We are following RFC 6026, which states that this is TU thing and not Transaction layer.
-	timer := time.NewTimer(sip.T1)
+	txl := s.ua.Client.TransactionLayer()
+	timers, clock := txl.Timers(), txl.Clock()
+	timer := clock.NewTimer(timers.T1)
 	defer timer.Stop()
+	// Deadline of whole wait, it must not restart with retransmissions
+	ackTimeout := clock.NewTimer(64 * timers.T1)
+	defer ackTimeout.Stop()
 
 	state := sip.DialogStateEstablished
 	for state == sip.DialogStateEstablished {
 		select {
-		case <-timer.C:
+		case <-timer.C():
 			if err := tx.Respond(res); err != nil {
 				return err
 			}
@@ -337,9 +348,9 @@ func (s *DialogServerSession) WriteResponse(res *sip.Response) error {
 			//    interval that starts at T1 seconds and doubles for each
 			//    retransmission until it reaches T2 seconds (T1 and T2 are defined in
 			//    Section 17).
-			timer.Reset(max(2*sip.T1, sip.T2))
+			timer.Reset(max(2*timers.T1, timers.T2))
 
-		case <-time.After(64 * sip.T1):
+		case <-ackTimeout.C():
 			// If the server retransmits the 2xx response for 64*T1 seconds without
 			// receiving an ACK, the dialog is confirmed, but the session SHOULD be
 			// terminated.  This is accomplished with a BYE, as described in Section
@@ -386,14 +397,18 @@ func (s *DialogServerSession) WriteBye(ctx context.Context, bye *sip.Request) er
 
 	// This is tricky
 	defer s.inviteTx.Terminate() // Terminates INVITE in all cases
+	txl := s.ua.Client.TransactionLayer()
+	recheck := txl.Clock().NewTimer(txl.Timers().T1)
+	defer recheck.Stop()
 	for {
 		state = s.state.Load()
 		if sip.DialogState(state) < sip.DialogStateConfirmed {
 			select {
 			case <-s.inviteTx.Done():
 				// Wait until we timeout
-			case <-time.After(sip.T1):
+			case <-recheck.C():
 				// Recheck state
+				recheck.Reset(txl.Timers().T1)
 				continue
 			case <-ctx.Done():
 				return ctx.Err()
@@ -450,6 +465,16 @@ func (s *DialogServerCache) loadDialog(id string) *DialogServerSession {
 	return t
 }
 
+// Len returns number of active dialogs
+func (s *DialogServerCache) Len() int {
+	n := 0
+	s.dialogs.Range(func(key, value any) bool {
+		n++
+		return true
+	})
+	return n
+}
+
 func (s *DialogServerCache) MatchDialogRequest(req *sip.Request) (*DialogServerSession, error) {
 	id, err := sip.DialogIDFromRequestUAS(req)
 	if err != nil {
@@ -1,10 +1,13 @@
 package sipgo
 
 import (
+	"log/slog"
+	"sync"
 	"testing"
 
 	"github.com/emiago/sipgo/sip"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestDialogState(t *testing.T) {
@@ -32,6 +35,78 @@ func TestDialogState(t *testing.T) {
 
 }
 
+type testDialogMetrics struct {
+	sip.NoopMetrics
+	mu          sync.Mutex
+	transitions [][2]sip.DialogState
+}
+
+func (m *testDialogMetrics) DialogStateChanged(from sip.DialogState, to sip.DialogState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.transitions = append(m.transitions, [2]sip.DialogState{from, to})
+}
+
+func TestDialogStateMetrics(t *testing.T) {
+	m := &testDialogMetrics{}
+	ua, err := NewUA(WithUserAgentMetrics(m))
+	require.NoError(t, err)
+	defer ua.Close()
+	cli, _ := NewClient(ua)
+
+	dua := DialogUA{
+		Client:     cli,
+		ContactHDR: sip.ContactHeader{Address: sip.Uri{Host: "127.0.0.1", Port: 5060}},
+	}
+
+	invite, _, _ := createTestInvite(t, "sip:uas@uas.com", "udp", "uas.com:5090")
+	invite.AppendHeader(&sip.ContactHeader{Address: sip.Uri{Host: "uas", Port: 1234}})
+	d, err := dua.ReadInvite(invite, sip.NewServerTx("test", invite, nil, slog.Default()))
+	require.NoError(t, err)
+
+	d.setState(sip.DialogStateEstablished)
+	d.setState(sip.DialogStateConfirmed)
+	d.endWithCause(nil)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	assert.Equal(t, [][2]sip.DialogState{
+		{0, sip.DialogStateEstablished},
+		{sip.DialogStateEstablished, sip.DialogStateConfirmed},
+		{sip.DialogStateConfirmed, sip.DialogStateEnded},
+	}, m.transitions)
+}
+
+func TestDialogSpan(t *testing.T) {
+	rec := sip.NewSpanRecorder()
+	ua, err := NewUA(WithUserAgentSpanTracer(rec, ""))
+	require.NoError(t, err)
+	defer ua.Close()
+	cli, _ := NewClient(ua)
+
+	dua := DialogUA{
+		Client:     cli,
+		ContactHDR: sip.ContactHeader{Address: sip.Uri{Host: "127.0.0.1", Port: 5060}},
+	}
+
+	invite, _, _ := createTestInvite(t, "sip:uas@uas.com", "udp", "uas.com:5090")
+	invite.AppendHeader(&sip.ContactHeader{Address: sip.Uri{Host: "uas", Port: 1234}})
+	d, err := dua.ReadInvite(invite, sip.NewServerTx("test", invite, nil, slog.Default()))
+	require.NoError(t, err)
+
+	d.setState(sip.DialogStateEstablished)
+	d.setState(sip.DialogStateEnded)
+	d.Close()
+
+	spans := rec.Spans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "sip.dialog", spans[0].Name)
+	assert.True(t, spans[0].Ended)
+	assert.Equal(t, d.ID, spans[0].Attributes[sip.SpanAttrDialogID])
+	assert.Equal(t, invite.CallID().Value(), spans[0].Attributes[sip.SpanAttrCallID])
+	assert.Equal(t, "Ended", spans[0].Attributes[sip.SpanAttrDialogState])
+}
+
 func BenchmarkDialogSettingState(b *testing.B) {
 	inv, _, _ := createTestInvite(b, "sip:nowhere", "udp", "127.0.0.1")
 	d := Dialog{
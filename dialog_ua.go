@@ -21,6 +21,20 @@ type DialogUA struct {
 	RewriteContact bool
 }
 
+func (c *DialogUA) metrics() sip.Metrics {
+	if c.Client == nil || c.Client.UserAgent == nil {
+		return nil
+	}
+	return c.Client.UserAgent.metrics
+}
+
+func (c *DialogUA) spanTracer() sip.SpanTracer {
+	if c.Client == nil || c.Client.UserAgent == nil {
+		return nil
+	}
+	return c.Client.UserAgent.spanTracer
+}
+
 func (c *DialogUA) ReadInvite(inviteRequest *sip.Request, tx sip.ServerTransaction) (*DialogServerSession, error) {
 	// do some minimal validation
 	if inviteRequest.Contact() == nil {
@@ -48,11 +62,16 @@ func (c *DialogUA) ReadInvite(inviteRequest *sip.Request, tx sip.ServerTransacti
 		Dialog: Dialog{
 			ID:            id, // this id has already prebuilt tag
 			InviteRequest: inviteReq,
+			metrics:       c.metrics(),
+			spanTracer:    c.spanTracer(),
 		},
 		inviteTx: tx,
 		ua:       c,
 	}
 	dtx.Init()
+	if t, ok := tx.(interface{ TraceContext() context.Context }); ok {
+		dtx.spanStart(t.TraceContext())
+	}
 
 	if !tx.OnCancel(func(r *sip.Request) {
 		state := dtx.LoadState()
@@ -117,11 +136,14 @@ func (c *DialogUA) WriteInvite(ctx context.Context, inviteReq *sip.Request, opti
 	dtx := &DialogClientSession{
 		Dialog: Dialog{
 			InviteRequest: inviteReq,
+			metrics:       c.metrics(),
+			spanTracer:    c.spanTracer(),
 		},
 		UA: c,
 	}
 	// Init our dialog
 	dtx.Dialog.Init()
+	ctx = dtx.spanStart(ctx)
 
 	return dtx, dtx.Invite(ctx, options...)
 }
@@ -9,7 +9,9 @@ require (
 	github.com/google/uuid v1.6.0
 	github.com/icholy/digest v1.1.0
 	github.com/stretchr/testify v1.9.0
+	golang.org/x/net v0.38.0
 	golang.org/x/sync v0.16.0
+	golang.org/x/sys v0.31.0
 )
 
 require (
@@ -20,7 +22,6 @@ require (
 	github.com/kr/pretty v0.3.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/rogpeppe/go-internal v1.12.0 // indirect
-	golang.org/x/sys v0.24.0 // indirect
 	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -3,11 +3,18 @@ package sipgo
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net"
+	"net/http"
+	"os"
+	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/emiago/sipgo/sip"
 )
@@ -15,6 +22,9 @@ import (
 var (
 	// Used only for testing, better way is to pass listener with Serve{Transport}
 	ListenReadyCtxKey = "ListenReadyCtxKey"
+
+	// ErrListenTLSNoCertificate is returned by ListenAndServeTLS when config has no certificate source
+	ErrListenTLSNoCertificate = errors.New("tls config has no Certificates, GetCertificate or GetConfigForClient")
 )
 
 type ListenReadyCtxValue chan struct{}
@@ -45,6 +55,21 @@ type Server struct {
 	log *slog.Logger
 
 	requestMiddlewares []func(r *sip.Request)
+
+	// proxyProtocol are trusted proxies, when PROXY protocol is enabled on stream listeners
+	proxyProtocol []*net.IPNet
+
+	// udpSockets is number of UDP sockets opened with SO_REUSEPORT
+	udpSockets int
+
+	// listeners are served listeners. Value is true for packet listeners (UDP)
+	listenersMu sync.Mutex
+	listeners   map[io.Closer]bool
+
+	draining      atomic.Bool
+	handlers      atomic.Int64
+	drainDialogs  []func() int
+	drainProgress func(p DrainProgress)
 }
 
 type ServerOption func(s *Server) error
@@ -57,6 +82,66 @@ func WithServerLogger(logger *slog.Logger) ServerOption {
 	}
 }
 
+// WithServerProxyProtocol enables PROXY protocol v1/v2 header parsing on TCP, TLS, WS and WSS
+// listeners created with ListenAndServe and ListenAndServeTLS.
+// Header is required and accepted only from trusted proxies, given as CIDR or IP, as it sets client address.
+// For Serve functions wrap listener with sip.NewProxyProtocolListener
+func WithServerProxyProtocol(trustedProxies ...string) ServerOption {
+	return func(s *Server) error {
+		if len(trustedProxies) == 0 {
+			return fmt.Errorf("proxy protocol requires trusted proxies")
+		}
+		for _, cidr := range trustedProxies {
+			if !strings.Contains(cidr, "/") {
+				if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+					cidr += "/32"
+				} else {
+					cidr += "/128"
+				}
+			}
+			_, n, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return fmt.Errorf("invalid trusted proxy: %w", err)
+			}
+			s.proxyProtocol = append(s.proxyProtocol, n)
+		}
+		return nil
+	}
+}
+
+// WithServerUDPReusePort makes ListenAndServe open number of UDP sockets on same address with SO_REUSEPORT,
+// each with own reader. Zero uses GOMAXPROCS. Responses are sent from socket that received request.
+// Supported only on unix systems.
+//
+// Combine with sip.WithTransportLayerUDPReadBatch and sip.WithTransportLayerUDPWriteBatch to reduce syscalls further.
+func WithServerUDPReusePort(sockets int) ServerOption {
+	return func(s *Server) error {
+		if sockets <= 0 {
+			sockets = runtime.GOMAXPROCS(0)
+		}
+		s.udpSockets = sockets
+		return nil
+	}
+}
+
+// WithServerDrainDialogs makes Shutdown wait also for dialogs to end.
+// Count returns number of active dialogs, for ex. DialogServerCache.Len
+func WithServerDrainDialogs(count func() int) ServerOption {
+	return func(s *Server) error {
+		s.drainDialogs = append(s.drainDialogs, count)
+		return nil
+	}
+}
+
+// WithServerDrainProgress is called periodically with progress during Shutdown,
+// so orchestrator can be informed when draining is done.
+func WithServerDrainProgress(f func(p DrainProgress)) ServerOption {
+	return func(s *Server) error {
+		s.drainProgress = f
+		return nil
+	}
+}
+
 // NewServer creates new instance of SIP server handle.
 // Allows creating server transaction handlers
 // It uses User Agent transport and transaction layer
@@ -78,6 +163,7 @@ func newBaseServer(ua *UserAgent, options ...ServerOption) (*Server, error) {
 		// dnsResolver:         net.DefaultResolver,
 		requestMiddlewares: make([]func(r *sip.Request), 0),
 		requestHandlers:    make(map[sip.RequestMethod]RequestHandler),
+		listeners:          make(map[io.Closer]bool),
 		// log:                 log.Logger.With().Str("caller", "Server").Logger(),
 		log: sip.DefaultLogger().With("caller", "Server"),
 	}
@@ -93,10 +179,13 @@ func newBaseServer(ua *UserAgent, options ...ServerOption) (*Server, error) {
 }
 
 // Serve will fire all listeners
-// Network supported: udp, tcp, ws
+// Network supported: udp, tcp, ws, unix, unixgram
+// For unix networks addr is socket path
 func (srv *Server) ListenAndServe(ctx context.Context, network string, addr string) error {
 	network = strings.ToLower(network)
 	var connCloser io.Closer
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
 	// TODO consider different design to avoid this additional go routines
 	go func() {
@@ -105,7 +194,7 @@ func (srv *Server) ListenAndServe(ctx context.Context, network string, addr stri
 			if connCloser == nil {
 				return
 			}
-			if err := connCloser.Close(); err != nil {
+			if err := connCloser.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
 				srv.log.Error("Failed to close listener", "error", err)
 			}
 
@@ -120,14 +209,25 @@ func (srv *Server) ListenAndServe(ctx context.Context, network string, addr stri
 			return fmt.Errorf("fail to resolve address. err=%w", err)
 		}
 
-		udpConn, err := net.ListenUDP(network, laddr)
+		if srv.udpSockets > 1 {
+			conns, err := sip.ListenUDPReusePortConfig(ctx, srv.tp.ListenConfig("udp"), network, laddr.String(), srv.udpSockets)
+			if err != nil {
+				return err
+			}
+
+			connCloser = multiCloser(conns)
+			listenReadyCtx(ctx, network, conns[0].LocalAddr().String())
+			return srv.serveUDPConns(conns)
+		}
+
+		udpConn, err := srv.tp.ListenConfig("udp").ListenPacket(ctx, network, laddr.String())
 		if err != nil {
 			return fmt.Errorf("listen udp error. err=%w", err)
 		}
 
 		connCloser = udpConn
 		listenReadyCtx(ctx, network, udpConn.LocalAddr().String())
-		return srv.tp.ServeUDP(udpConn)
+		return srv.ServeUDP(udpConn)
 
 	case "tcp", "tcp4", "tcp6":
 		laddr, err := net.ResolveTCPAddr(network, addr)
@@ -135,7 +235,7 @@ func (srv *Server) ListenAndServe(ctx context.Context, network string, addr stri
 			return fmt.Errorf("fail to resolve address. err=%w", err)
 		}
 
-		conn, err := net.ListenTCP(network, laddr)
+		conn, err := srv.tp.ListenConfig("tcp").Listen(ctx, network, laddr.String())
 		if err != nil {
 			return fmt.Errorf("listen tcp error. err=%w", err)
 		}
@@ -143,7 +243,7 @@ func (srv *Server) ListenAndServe(ctx context.Context, network string, addr stri
 		connCloser = conn
 		listenReadyCtx(ctx, network, conn.Addr().String())
 
-		return srv.tp.ServeTCP(conn)
+		return srv.ServeTCP(srv.streamListener(conn))
 	case "ws", "ws4", "ws6":
 		ipv := network[2:]
 		network = "tcp" + ipv
@@ -152,7 +252,7 @@ func (srv *Server) ListenAndServe(ctx context.Context, network string, addr stri
 			return fmt.Errorf("fail to resolve address. err=%w", err)
 		}
 
-		conn, err := net.ListenTCP(network, laddr)
+		conn, err := srv.tp.ListenConfig("ws").Listen(ctx, network, laddr.String())
 		if err != nil {
 			return fmt.Errorf("listen tcp error. err=%w", err)
 		}
@@ -160,7 +260,27 @@ func (srv *Server) ListenAndServe(ctx context.Context, network string, addr stri
 		connCloser = conn
 		listenReadyCtx(ctx, network, conn.Addr().String())
 		// and uses listener to buffer
-		return srv.tp.ServeWS(conn)
+		return srv.ServeWS(srv.streamListener(conn))
+	case "unix":
+		conn, err := net.Listen("unix", addr)
+		if err != nil {
+			return fmt.Errorf("listen unix error. err=%w", err)
+		}
+
+		connCloser = conn
+		listenReadyCtx(ctx, network, conn.Addr().String())
+		return srv.ServeUnix(conn)
+	case "unixgram":
+		conn, err := net.ListenPacket("unixgram", addr)
+		if err != nil {
+			return fmt.Errorf("listen unixgram error. err=%w", err)
+		}
+		// Unlike unix listener, datagram socket file is not removed on close
+		defer os.Remove(addr)
+
+		connCloser = conn
+		listenReadyCtx(ctx, network, conn.LocalAddr().String())
+		return srv.ServeUnixgram(conn)
 	}
 	return sip.ErrTransportNotSuported
 }
@@ -181,7 +301,7 @@ func (srv *Server) ListenAndServeTLS(ctx context.Context, network string, addr s
 			if connCloser == nil {
 				return
 			}
-			if err := connCloser.Close(); err != nil {
+			if err := connCloser.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
 				srv.log.Error("Failed to close listener", "error", err)
 			}
 
@@ -199,7 +319,10 @@ func (srv *Server) ListenAndServeTLS(ctx context.Context, network string, addr s
 	case "tcp4", "ws4":
 		tcpNetwork = "tcp4"
 		network = "tls"
-	case "tcp6", "ws6":
+	case "tcp6":
+		tcpNetwork = "tcp6"
+		network = "tls"
+	case "ws6":
 		tcpNetwork = "tcp6"
 		network = "wss"
 	}
@@ -211,51 +334,221 @@ func (srv *Server) ListenAndServeTLS(ctx context.Context, network string, addr s
 			return fmt.Errorf("fail to resolve address. err=%w", err)
 		}
 
-		listener, err := tls.Listen(tcpNetwork, laddr.String(), conf)
+		if conf == nil || len(conf.Certificates) == 0 && conf.GetCertificate == nil && conf.GetConfigForClient == nil {
+			return fmt.Errorf("listen tls error. err=%w", ErrListenTLSNoCertificate)
+		}
+
+		tcpListener, err := srv.tp.ListenConfig(network).Listen(ctx, tcpNetwork, laddr.String())
 		if err != nil {
 			return fmt.Errorf("listen tls error. err=%w", err)
 		}
+		// PROXY header is sent before TLS handshake
+		listener := tls.NewListener(srv.streamListener(tcpListener), conf)
 
 		connCloser = listener
 		listenReadyCtx(ctx, network, listener.Addr().String())
 
 		if network == "wss" {
-			return srv.tp.ServeWSS(listener)
+			return srv.ServeWSS(listener)
 		}
 
-		return srv.tp.ServeTLS(listener)
+		return srv.ServeTLS(listener)
 	}
 
 	return sip.ErrTransportNotSuported
 }
 
+// AddListener starts listening on network and address while server is running.
+// It returns once listener is ready and serves in background until ctx is done or RemoveListener is called.
+// If conf is not nil listener is secured (see ListenAndServeTLS), otherwise see ListenAndServe for networks.
+// Use port 0 to get random port, which is returned in ListenerInfo.
+func (srv *Server) AddListener(ctx context.Context, network string, addr string, conf *tls.Config) (sip.ListenerInfo, error) {
+	ready := make(chan string, 1)
+	ctx = context.WithValue(ctx, ListenReadyCtxKey, ListenReadyFuncCtxValue(func(_ string, addr string) {
+		ready <- addr
+	}))
+
+	served := make(chan error, 1)
+	go func() {
+		if conf != nil {
+			served <- srv.ListenAndServeTLS(ctx, network, addr, conf)
+			return
+		}
+		served <- srv.ListenAndServe(ctx, network, addr)
+	}()
+
+	select {
+	case laddr := <-ready:
+		return sip.ListenerInfo{
+			Network: listenerNetwork(network, conf != nil),
+			Addr:    laddr,
+			TLS:     conf != nil,
+		}, nil
+	case err := <-served:
+		if err == nil {
+			err = net.ErrClosed
+		}
+		return sip.ListenerInfo{}, err
+	}
+}
+
+// RemoveListener stops listener on network and local address, as returned by Listeners.
+// Established connections and ongoing transactions are not affected.
+func (srv *Server) RemoveListener(network string, addr string) error {
+	return srv.tp.CloseListener(network, addr)
+}
+
+// Listeners returns active listeners of transport layer
+func (srv *Server) Listeners() []sip.ListenerInfo {
+	return srv.tp.Listeners()
+}
+
+// listenerNetwork maps listen network to transport network
+func listenerNetwork(network string, secure bool) string {
+	network = strings.TrimRight(strings.ToLower(network), "46")
+	if !secure {
+		return network
+	}
+	switch network {
+	case "tcp":
+		return "tls"
+	case "ws":
+		return "wss"
+	}
+	return network
+}
+
+func (srv *Server) streamListener(l net.Listener) net.Listener {
+	if len(srv.proxyProtocol) > 0 {
+		pl := sip.NewProxyProtocolListener(l)
+		pl.TrustedProxies = srv.proxyProtocol
+		return pl
+	}
+	return l
+}
+
+// serveUDPConns serves each socket with own reader. Returns when all sockets are closed
+func (srv *Server) serveUDPConns(conns []net.PacketConn) error {
+	errs := make(chan error, len(conns))
+	for _, conn := range conns {
+		go func(conn net.PacketConn) {
+			errs <- srv.ServeUDP(conn)
+		}(conn)
+	}
+
+	var err error
+	for range conns {
+		err = errors.Join(err, <-errs)
+	}
+	return err
+}
+
+type multiCloser []net.PacketConn
+
+func (m multiCloser) Close() error {
+	var err error
+	for _, c := range m {
+		err = errors.Join(err, c.Close())
+	}
+	return err
+}
+
 // ServeUDP starts serving request on UDP type listener.
 func (srv *Server) ServeUDP(l net.PacketConn) error {
+	defer srv.trackListener(l, true)()
 	return srv.tp.ServeUDP(l)
 }
 
 // ServeTCP starts serving request on TCP type listener.
 func (srv *Server) ServeTCP(l net.Listener) error {
+	defer srv.trackListener(l, false)()
 	return srv.tp.ServeTCP(l)
 }
 
 // ServeTLS starts serving request on TLS type listener.
 func (srv *Server) ServeTLS(l net.Listener) error {
+	defer srv.trackListener(l, false)()
 	return srv.tp.ServeTLS(l)
 }
 
 // ServeWS starts serving request on WS type listener.
 func (srv *Server) ServeWS(l net.Listener) error {
+	defer srv.trackListener(l, false)()
 	return srv.tp.ServeWS(l)
 }
 
 // ServeWS starts serving request on WS type listener.
 func (srv *Server) ServeWSS(l net.Listener) error {
+	defer srv.trackListener(l, false)()
 	return srv.tp.ServeWSS(l)
 }
 
+// WSHandler returns http.Handler serving SIP over websocket from existing HTTP server.
+// Mount it on your mux, for ex: mux.Handle("/sip", srv.WSHandler())
+func (srv *Server) WSHandler() http.Handler {
+	return srv.tp.WSHandler()
+}
+
+// WSSHandler is same as WSHandler but for HTTP server doing TLS termination.
+func (srv *Server) WSSHandler() http.Handler {
+	return srv.tp.WSSHandler()
+}
+
+// ServeUnix starts serving request on unix stream socket listener.
+func (srv *Server) ServeUnix(l net.Listener) error {
+	defer srv.trackListener(l, false)()
+	return srv.tp.ServeUnix(l)
+}
+
+// ServeUnixgram starts serving request on unix datagram socket.
+func (srv *Server) ServeUnixgram(l net.PacketConn) error {
+	defer srv.trackListener(l, true)()
+	return srv.tp.ServeUnixgram(l)
+}
+
+func (srv *Server) trackListener(l io.Closer, packet bool) func() {
+	srv.listenersMu.Lock()
+	srv.listeners[l] = packet
+	srv.listenersMu.Unlock()
+	return func() {
+		srv.listenersMu.Lock()
+		delete(srv.listeners, l)
+		srv.listenersMu.Unlock()
+	}
+}
+
+// closeListeners closes served listeners. If streamOnly is set, packet listeners are kept
+func (srv *Server) closeListeners(streamOnly bool) error {
+	srv.listenersMu.Lock()
+	defer srv.listenersMu.Unlock()
+
+	var err error
+	for l, packet := range srv.listeners {
+		if streamOnly && packet {
+			continue
+		}
+		if e := l.Close(); e != nil && !errors.Is(e, net.ErrClosed) {
+			err = errors.Join(err, e)
+		}
+		delete(srv.listeners, l)
+	}
+	return err
+}
+
 // handleRequest is handling transaction layer
 func (srv *Server) handleRequest(req *sip.Request, tx *sip.ServerTx) {
+	srv.handlers.Add(1)
+	defer srv.handlers.Add(-1)
+
+	if srv.draining.Load() && srv.rejectOnDrain(req) {
+		res := sip.NewResponseFromRequest(req, sip.StatusServiceUnavailable, "Service Unavailable", nil)
+		if err := tx.Respond(res); err != nil {
+			srv.log.Error("Failed to respond on drain", "error", err)
+		}
+		tx.TerminateGracefully()
+		return
+	}
+
 	for _, mid := range srv.requestMiddlewares {
 		mid(req)
 	}
@@ -274,8 +567,94 @@ func (srv *Server) WriteResponse(r *sip.Response) error {
 }
 
 // Close server handle. UserAgent must be closed for full transaction and transport layer closing.
+// Close closes all listeners served by server immediately.
+// Use Shutdown for graceful stop.
 func (srv *Server) Close() error {
-	return nil
+	return srv.closeListeners(false)
+}
+
+// rejectOnDrain returns true for requests creating new calls
+func (srv *Server) rejectOnDrain(req *sip.Request) bool {
+	if !req.IsInvite() {
+		return false
+	}
+	to := req.To()
+	if to == nil {
+		return true
+	}
+	_, hasTag := to.Params.Get("tag")
+	return !hasTag
+}
+
+// DrainProgress is state of graceful shutdown
+type DrainProgress struct {
+	// Handlers is number of request handlers still running
+	Handlers int
+	// ServerTransactions and ClientTransactions are transactions not yet terminated
+	ServerTransactions int
+	ClientTransactions int
+	// Dialogs is number of dialogs reported by WithServerDrainDialogs
+	Dialogs int
+}
+
+// Done returns true when nothing is left to drain
+func (p DrainProgress) Done() bool {
+	return p.Handlers == 0 && p.ServerTransactions == 0 && p.ClientTransactions == 0 && p.Dialogs == 0
+}
+
+// DrainProgress returns current drain state. It can be used for readiness checks
+func (srv *Server) DrainProgress() DrainProgress {
+	client, server := srv.tx.ActiveTransactions()
+	p := DrainProgress{
+		Handlers:           int(srv.handlers.Load()),
+		ServerTransactions: server,
+		ClientTransactions: client,
+	}
+	for _, count := range srv.drainDialogs {
+		p.Dialogs += count()
+	}
+	return p
+}
+
+// Draining returns true once Shutdown is called
+func (srv *Server) Draining() bool {
+	return srv.draining.Load()
+}
+
+// drainPollInterval is how often drain progress is checked
+var drainPollInterval = 100 * time.Millisecond
+
+// Shutdown gracefully stops server:
+//   - new INVITEs (without To tag) are answered with 503, in dialog requests are still handled
+//   - stream listeners (TCP, TLS, WS, WSS, UNIX) are closed, existing connections are kept
+//   - waits for running handlers, transactions and dialogs (WithServerDrainDialogs) to finish
+//   - UDP sockets are closed, as ongoing transactions used them
+//   - stream connections, dialed or accepted, are closed once no transaction uses them
+//
+// If ctx is done before, listeners are closed and ctx error is returned. Connections are then
+// left for closing UserAgent.
+func (srv *Server) Shutdown(ctx context.Context) error {
+	srv.draining.Store(true)
+	err := srv.closeListeners(true)
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		p := srv.DrainProgress()
+		if srv.drainProgress != nil {
+			srv.drainProgress(p)
+		}
+		if p.Done() {
+			err = errors.Join(err, srv.closeListeners(false))
+			return errors.Join(err, srv.TransportLayer().CloseIdleConnections())
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Join(ctx.Err(), err, srv.closeListeners(false))
+		case <-ticker.C:
+		}
+	}
 }
 
 // OnRequest registers new request callback. Can be used as generic way to add handler
@@ -1,12 +1,20 @@
 package sipgo
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	"io"
 	"log/slog"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -15,6 +23,7 @@ import (
 
 	"github.com/emiago/sipgo/fakes"
 	"github.com/emiago/sipgo/sip"
+	"github.com/emiago/sipgo/siptest"
 )
 
 func testCreateMessage(t testing.TB, rawMsg []string) sip.Message {
@@ -407,3 +416,446 @@ func ExampleServer_OnNoRoute() {
 		}
 	})
 }
+
+func TestUnixUAS(t *testing.T) {
+	// Socket paths have length limit so we avoid long test temp dirs
+	dir, err := os.MkdirTemp("", "sipgo")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, network := range []string{"unix", "unixgram"} {
+		t.Run(network, func(t *testing.T) {
+			ua, err := NewUA()
+			require.NoError(t, err)
+			defer ua.Close()
+
+			srv, err := NewServer(ua)
+			require.NoError(t, err)
+
+			srv.OnOptions(func(req *sip.Request, tx sip.ServerTransaction) {
+				res := sip.NewResponseFromRequest(req, 200, "OK", nil)
+				require.NoError(t, tx.Respond(res))
+			})
+
+			path := filepath.Join(dir, network+".sock")
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			serverReady := make(chan struct{})
+			ctx = context.WithValue(ctx, ListenReadyCtxKey, ListenReadyCtxValue(serverReady))
+			go srv.ListenAndServe(ctx, network, path)
+			<-serverReady
+
+			uac, err := NewUA()
+			require.NoError(t, err)
+			defer uac.Close()
+
+			client, err := NewClient(uac)
+			require.NoError(t, err)
+
+			req := sip.NewRequest(sip.OPTIONS, sip.Uri{User: "bob", Host: path})
+			req.SetTransport(sip.NetworkToUpper(network))
+
+			res, err := client.Do(ctx, req)
+			require.NoError(t, err)
+			require.Equal(t, 200, res.StatusCode)
+			require.Equal(t, sip.NetworkToUpper(network), req.Via().Transport)
+		})
+	}
+}
+
+func TestServerWSHandler(t *testing.T) {
+	ua, err := NewUA()
+	require.NoError(t, err)
+	defer ua.Close()
+
+	srv, err := NewServer(ua)
+	require.NoError(t, err)
+
+	srv.OnOptions(func(req *sip.Request, tx sip.ServerTransaction) {
+		res := sip.NewResponseFromRequest(req, 200, "OK", nil)
+		require.NoError(t, tx.Respond(res))
+	})
+
+	mux := http.NewServeMux()
+	mux.Handle("/", srv.WSHandler())
+	httpSrv := httptest.NewServer(mux)
+	defer httpSrv.Close()
+
+	host, port, err := sip.ParseAddr(httpSrv.Listener.Addr().String())
+	require.NoError(t, err)
+
+	uac, err := NewUA()
+	require.NoError(t, err)
+	defer uac.Close()
+
+	client, err := NewClient(uac)
+	require.NoError(t, err)
+
+	req := sip.NewRequest(sip.OPTIONS, sip.Uri{User: "bob", Host: host, Port: port})
+	req.SetTransport("WS")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := client.Do(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, 200, res.StatusCode)
+	require.Equal(t, port, srv.TransportLayer().GetListenPort("ws"))
+}
+
+func TestServerUDPReusePort(t *testing.T) {
+	ua, err := NewUA(WithUserAgentTransportLayerOptions(
+		sip.WithTransportLayerUDPReadBatch(8),
+		sip.WithTransportLayerUDPWriteBatch(8),
+	))
+	require.NoError(t, err)
+	defer ua.Close()
+
+	srv, err := NewServer(ua, WithServerUDPReusePort(4))
+	require.NoError(t, err)
+
+	srv.OnOptions(func(req *sip.Request, tx sip.ServerTransaction) {
+		res := sip.NewResponseFromRequest(req, 200, "OK", nil)
+		require.NoError(t, tx.Respond(res))
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	listenAddr := make(chan string, 1)
+	ctx = context.WithValue(ctx, ListenReadyCtxKey, ListenReadyFuncCtxValue(func(network, addr string) {
+		listenAddr <- addr
+	}))
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.ListenAndServe(ctx, "udp", "127.0.0.1:0")
+	}()
+	addr := <-listenAddr
+	srvAddr, err := net.ResolveUDPAddr("udp", addr)
+	require.NoError(t, err)
+
+	// Different sources are spread over sockets, but response must come from listening address
+	for i := 0; i < 8; i++ {
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		require.NoError(t, err)
+		defer conn.Close()
+
+		req := sip.NewRequest(sip.OPTIONS, sip.Uri{User: "bob", Host: "127.0.0.1", Port: srvAddr.Port})
+		req.AppendHeader(sip.NewHeader("Via", "SIP/2.0/UDP "+conn.LocalAddr().String()+";branch="+sip.GenerateBranch()))
+		req.AppendHeader(sip.NewHeader("From", "<sip:alice@127.0.0.1>;tag="+sip.GenerateTagN(8)))
+		req.AppendHeader(sip.NewHeader("To", "<sip:bob@127.0.0.1>"))
+		req.AppendHeader(sip.NewHeader("Call-ID", sip.GenerateTagN(16)))
+		req.AppendHeader(sip.NewHeader("CSeq", "1 OPTIONS"))
+		req.AppendHeader(sip.NewHeader("Content-Length", "0"))
+
+		_, err = conn.WriteTo([]byte(req.String()), srvAddr)
+		require.NoError(t, err)
+
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		buf := make([]byte, 2048)
+		n, from, err := conn.ReadFrom(buf)
+		require.NoError(t, err)
+		assert.Equal(t, srvAddr.String(), from.String())
+
+		msg, err := sip.ParseMessage(buf[:n])
+		require.NoError(t, err)
+		assert.Equal(t, 200, msg.(*sip.Response).StatusCode)
+	}
+
+	cancel()
+	select {
+	case <-served:
+	case <-time.After(2 * time.Second):
+		t.Fatal("server did not stop")
+	}
+}
+
+func TestServerShutdown(t *testing.T) {
+	ua, err := NewUA()
+	require.NoError(t, err)
+	defer ua.Close()
+
+	var progress []DrainProgress
+	var progressMu sync.Mutex
+	srv, err := NewServer(ua, WithServerDrainProgress(func(p DrainProgress) {
+		progressMu.Lock()
+		progress = append(progress, p)
+		progressMu.Unlock()
+	}))
+	require.NoError(t, err)
+
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	srv.OnInvite(func(req *sip.Request, tx sip.ServerTransaction) {
+		started <- struct{}{}
+		<-release
+		res := sip.NewResponseFromRequest(req, 200, "OK", nil)
+		require.NoError(t, tx.Respond(res))
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	listenAddr := make(chan string, 1)
+	lctx := context.WithValue(ctx, ListenReadyCtxKey, ListenReadyFuncCtxValue(func(network, addr string) {
+		listenAddr <- addr
+	}))
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.ListenAndServe(lctx, "tcp", "127.0.0.1:0")
+	}()
+	host, port, err := sip.ParseAddr(<-listenAddr)
+	require.NoError(t, err)
+
+	uac, err := NewUA()
+	require.NoError(t, err)
+	defer uac.Close()
+	client, err := NewClient(uac)
+	require.NoError(t, err)
+
+	newInvite := func() *sip.Request {
+		req := sip.NewRequest(sip.INVITE, sip.Uri{User: "bob", Host: host, Port: port})
+		req.SetTransport("TCP")
+		return req
+	}
+
+	// Idle accepted connection, which must be closed after drain.
+	// Request is answered, so connection is surely accepted
+	idleConn, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	require.NoError(t, err)
+	defer idleConn.Close()
+	options := createSimpleRequest(sip.OPTIONS,
+		sip.Uri{User: "alice", Host: "127.0.0.1", Port: idleConn.LocalAddr().(*net.TCPAddr).Port},
+		sip.Uri{User: "bob", Host: host, Port: port}, "TCP")
+	_, err = idleConn.Write([]byte(options.String()))
+	require.NoError(t, err)
+	idleConn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = idleConn.Read(make([]byte, 4096))
+	require.NoError(t, err)
+
+	ongoing := make(chan *sip.Response, 1)
+	go func() {
+		res, err := client.Do(ctx, newInvite())
+		assert.NoError(t, err)
+		ongoing <- res
+	}()
+	<-started
+
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- srv.Shutdown(ctx)
+	}()
+	require.Eventually(t, srv.Draining, time.Second, 10*time.Millisecond)
+
+	// New calls are rejected over existing connection
+	res, err := client.Do(ctx, newInvite())
+	require.NoError(t, err)
+	assert.Equal(t, sip.StatusServiceUnavailable, res.StatusCode)
+
+	// Listener is closed first, while ongoing call is still drained
+	select {
+	case <-served:
+	case <-time.After(time.Second):
+		t.Fatal("listener not closed")
+	}
+	select {
+	case err := <-shutdown:
+		t.Fatalf("shutdown returned before drain: %v", err)
+	default:
+	}
+
+	close(release)
+	res = <-ongoing
+	require.NotNil(t, res)
+	assert.Equal(t, 200, res.StatusCode)
+
+	select {
+	case err := <-shutdown:
+		require.NoError(t, err)
+	case <-ctx.Done():
+		t.Fatal("shutdown did not finish")
+	}
+
+	// Accepted connection is closed once drained
+	idleConn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = idleConn.Read(make([]byte, 4096))
+	require.ErrorIs(t, err, io.EOF)
+
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	require.NotEmpty(t, progress)
+	assert.False(t, progress[0].Done())
+	assert.True(t, progress[len(progress)-1].Done())
+}
+
+func TestServerAddRemoveListener(t *testing.T) {
+	ua, err := NewUA()
+	require.NoError(t, err)
+	defer ua.Close()
+
+	srv, err := NewServer(ua)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	udp, err := srv.AddListener(ctx, "udp", "127.0.0.1:0", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "udp", udp.Network)
+
+	tlsInfo, err := srv.AddListener(ctx, "tcp", "127.0.0.1:0", testServerTlsConfig(t))
+	require.NoError(t, err)
+	assert.Equal(t, sip.ListenerInfo{Network: "tls", Addr: tlsInfo.Addr, TLS: true}, tlsInfo)
+
+	_, err = srv.AddListener(ctx, "tcp", tlsInfo.Addr, nil)
+	require.Error(t, err, "address already in use")
+
+	require.Eventually(t, func() bool { return len(srv.Listeners()) == 2 }, time.Second, 10*time.Millisecond)
+	assert.ElementsMatch(t, []sip.ListenerInfo{udp, tlsInfo}, srv.Listeners())
+
+	_, tlsPort, err := sip.ParseAddr(tlsInfo.Addr)
+	require.NoError(t, err)
+	assert.Equal(t, tlsPort, srv.TransportLayer().GetListenPort("tls"))
+
+	conn, err := tls.Dial("tcp", tlsInfo.Addr, &tls.Config{InsecureSkipVerify: true})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.NoError(t, srv.RemoveListener("tls", tlsInfo.Addr))
+	require.Eventually(t, func() bool { return len(srv.Listeners()) == 1 }, time.Second, 10*time.Millisecond)
+	assert.Zero(t, srv.TransportLayer().GetListenPort("tls"))
+
+	_, err = net.DialTimeout("tcp", tlsInfo.Addr, time.Second)
+	require.Error(t, err)
+	require.ErrorIs(t, srv.RemoveListener("tls", tlsInfo.Addr), sip.ErrListenerNotFound)
+}
+
+func TestServerTransactionFakeClock(t *testing.T) {
+	clock := siptest.NewFakeClock(time.Now())
+	timers := sip.NewTimers(500*time.Millisecond, 4*time.Second, 5*time.Second)
+	ua, err := NewUA(WithUserAgentTransactionLayerOptions(
+		sip.WithTransactionLayerClock(clock),
+		sip.WithTransactionLayerTimers(timers),
+	))
+	require.NoError(t, err)
+	defer ua.Close()
+	srv, err := NewServer(ua)
+	require.NoError(t, err)
+
+	txs := make(chan sip.ServerTransaction, 1)
+	srv.OnInvite(func(req *sip.Request, tx sip.ServerTransaction) {
+		// No ACK will be sent, so Timer G retransmits until Timer H
+		tx.Respond(sip.NewResponseFromRequest(req, 486, "Busy Here", nil))
+		txs <- tx
+	})
+	srv.OnOptions(func(req *sip.Request, tx sip.ServerTransaction) {
+		tx.Respond(sip.NewResponseFromRequest(req, 200, "OK", nil))
+		txs <- tx
+	})
+
+	serverConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go srv.TransportLayer().ServeUDP(serverConn)
+
+	// sendRequest sends request from new client socket and counts received responses
+	sendRequest := func(t *testing.T, method sip.RequestMethod) (sip.ServerTransaction, *atomic.Int32) {
+		client, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+		t.Cleanup(func() { client.Close() })
+
+		received := &atomic.Int32{}
+		go func() {
+			buf := make([]byte, 4096)
+			for {
+				if _, _, err := client.ReadFrom(buf); err != nil {
+					return
+				}
+				received.Add(1)
+			}
+		}()
+
+		caddr := client.LocalAddr().(*net.UDPAddr)
+		saddr := serverConn.LocalAddr().(*net.UDPAddr)
+		req := createSimpleRequest(method,
+			sip.Uri{User: "alice", Host: caddr.IP.String(), Port: caddr.Port},
+			sip.Uri{User: "bob", Host: saddr.IP.String(), Port: saddr.Port},
+			"UDP",
+		)
+		_, err = client.WriteTo([]byte(req.String()), saddr)
+		require.NoError(t, err)
+
+		select {
+		case tx := <-txs:
+			require.Eventually(t, func() bool { return received.Load() == 1 }, time.Second, time.Millisecond)
+			return tx, received
+		case <-time.After(time.Second):
+			t.Fatal("request not handled")
+		}
+		return nil, nil
+	}
+
+	assertTerminatedAt := func(t *testing.T, tx sip.ServerTransaction, d time.Duration) {
+		clock.Advance(d - time.Millisecond)
+		select {
+		case <-tx.Done():
+			t.Fatal("transaction terminated before timer")
+		default:
+		}
+
+		clock.Advance(time.Millisecond)
+		select {
+		case <-tx.Done():
+		case <-time.After(time.Second):
+			t.Fatal("transaction did not terminate")
+		}
+	}
+
+	t.Run("TimerH", func(t *testing.T) {
+		tx, received := sendRequest(t, sip.INVITE)
+
+		// Timer G retransmissions 500ms, 1s, 2s, 4s, 4s ...
+		elapsed := time.Duration(0)
+		for i, d := range []time.Duration{500 * time.Millisecond, time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+			clock.Advance(d)
+			elapsed += d
+			require.Eventually(t, func() bool { return received.Load() == int32(i+2) }, time.Second, time.Millisecond)
+		}
+
+		// Timer H 64*T1
+		assertTerminatedAt(t, tx, timers.H-elapsed)
+		require.Eventually(t, func() bool { return clock.Timers() == 0 }, time.Second, time.Millisecond)
+	})
+
+	t.Run("TimerJ", func(t *testing.T) {
+		tx, received := sendRequest(t, sip.OPTIONS)
+
+		// Timer J 64*T1 for unreliable transport
+		assertTerminatedAt(t, tx, timers.J)
+		assert.Equal(t, int32(1), received.Load())
+		require.Eventually(t, func() bool { return clock.Timers() == 0 }, time.Second, time.Millisecond)
+	})
+}
+
+func TestServerProxyProtocolTrustedProxies(t *testing.T) {
+	ua, err := NewUA()
+	require.NoError(t, err)
+	defer ua.Close()
+
+	_, err = NewServer(ua, WithServerProxyProtocol())
+	require.Error(t, err, "trusted proxies are required")
+	_, err = NewServer(ua, WithServerProxyProtocol("10.0.0.0/33"))
+	require.Error(t, err)
+
+	srv, err := NewServer(ua, WithServerProxyProtocol("10.0.0.0/8", "192.168.1.10", "fd00::1"))
+	require.NoError(t, err)
+	require.Len(t, srv.proxyProtocol, 3)
+	assert.Equal(t, "192.168.1.10/32", srv.proxyProtocol[1].String())
+	assert.Equal(t, "fd00::1/128", srv.proxyProtocol[2].String())
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	pl, ok := srv.streamListener(l).(*sip.ProxyProtocolListener)
+	require.True(t, ok)
+	assert.Equal(t, srv.proxyProtocol, pl.TrustedProxies)
+}
@@ -0,0 +1,52 @@
+package sip
+
+import "time"
+
+// Clock is source of time for transaction and dialog timers.
+// Default is SystemClock. Fake clock like siptest.FakeClock can be injected with
+// WithTransactionLayerClock to test retransmissions and timeouts without sleeping.
+type Clock interface {
+	Now() time.Time
+	// AfterFunc calls f after duration d. Returned timer has nil channel
+	AfterFunc(d time.Duration, f func()) ClockTimer
+	// NewTimer sends current time on timer channel after duration d
+	NewTimer(d time.Duration) ClockTimer
+}
+
+// ClockTimer is timer created by Clock. It behaves same as time.Timer
+type ClockTimer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// SystemClock is Clock based on time package
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (SystemClock) AfterFunc(d time.Duration, f func()) ClockTimer {
+	return &systemTimer{t: time.AfterFunc(d, f)}
+}
+
+func (SystemClock) NewTimer(d time.Duration) ClockTimer {
+	return &systemTimer{t: time.NewTimer(d)}
+}
+
+type systemTimer struct {
+	t *time.Timer
+}
+
+func (t *systemTimer) C() <-chan time.Time {
+	return t.t.C
+}
+
+func (t *systemTimer) Stop() bool {
+	return t.t.Stop()
+}
+
+func (t *systemTimer) Reset(d time.Duration) bool {
+	return t.t.Reset(d)
+}
@@ -0,0 +1,341 @@
+package sip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log/slog"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HEP v3 chunk types. See https://github.com/sipcapture/HEP
+const (
+	hepChunkIPFamily      = 0x0001
+	hepChunkIPProtocol    = 0x0002
+	hepChunkIPv4Src       = 0x0003
+	hepChunkIPv4Dst       = 0x0004
+	hepChunkIPv6Src       = 0x0005
+	hepChunkIPv6Dst       = 0x0006
+	hepChunkSrcPort       = 0x0007
+	hepChunkDstPort       = 0x0008
+	hepChunkTimestamp     = 0x0009
+	hepChunkTimestampUsec = 0x000a
+	hepChunkProtoType     = 0x000b
+	hepChunkAgentID       = 0x000c
+	hepChunkAuthKey       = 0x000e
+	hepChunkPayload       = 0x000f
+	hepChunkCorrelationID = 0x0011
+
+	// HEPProtoSIP is HEP protocol type of SIP payload
+	HEPProtoSIP = 0x01
+)
+
+// HEPPacket is single captured message encoded as HEP v3
+type HEPPacket struct {
+	// IPProtocol is 17 for UDP and 6 for TCP based transports
+	IPProtocol uint8
+	Src        netip.AddrPort
+	Dst        netip.AddrPort
+	Time       time.Time
+	// ProtoType is payload type. Default HEPProtoSIP
+	ProtoType     uint8
+	AgentID       uint32
+	AuthKey       string
+	CorrelationID string
+	Payload       []byte
+}
+
+// Marshal encodes packet in HEP v3 format
+func (p *HEPPacket) Marshal() []byte {
+	b := make([]byte, 6, 128+len(p.Payload))
+	copy(b, "HEP3")
+
+	chunk := func(typ uint16, data []byte) {
+		b = binary.BigEndian.AppendUint16(b, 0)
+		b = binary.BigEndian.AppendUint16(b, typ)
+		b = binary.BigEndian.AppendUint16(b, uint16(6+len(data)))
+		b = append(b, data...)
+	}
+	u8 := func(typ uint16, v uint8) { chunk(typ, []byte{v}) }
+	u16 := func(typ uint16, v uint16) { chunk(typ, binary.BigEndian.AppendUint16(nil, v)) }
+	u32 := func(typ uint16, v uint32) { chunk(typ, binary.BigEndian.AppendUint32(nil, v)) }
+
+	src, dst := p.Src.Addr().Unmap(), p.Dst.Addr().Unmap()
+	if src.Is4() && dst.Is4() {
+		u8(hepChunkIPFamily, 2) // AF_INET
+		chunk(hepChunkIPv4Src, src.AsSlice())
+		chunk(hepChunkIPv4Dst, dst.AsSlice())
+	} else {
+		u8(hepChunkIPFamily, 10) // AF_INET6
+		s, d := src.As16(), dst.As16()
+		chunk(hepChunkIPv6Src, s[:])
+		chunk(hepChunkIPv6Dst, d[:])
+	}
+	u8(hepChunkIPProtocol, p.IPProtocol)
+	u16(hepChunkSrcPort, p.Src.Port())
+	u16(hepChunkDstPort, p.Dst.Port())
+
+	ts := p.Time
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	u32(hepChunkTimestamp, uint32(ts.Unix()))
+	u32(hepChunkTimestampUsec, uint32(ts.Nanosecond()/1000))
+
+	protoType := p.ProtoType
+	if protoType == 0 {
+		protoType = HEPProtoSIP
+	}
+	u8(hepChunkProtoType, protoType)
+	u32(hepChunkAgentID, p.AgentID)
+	if p.AuthKey != "" {
+		chunk(hepChunkAuthKey, []byte(p.AuthKey))
+	}
+	if p.CorrelationID != "" {
+		chunk(hepChunkCorrelationID, []byte(p.CorrelationID))
+	}
+	chunk(hepChunkPayload, p.Payload)
+
+	binary.BigEndian.PutUint16(b[4:6], uint16(len(b)))
+	return b
+}
+
+// hepRedialInterval is minimum time between dials of collector.
+// Packets captured meanwhile are dropped
+const hepRedialInterval = time.Second
+
+// HEPExporterConfig configures HEPExporter
+type HEPExporterConfig struct {
+	// AgentID is capture agent ID shown in Homer
+	AgentID uint32
+	// AuthKey is capture password, if required by collector
+	AuthKey string
+	// QueueSize is number of packets buffered before dropping. Default 4096
+	QueueSize int
+	// WriteTimeout limits single packet write, so stalled collector does not stop exporter.
+	// Packet is dropped on timeout and TCP connection is redialed. Default 2s
+	WriteTimeout time.Duration
+	Logger       *slog.Logger
+}
+
+// HEPExporterStats are counters of HEPExporter
+type HEPExporterStats struct {
+	Sent    uint64
+	Dropped uint64
+	Errors  uint64
+}
+
+// HEPExporter sends SIP messages to HEP v3 collector (Homer) over UDP or TCP.
+// It implements SIPEventTracer and it is enabled per UserAgent with WithTransportLayerTracer.
+// Messages are queued and sent in background. When queue is full messages are dropped,
+// so transports are never blocked by collector.
+type HEPExporter struct {
+	network string
+	addr    string
+	conf    HEPExporterConfig
+	log     *slog.Logger
+
+	queue     chan *HEPPacket
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+
+	sent    atomic.Uint64
+	dropped atomic.Uint64
+	errors  atomic.Uint64
+}
+
+// NewHEPExporter creates exporter sending to collector addr over network udp or tcp.
+// Collector is dialed in background on first packet, so it does not need to be up.
+// TCP connection is redialed on failure.
+func NewHEPExporter(network string, addr string, conf HEPExporterConfig) (*HEPExporter, error) {
+	switch network {
+	case "udp", "udp4", "udp6", "tcp", "tcp4", "tcp6":
+	default:
+		return nil, ErrTransportNotSuported
+	}
+	if conf.QueueSize <= 0 {
+		conf.QueueSize = 4096
+	}
+	if conf.WriteTimeout <= 0 {
+		conf.WriteTimeout = 2 * time.Second
+	}
+	if conf.Logger == nil {
+		conf.Logger = DefaultLogger()
+	}
+
+	e := &HEPExporter{
+		network: network,
+		addr:    addr,
+		conf:    conf,
+		log:     conf.Logger.With("caller", "HEPExporter"),
+		queue:   make(chan *HEPPacket, conf.QueueSize),
+		done:    make(chan struct{}),
+	}
+
+	e.wg.Add(1)
+	go e.run()
+	return e, nil
+}
+
+// SIPTrace implements SIPEventTracer
+func (e *HEPExporter) SIPTrace(ev *SIPTraceEvent) {
+	var callID string
+	if ev.Msg != nil {
+		if h := ev.Msg.CallID(); h != nil {
+			callID = h.Value()
+		}
+	}
+	if ev.Direction == SIPTraceRead {
+		e.capture(ev.Transport, ev.RemoteAddr, ev.LocalAddr, ev.Data, ev.Time, callID)
+		return
+	}
+	e.capture(ev.Transport, ev.LocalAddr, ev.RemoteAddr, ev.Data, ev.Time, callID)
+}
+
+// SIPTraceRead implements SIPTracer
+func (e *HEPExporter) SIPTraceRead(transport string, laddr string, raddr string, sipmsg []byte) {
+	e.capture(transport, raddr, laddr, sipmsg, time.Now(), "")
+}
+
+// SIPTraceWrite implements SIPTracer
+func (e *HEPExporter) SIPTraceWrite(transport string, laddr string, raddr string, sipmsg []byte) {
+	e.capture(transport, laddr, raddr, sipmsg, time.Now(), "")
+}
+
+func (e *HEPExporter) capture(transport string, src string, dst string, sipmsg []byte, ts time.Time, callID string) {
+	srcAddr, err := netip.ParseAddrPort(src)
+	if err != nil {
+		// Non IP transports like unix sockets can not be captured
+		return
+	}
+	dstAddr, err := netip.ParseAddrPort(dst)
+	if err != nil {
+		return
+	}
+
+	proto := uint8(6)
+	if transport == "UDP" {
+		proto = 17
+	}
+
+	if callID == "" {
+		callID = string(sipCallIDBytes(sipmsg))
+	}
+
+	p := &HEPPacket{
+		IPProtocol:    proto,
+		Src:           srcAddr,
+		Dst:           dstAddr,
+		Time:          ts,
+		AgentID:       e.conf.AgentID,
+		AuthKey:       e.conf.AuthKey,
+		CorrelationID: callID,
+		// Data is reused by transports
+		Payload: bytes.Clone(sipmsg),
+	}
+
+	select {
+	case <-e.done:
+	case e.queue <- p:
+	default:
+		e.dropped.Add(1)
+	}
+}
+
+func (e *HEPExporter) run() {
+	defer e.wg.Done()
+	var conn net.Conn
+	var lastDial time.Time
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	d := net.Dialer{Timeout: hepRedialInterval}
+	for {
+		select {
+		case <-e.done:
+			return
+		case p := <-e.queue:
+			if conn == nil {
+				if time.Since(lastDial) < hepRedialInterval {
+					e.dropped.Add(1)
+					continue
+				}
+				lastDial = time.Now()
+
+				var err error
+				conn, err = d.Dial(e.network, e.addr)
+				if err != nil {
+					e.errors.Add(1)
+					e.log.Debug("Failed to dial HEP collector", "addr", e.addr, "error", err)
+					continue
+				}
+			}
+
+			conn.SetWriteDeadline(time.Now().Add(e.conf.WriteTimeout))
+			if _, err := conn.Write(p.Marshal()); err != nil {
+				e.errors.Add(1)
+				e.log.Debug("Failed to send HEP packet", "addr", e.addr, "error", err)
+				if strings.HasPrefix(e.network, "tcp") {
+					conn.Close()
+					conn = nil
+				}
+				continue
+			}
+			e.sent.Add(1)
+		}
+	}
+}
+
+// Stats returns exporter counters
+func (e *HEPExporter) Stats() HEPExporterStats {
+	return HEPExporterStats{
+		Sent:    e.sent.Load(),
+		Dropped: e.dropped.Load(),
+		Errors:  e.errors.Load(),
+	}
+}
+
+// Close stops exporter. Queued packets are discarded
+func (e *HEPExporter) Close() error {
+	e.closeOnce.Do(func() {
+		close(e.done)
+	})
+	e.wg.Wait()
+	return nil
+}
+
+// sipCallIDBytes finds Call-ID header value in raw SIP message without parsing
+func sipCallIDBytes(msg []byte) []byte {
+	for len(msg) > 0 {
+		i := bytes.IndexByte(msg, '\n')
+		line := msg
+		if i >= 0 {
+			line, msg = msg[:i], msg[i+1:]
+		} else {
+			msg = nil
+		}
+		line = bytes.TrimRight(line, "\r")
+		if len(line) == 0 {
+			// End of headers
+			return nil
+		}
+
+		colon := bytes.IndexByte(line, ':')
+		if colon < 0 {
+			continue
+		}
+		name := bytes.TrimSpace(line[:colon])
+		if bytes.EqualFold(name, []byte("call-id")) || bytes.EqualFold(name, []byte("i")) {
+			return bytes.TrimSpace(line[colon+1:])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package sip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testHEPDecode decodes HEP v3 chunks by type
+func testHEPDecode(t *testing.T, b []byte) map[uint16][]byte {
+	require.GreaterOrEqual(t, len(b), 6)
+	require.Equal(t, "HEP3", string(b[:4]))
+	require.Equal(t, len(b), int(binary.BigEndian.Uint16(b[4:6])))
+
+	chunks := make(map[uint16][]byte)
+	for off := 6; off < len(b); {
+		typ := binary.BigEndian.Uint16(b[off+2:])
+		l := int(binary.BigEndian.Uint16(b[off+4:]))
+		require.GreaterOrEqual(t, l, 6)
+		chunks[typ] = b[off+6 : off+l]
+		off += l
+	}
+	return chunks
+}
+
+func TestHEPPacketMarshal(t *testing.T) {
+	ts := time.Unix(1700000000, 123456000)
+	p := HEPPacket{
+		IPProtocol:    17,
+		Src:           netip.MustParseAddrPort("10.0.0.1:5060"),
+		Dst:           netip.MustParseAddrPort("10.0.0.2:5070"),
+		Time:          ts,
+		AgentID:       2001,
+		AuthKey:       "secret",
+		CorrelationID: "abc@host",
+		Payload:       []byte("OPTIONS sip:bob@10.0.0.2 SIP/2.0\r\n\r\n"),
+	}
+	c := testHEPDecode(t, p.Marshal())
+
+	assert.Equal(t, []byte{2}, c[hepChunkIPFamily])
+	assert.Equal(t, []byte{17}, c[hepChunkIPProtocol])
+	assert.Equal(t, []byte{10, 0, 0, 1}, c[hepChunkIPv4Src])
+	assert.Equal(t, []byte{10, 0, 0, 2}, c[hepChunkIPv4Dst])
+	assert.Equal(t, uint16(5060), binary.BigEndian.Uint16(c[hepChunkSrcPort]))
+	assert.Equal(t, uint16(5070), binary.BigEndian.Uint16(c[hepChunkDstPort]))
+	assert.Equal(t, uint32(1700000000), binary.BigEndian.Uint32(c[hepChunkTimestamp]))
+	assert.Equal(t, uint32(123456), binary.BigEndian.Uint32(c[hepChunkTimestampUsec]))
+	assert.Equal(t, []byte{HEPProtoSIP}, c[hepChunkProtoType])
+	assert.Equal(t, uint32(2001), binary.BigEndian.Uint32(c[hepChunkAgentID]))
+	assert.Equal(t, "secret", string(c[hepChunkAuthKey]))
+	assert.Equal(t, "abc@host", string(c[hepChunkCorrelationID]))
+	assert.Equal(t, p.Payload, c[hepChunkPayload])
+
+	p.Src = netip.MustParseAddrPort("[::1]:5060")
+	c = testHEPDecode(t, p.Marshal())
+	assert.Equal(t, []byte{10}, c[hepChunkIPFamily])
+	assert.Len(t, c[hepChunkIPv6Src], 16)
+	assert.Len(t, c[hepChunkIPv6Dst], 16)
+}
+
+func TestHEPExporterTransportLayer(t *testing.T) {
+	collector, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer collector.Close()
+
+	hep, err := NewHEPExporter("udp", collector.LocalAddr().String(), HEPExporterConfig{AgentID: 7})
+	require.NoError(t, err)
+	defer hep.Close()
+
+	tp := NewTransportLayer(net.DefaultResolver, NewParser(), nil, WithTransportLayerSIPTracer(hep))
+	defer tp.Close()
+	tp.OnMessage(func(msg Message) {})
+
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go tp.ServeUDP(l)
+
+	client, err := net.Dial("udp", l.LocalAddr().String())
+	require.NoError(t, err)
+	defer client.Close()
+
+	req := testCreateRequest(t, "OPTIONS", "sip:bob@127.0.0.1", "UDP", client.LocalAddr().String())
+	_, err = client.Write([]byte(req.String()))
+	require.NoError(t, err)
+
+	collector.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 4096)
+	n, _, err := collector.ReadFrom(buf)
+	require.NoError(t, err)
+
+	c := testHEPDecode(t, buf[:n])
+	assert.Equal(t, []byte{17}, c[hepChunkIPProtocol])
+	assert.Equal(t, uint16(client.LocalAddr().(*net.UDPAddr).Port), binary.BigEndian.Uint16(c[hepChunkSrcPort]))
+	assert.Equal(t, uint16(l.LocalAddr().(*net.UDPAddr).Port), binary.BigEndian.Uint16(c[hepChunkDstPort]))
+	assert.Equal(t, uint32(7), binary.BigEndian.Uint32(c[hepChunkAgentID]))
+	assert.Equal(t, req.CallID().Value(), string(c[hepChunkCorrelationID]))
+	assert.Equal(t, req.String(), string(c[hepChunkPayload]))
+	assert.Eventually(t, func() bool { return hep.Stats().Sent == 1 }, time.Second, 10*time.Millisecond)
+}
+
+func TestHEPExporterCollectorDown(t *testing.T) {
+	// Reserve port without listening on it
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	l.Close()
+
+	hep, err := NewHEPExporter("tcp", addr, HEPExporterConfig{})
+	require.NoError(t, err, "collector must not be needed on start")
+	defer hep.Close()
+
+	msg := []byte("OPTIONS sip:bob@127.0.0.1 SIP/2.0\r\nCall-ID: abc\r\n\r\n")
+	hep.SIPTraceRead("TCP", "127.0.0.1:5060", "127.0.0.1:5070", msg)
+	require.Eventually(t, func() bool { return hep.Stats().Errors == 1 }, time.Second, 10*time.Millisecond)
+
+	// Collector comes up and exporter reconnects
+	l, err = net.Listen("tcp", addr)
+	require.NoError(t, err)
+	defer l.Close()
+
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf := make([]byte, 4096)
+		n, _ := conn.Read(buf)
+		received <- buf[:n]
+	}()
+
+	require.Eventually(t, func() bool {
+		hep.SIPTraceRead("TCP", "127.0.0.1:5060", "127.0.0.1:5070", msg)
+		return hep.Stats().Sent > 0
+	}, 3*time.Second, 100*time.Millisecond)
+
+	c := testHEPDecode(t, <-received)
+	assert.Equal(t, msg, c[hepChunkPayload])
+}
+
+func TestHEPExporterWriteTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	accepted := make(chan net.Conn, 2)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			// Collector never reads, so socket buffers fill up
+			t.Cleanup(func() { conn.Close() })
+			accepted <- conn
+		}
+	}()
+
+	hep, err := NewHEPExporter("tcp", l.Addr().String(), HEPExporterConfig{WriteTimeout: 50 * time.Millisecond})
+	require.NoError(t, err)
+	defer hep.Close()
+
+	msg := append([]byte("OPTIONS sip:bob@127.0.0.1 SIP/2.0\r\nCall-ID: abc\r\n\r\n"), bytes.Repeat([]byte("a"), 60000)...)
+	require.Eventually(t, func() bool {
+		hep.SIPTraceRead("TCP", "127.0.0.1:5060", "127.0.0.1:5070", msg)
+		return hep.Stats().Errors > 0
+	}, 10*time.Second, time.Millisecond, "write must time out on stalled collector")
+	<-accepted
+
+	// Stalled connection is dropped and collector is redialed
+	require.Eventually(t, func() bool {
+		hep.SIPTraceRead("TCP", "127.0.0.1:5060", "127.0.0.1:5070", msg)
+		return len(accepted) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
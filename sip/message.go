@@ -1,6 +1,7 @@
 package sip
 
 import (
+	"crypto/tls"
 	"io"
 )
 
@@ -136,6 +137,8 @@ type MessageData struct {
 	// This is for internal routing
 	src  string
 	dest string
+
+	tlsState *tls.ConnectionState
 }
 
 func (msg *MessageData) Body() []byte {
@@ -193,3 +196,24 @@ func (msg *MessageData) Destination() string {
 func (msg *MessageData) SetDestination(dest string) {
 	msg.dest = dest
 }
+
+// TLS returns TLS connection state of received message, like peer certificates.
+// Nil if message is not received over TLS or WSS
+func (msg *MessageData) TLS() *tls.ConnectionState {
+	return msg.tlsState
+}
+
+func (msg *MessageData) SetTLS(state *tls.ConnectionState) {
+	msg.tlsState = state
+}
+
+// setMessageTLS sets TLS state on received Request or Response.
+// It is not part of Message interface so custom messages are not required to carry it
+func setMessageTLS(msg Message, state *tls.ConnectionState) {
+	switch m := msg.(type) {
+	case *Request:
+		m.SetTLS(state)
+	case *Response:
+		m.SetTLS(state)
+	}
+}
@@ -0,0 +1,104 @@
+package sip
+
+import "errors"
+
+// TransactionKind is client or server side of transaction
+type TransactionKind string
+
+const (
+	TransactionKindClient TransactionKind = "client"
+	TransactionKindServer TransactionKind = "server"
+)
+
+// Transaction termination causes passed to Metrics.TransactionTerminated
+const (
+	TransactionCauseTerminated = "terminated"
+	TransactionCauseCanceled   = "canceled"
+	TransactionCauseTimeout    = "timeout"
+	TransactionCauseTransport  = "transport"
+	TransactionCauseError      = "error"
+)
+
+// Metrics receives counters and gauges from transport, transaction and dialog layers.
+// It has no dependencies and it is meant to be implemented with metrics library of your choice, like Prometheus.
+// Methods are called on hot path. They must be safe for concurrent use and must not block.
+//
+// Embed NoopMetrics to implement only part of interface.
+//
+// Experimental
+type Metrics interface {
+	// MessageReceived is called for every parsed message read from connection.
+	// Method is request method or CSeq method of response. Status is 0 for requests.
+	MessageReceived(transport string, method RequestMethod, status int)
+	// MessageSent is called for every message written to connection. Status is 0 for requests.
+	MessageSent(transport string, method RequestMethod, status int)
+	// ParseError is called when received data could not be parsed as SIP message
+	ParseError(transport string)
+
+	// TransactionStarted is called when transaction is created by transaction layer
+	TransactionStarted(kind TransactionKind, method RequestMethod)
+	// TransactionTerminated is called once transaction is removed. Cause is one of TransactionCause* values
+	TransactionTerminated(kind TransactionKind, method RequestMethod, cause string)
+	// TransactionRetransmission is called when client retransmits request, or
+	// when server receives request retransmission or retransmits final response on Timer G
+	TransactionRetransmission(kind TransactionKind, method RequestMethod)
+	// TransactionTimeout is called when client transaction times out. Timer is "B" for INVITE and "F" for other methods
+	TransactionTimeout(timer string, method RequestMethod)
+
+	// ConnectionPoolSize is called with current number of distinct connections in pool whenever it changes.
+	// Connection stored under multiple addresses is counted once.
+	ConnectionPoolSize(transport string, size int)
+
+	// DialogStateChanged is called on every dialog state transition. From is 0 for new dialog
+	DialogStateChanged(from DialogState, to DialogState)
+}
+
+// NoopMetrics implements Metrics doing nothing
+type NoopMetrics struct{}
+
+func (NoopMetrics) MessageReceived(transport string, method RequestMethod, status int)             {}
+func (NoopMetrics) MessageSent(transport string, method RequestMethod, status int)                 {}
+func (NoopMetrics) ParseError(transport string)                                                    {}
+func (NoopMetrics) TransactionStarted(kind TransactionKind, method RequestMethod)                  {}
+func (NoopMetrics) TransactionTerminated(kind TransactionKind, method RequestMethod, cause string) {}
+func (NoopMetrics) TransactionRetransmission(kind TransactionKind, method RequestMethod)           {}
+func (NoopMetrics) TransactionTimeout(timer string, method RequestMethod)                          {}
+func (NoopMetrics) ConnectionPoolSize(transport string, size int)                                  {}
+func (NoopMetrics) DialogStateChanged(from DialogState, to DialogState)                            {}
+
+// TransactionCause maps transaction termination error to one of TransactionCause* values
+func TransactionCause(err error) string {
+	switch {
+	case err == nil, errors.Is(err, ErrTransactionTerminated):
+		return TransactionCauseTerminated
+	case errors.Is(err, ErrTransactionCanceled):
+		return TransactionCauseCanceled
+	case errors.Is(err, ErrTransactionTimeout):
+		return TransactionCauseTimeout
+	case errors.Is(err, ErrTransactionTransport):
+		return TransactionCauseTransport
+	default:
+		return TransactionCauseError
+	}
+}
+
+// metricsMessage reports message read or written on transport
+func metricsMessage(m Metrics, read bool, transport string, msg Message) {
+	var method RequestMethod
+	var status int
+	switch msg := msg.(type) {
+	case *Request:
+		method = msg.Method
+	case *Response:
+		status = msg.StatusCode
+		if cseq := msg.CSeq(); cseq != nil {
+			method = cseq.MethodName
+		}
+	}
+
+	if read {
+		m.MessageReceived(transport, method, status)
+		return
+	}
+	m.MessageSent(transport, method, status)
+}
@@ -0,0 +1,155 @@
+package sip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testMetrics struct {
+	NoopMetrics
+	mu       sync.Mutex
+	counters map[string]int
+	pools    map[string]int
+}
+
+func newTestMetrics() *testMetrics {
+	return &testMetrics{counters: map[string]int{}, pools: map[string]int{}}
+}
+
+func (m *testMetrics) inc(name string) {
+	m.mu.Lock()
+	m.counters[name]++
+	m.mu.Unlock()
+}
+
+func (m *testMetrics) get(name string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.counters[name]
+}
+
+func (m *testMetrics) pool(transport string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.pools[transport]
+}
+
+func (m *testMetrics) MessageReceived(transport string, method RequestMethod, status int) {
+	m.inc(fmt.Sprintf("in %s %s %d", transport, method, status))
+}
+
+func (m *testMetrics) MessageSent(transport string, method RequestMethod, status int) {
+	m.inc(fmt.Sprintf("out %s %s %d", transport, method, status))
+}
+
+func (m *testMetrics) ParseError(transport string) {
+	m.inc("parse_error " + transport)
+}
+
+func (m *testMetrics) TransactionStarted(kind TransactionKind, method RequestMethod) {
+	m.inc(fmt.Sprintf("started %s %s", kind, method))
+}
+
+func (m *testMetrics) TransactionTerminated(kind TransactionKind, method RequestMethod, cause string) {
+	m.inc(fmt.Sprintf("terminated %s %s %s", kind, method, cause))
+}
+
+func (m *testMetrics) TransactionRetransmission(kind TransactionKind, method RequestMethod) {
+	m.inc(fmt.Sprintf("retransmission %s %s", kind, method))
+}
+
+func (m *testMetrics) ConnectionPoolSize(transport string, size int) {
+	m.mu.Lock()
+	m.pools[transport] = size
+	m.mu.Unlock()
+}
+
+func TestMetrics(t *testing.T) {
+	srvMetrics := newTestMetrics()
+	tp := NewTransportLayer(net.DefaultResolver, NewParser(), nil, WithTransportLayerMetrics(srvMetrics))
+	txl := NewTransactionLayer(tp, WithTransactionLayerMetrics(srvMetrics))
+	defer tp.Close()
+	defer txl.Close()
+
+	txl.OnRequest(func(req *Request, tx *ServerTx) {
+		res := NewResponseFromRequest(req, 200, "OK", nil)
+		require.NoError(t, tx.Respond(res))
+	})
+
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go tp.ServeUDP(l)
+
+	t.Run("Server", func(t *testing.T) {
+		client, err := net.Dial("udp", l.LocalAddr().String())
+		require.NoError(t, err)
+		defer client.Close()
+
+		req := testCreateRequest(t, "OPTIONS", "sip:bob@127.0.0.1", "UDP", client.LocalAddr().String())
+		req.CSeq().MethodName = OPTIONS
+		for i := 0; i < 2; i++ {
+			_, err = client.Write([]byte(req.String()))
+			require.NoError(t, err)
+			client.SetReadDeadline(time.Now().Add(2 * time.Second))
+			_, err = client.Read(make([]byte, 2048))
+			require.NoError(t, err)
+		}
+
+		_, err = client.Write([]byte("INVALID MESSAGE\r\n\r\n"))
+		require.NoError(t, err)
+
+		require.Eventually(t, func() bool { return srvMetrics.get("parse_error UDP") == 1 }, time.Second, 10*time.Millisecond)
+		assert.Equal(t, 2, srvMetrics.get("in UDP OPTIONS 0"))
+		assert.Equal(t, 2, srvMetrics.get("out UDP OPTIONS 200"))
+		assert.Equal(t, 1, srvMetrics.get("started server OPTIONS"))
+		assert.Equal(t, 1, srvMetrics.get("retransmission server OPTIONS"))
+	})
+
+	t.Run("Client", func(t *testing.T) {
+		m := newTestMetrics()
+		ctp := NewTransportLayer(net.DefaultResolver, NewParser(), nil, WithTransportLayerMetrics(m))
+		ctxl := NewTransactionLayer(ctp, WithTransactionLayerMetrics(m))
+		defer ctp.Close()
+		defer ctxl.Close()
+
+		req := testCreateRequest(t, "OPTIONS", "sip:bob@"+l.LocalAddr().String(), "UDP", "127.0.0.1:0")
+		req.CSeq().MethodName = OPTIONS
+		tx, err := ctxl.Request(context.Background(), req)
+		require.NoError(t, err)
+
+		select {
+		case res := <-tx.Responses():
+			assert.Equal(t, 200, res.StatusCode)
+		case <-time.After(2 * time.Second):
+			t.Fatal("no response")
+		}
+		tx.Terminate()
+
+		assert.Equal(t, 1, m.get("out UDP OPTIONS 0"))
+		assert.Equal(t, 1, m.get("in UDP OPTIONS 200"))
+		assert.Equal(t, 1, m.get("started client OPTIONS"))
+		assert.Equal(t, 1, m.get("terminated client OPTIONS terminated"))
+		// Connection is stored under local and remote address, but it is single connection
+		assert.Equal(t, 1, m.pool("UDP"))
+	})
+
+	txl.Close()
+	assert.Equal(t, 2, srvMetrics.get("started server OPTIONS"))
+	assert.Equal(t, 2, srvMetrics.get("terminated server OPTIONS terminated"))
+}
+
+func TestTransactionCause(t *testing.T) {
+	assert.Equal(t, TransactionCauseTerminated, TransactionCause(nil))
+	assert.Equal(t, TransactionCauseTerminated, TransactionCause(ErrTransactionTerminated))
+	assert.Equal(t, TransactionCauseCanceled, TransactionCause(ErrTransactionCanceled))
+	assert.Equal(t, TransactionCauseTimeout, TransactionCause(fmt.Errorf("Timer_B timed out. %w", ErrTransactionTimeout)))
+	assert.Equal(t, TransactionCauseTransport, TransactionCause(wrapTransportError(net.ErrClosed)))
+	assert.Equal(t, TransactionCauseError, TransactionCause(fmt.Errorf("other")))
+}
@@ -36,6 +36,10 @@ type ParserStream struct {
 	headerBuf     []Header
 	contentLength *ContentLengthHeader
 	contentOff    int
+
+	// captureRaw keeps raw bytes of message being parsed, for tracing
+	captureRaw bool
+	raw        []byte
 }
 
 func (p *ParserStream) reset() {
@@ -48,6 +52,7 @@ func (p *ParserStream) reset() {
 	p.headerBuf = p.headerBuf[:0]
 	p.contentLength = nil
 	p.contentOff = 0
+	p.raw = p.raw[:0]
 }
 
 // Reset the parser and the internal buffer.
@@ -79,17 +84,25 @@ func (p *ParserStream) parseSIPStreamFull(data []byte) (msgs []Message, err erro
 
 // ParseSIPStream parses SIP stream and calls callback as soon first SIP message is parsed
 func (p *ParserStream) ParseSIPStream(data []byte, cb func(msg Message)) error {
+	return p.parseSIPStreamRaw(data, func(msg Message, _ []byte) {
+		cb(msg)
+	})
+}
+
+// parseSIPStreamRaw is ParseSIPStream passing also raw bytes of each message.
+// Raw is nil unless captureRaw is set and it is only valid during callback
+func (p *ParserStream) parseSIPStreamRaw(data []byte, cb func(msg Message, raw []byte)) error {
 	if _, err := p.Write(data); err != nil {
 		return err
 	}
 	for p.buf.Len() > 0 {
-		msg, _, err := p.ParseNext()
+		msg, raw, _, err := p.parseNext()
 		if errors.Is(err, io.ErrUnexpectedEOF) {
 			return ErrParseSipPartial
 		} else if err != nil {
 			return err
 		}
-		cb(msg)
+		cb(msg, raw)
 	}
 	return nil
 }
@@ -123,23 +136,36 @@ func (p *ParserStream) Write(data []byte) (int, error) {
 // ParseNext parses the next SIP message from an internal buffer.
 // It may return io.ErrUnexpectedEOF, indicating that more data needs to be written with Write.
 func (p *ParserStream) ParseNext() (Message, int, error) {
+	msg, _, n, err := p.parseNext()
+	return msg, n, err
+}
+
+func (p *ParserStream) parseNext() (Message, []byte, int, error) {
 	if p.buf == nil {
-		return nil, 0, io.ErrUnexpectedEOF
+		return nil, nil, 0, io.ErrUnexpectedEOF
 	}
 	err := p.parseSingle()
 	reset := err == nil
 	msg, n := p.msg, p.totalRead
+	var raw []byte
+	if p.captureRaw {
+		raw = p.raw
+	}
 	if err == nil && p.totalRead > p.p.MaxMessageLength {
 		err = ErrMessageTooLarge
 	}
 	if reset {
+		// Raw keeps content until next message is parsed
 		p.reset()
 	}
-	return msg, n, err
+	return msg, raw, n, err
 }
 
 func (p *ParserStream) advance(n int) {
 	p.totalRead += n
+	if p.captureRaw {
+		p.raw = append(p.raw, p.buf.Bytes()[:n]...)
+	}
 	_ = p.buf.Next(n)
 }
 
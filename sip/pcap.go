@@ -0,0 +1,430 @@
+package sip
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	pcapngBlockSHB = 0x0A0D0D0A
+	pcapngBlockIDB = 0x00000001
+	pcapngBlockEPB = 0x00000006
+
+	pcapLinkTypeEthernet = 1
+
+	// pcapMaxSegment keeps synthesized IP packets under 64KB
+	pcapMaxSegment = 65000
+)
+
+// PCAPWriterConfig configures PCAPWriter
+type PCAPWriterConfig struct {
+	// MaxFileSize in bytes rotates file once it is reached. Zero disables rotation
+	MaxFileSize int64
+	// MaxFiles is number of files kept including current one. Oldest are removed. Zero keeps all
+	MaxFiles int
+	// QueueSize is number of messages buffered before dropping. Default 4096
+	QueueSize int
+	Logger    *slog.Logger
+}
+
+// PCAPWriterStats are counters of PCAPWriter
+type PCAPWriterStats struct {
+	Written uint64
+	Dropped uint64
+	Errors  uint64
+	Files   uint64
+}
+
+// PCAPWriter writes SIP messages into pcapng file, with synthesized Ethernet, IP and UDP or TCP headers
+// matching real addresses. Messages are captured after decryption, so TLS and WSS traffic is readable in Wireshark.
+// Secure transports keep real ports, so use Decode As SIP for ports like 5061.
+//
+// It implements SIPEventTracer and it is enabled per UserAgent with WithTransportLayerTracer.
+// Writing is done in background. Messages are dropped when queue is full.
+// Files are rotated as path.1.pcapng, path.2.pcapng... with path being most recent.
+type PCAPWriter struct {
+	path string
+	conf PCAPWriterConfig
+	log  *slog.Logger
+
+	queue     chan pcapRecord
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+
+	file *os.File
+	w    *bufio.Writer
+	size int64
+	// tcpSeq are next sequence numbers per flow, so Wireshark can reassemble streams
+	tcpSeq map[[2]netip.AddrPort]uint32
+
+	written atomic.Uint64
+	dropped atomic.Uint64
+	errors  atomic.Uint64
+	files   atomic.Uint64
+}
+
+type pcapRecord struct {
+	tcp  bool
+	src  netip.AddrPort
+	dst  netip.AddrPort
+	ts   time.Time
+	data []byte
+}
+
+// NewPCAPWriter creates pcapng file on path and starts writing
+func NewPCAPWriter(path string, conf PCAPWriterConfig) (*PCAPWriter, error) {
+	if conf.QueueSize <= 0 {
+		conf.QueueSize = 4096
+	}
+	if conf.Logger == nil {
+		conf.Logger = DefaultLogger()
+	}
+
+	w := &PCAPWriter{
+		path:   path,
+		conf:   conf,
+		log:    conf.Logger.With("caller", "PCAPWriter"),
+		queue:  make(chan pcapRecord, conf.QueueSize),
+		done:   make(chan struct{}),
+		tcpSeq: make(map[[2]netip.AddrPort]uint32),
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+
+	w.wg.Add(1)
+	go w.run()
+	return w, nil
+}
+
+// SIPTrace implements SIPEventTracer
+func (w *PCAPWriter) SIPTrace(ev *SIPTraceEvent) {
+	if ev.Direction == SIPTraceRead {
+		w.capture(ev.Transport, ev.RemoteAddr, ev.LocalAddr, ev.Data, ev.Time)
+		return
+	}
+	w.capture(ev.Transport, ev.LocalAddr, ev.RemoteAddr, ev.Data, ev.Time)
+}
+
+// SIPTraceRead implements SIPTracer
+func (w *PCAPWriter) SIPTraceRead(transport string, laddr string, raddr string, sipmsg []byte) {
+	w.capture(transport, raddr, laddr, sipmsg, time.Now())
+}
+
+// SIPTraceWrite implements SIPTracer
+func (w *PCAPWriter) SIPTraceWrite(transport string, laddr string, raddr string, sipmsg []byte) {
+	w.capture(transport, laddr, raddr, sipmsg, time.Now())
+}
+
+func (w *PCAPWriter) capture(transport string, src string, dst string, sipmsg []byte, ts time.Time) {
+	srcAddr, err := netip.ParseAddrPort(src)
+	if err != nil {
+		// Non IP transports like unix sockets can not be captured
+		return
+	}
+	dstAddr, err := netip.ParseAddrPort(dst)
+	if err != nil {
+		return
+	}
+
+	rec := pcapRecord{
+		tcp:  transport != "UDP",
+		src:  srcAddr,
+		dst:  dstAddr,
+		ts:   ts,
+		data: bytes.Clone(sipmsg),
+	}
+
+	select {
+	case <-w.done:
+	case w.queue <- rec:
+	default:
+		w.dropped.Add(1)
+	}
+}
+
+func (w *PCAPWriter) run() {
+	defer w.wg.Done()
+	for {
+		select {
+		case <-w.done:
+			// Drain what is queued before closing
+			for {
+				select {
+				case rec := <-w.queue:
+					w.writeRecord(rec)
+				default:
+					w.closeFile()
+					return
+				}
+			}
+		case rec := <-w.queue:
+			w.writeRecord(rec)
+			if len(w.queue) == 0 && w.w != nil {
+				if err := w.w.Flush(); err != nil {
+					w.errors.Add(1)
+				}
+			}
+		}
+	}
+}
+
+func (w *PCAPWriter) writeRecord(rec pcapRecord) {
+	if w.w == nil {
+		return
+	}
+
+	data := rec.data
+	for first := true; first || len(data) > 0; first = false {
+		seg := data
+		if len(seg) > pcapMaxSegment {
+			seg = seg[:pcapMaxSegment]
+		}
+		data = data[len(seg):]
+
+		pkt := w.packet(rec, seg)
+		if err := w.writeEPB(rec.ts, pkt); err != nil {
+			w.errors.Add(1)
+			w.log.Debug("Failed to write pcap", "path", w.path, "error", err)
+			return
+		}
+	}
+	w.written.Add(1)
+
+	if w.conf.MaxFileSize > 0 && w.size >= w.conf.MaxFileSize {
+		if err := w.rotate(); err != nil {
+			w.errors.Add(1)
+			w.log.Error("Failed to rotate pcap", "path", w.path, "error", err)
+		}
+	}
+}
+
+// packet builds Ethernet frame with IP and UDP or TCP header
+func (w *PCAPWriter) packet(rec pcapRecord, payload []byte) []byte {
+	src, dst := rec.src.Addr().Unmap(), rec.dst.Addr().Unmap()
+	ipv4 := src.Is4() && dst.Is4()
+	if !ipv4 {
+		src, dst = netip.AddrFrom16(src.As16()), netip.AddrFrom16(dst.As16())
+	}
+
+	var l4 []byte
+	proto := uint8(17)
+	if rec.tcp {
+		proto = 6
+		flow := [2]netip.AddrPort{rec.src, rec.dst}
+		seq := w.tcpSeq[flow]
+		ack := w.tcpSeq[[2]netip.AddrPort{rec.dst, rec.src}]
+		w.tcpSeq[flow] = seq + uint32(len(payload))
+
+		l4 = make([]byte, 20, 20+len(payload))
+		binary.BigEndian.PutUint16(l4[0:], rec.src.Port())
+		binary.BigEndian.PutUint16(l4[2:], rec.dst.Port())
+		binary.BigEndian.PutUint32(l4[4:], seq)
+		binary.BigEndian.PutUint32(l4[8:], ack)
+		l4[12] = 5 << 4
+		l4[13] = 0x18 // PSH, ACK
+		binary.BigEndian.PutUint16(l4[14:], 65535)
+		l4 = append(l4, payload...)
+		binary.BigEndian.PutUint16(l4[16:], pcapL4Checksum(src, dst, proto, l4))
+	} else {
+		l4 = make([]byte, 8, 8+len(payload))
+		binary.BigEndian.PutUint16(l4[0:], rec.src.Port())
+		binary.BigEndian.PutUint16(l4[2:], rec.dst.Port())
+		binary.BigEndian.PutUint16(l4[4:], uint16(8+len(payload)))
+		l4 = append(l4, payload...)
+		binary.BigEndian.PutUint16(l4[6:], pcapL4Checksum(src, dst, proto, l4))
+	}
+
+	// Ethernet with locally administered MACs
+	pkt := make([]byte, 14, 14+40+len(l4))
+	copy(pkt[0:], []byte{0x02, 0, 0, 0, 0, 0x02})
+	copy(pkt[6:], []byte{0x02, 0, 0, 0, 0, 0x01})
+	if ipv4 {
+		binary.BigEndian.PutUint16(pkt[12:], 0x0800)
+		ip := make([]byte, 20)
+		ip[0] = 0x45
+		binary.BigEndian.PutUint16(ip[2:], uint16(20+len(l4)))
+		binary.BigEndian.PutUint16(ip[6:], 0x4000) // DF
+		ip[8] = 64
+		ip[9] = proto
+		s, d := src.As4(), dst.As4()
+		copy(ip[12:], s[:])
+		copy(ip[16:], d[:])
+		binary.BigEndian.PutUint16(ip[10:], ^pcapChecksumSum(0, ip))
+		pkt = append(pkt, ip...)
+	} else {
+		binary.BigEndian.PutUint16(pkt[12:], 0x86DD)
+		ip := make([]byte, 40)
+		ip[0] = 0x60
+		binary.BigEndian.PutUint16(ip[4:], uint16(len(l4)))
+		ip[6] = proto
+		ip[7] = 64
+		s, d := src.As16(), dst.As16()
+		copy(ip[8:], s[:])
+		copy(ip[24:], d[:])
+		pkt = append(pkt, ip...)
+	}
+	return append(pkt, l4...)
+}
+
+func pcapChecksumSum(sum uint32, b []byte) uint16 {
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(b[i:]))
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum > 0xffff {
+		sum = (sum >> 16) + (sum & 0xffff)
+	}
+	return uint16(sum)
+}
+
+// pcapL4Checksum computes UDP or TCP checksum with IP pseudo header
+func pcapL4Checksum(src netip.Addr, dst netip.Addr, proto uint8, l4 []byte) uint16 {
+	var sum uint32
+	for _, a := range []netip.Addr{src, dst} {
+		sum += uint32(pcapChecksumSum(0, a.AsSlice()))
+	}
+	sum += uint32(proto) + uint32(len(l4))
+	cs := ^pcapChecksumSum(sum, l4)
+	if proto == 17 && cs == 0 {
+		return 0xffff
+	}
+	return cs
+}
+
+func (w *PCAPWriter) open() error {
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	w.file = f
+	w.w = bufio.NewWriter(f)
+	w.size = 0
+	// New file starts new streams for Wireshark
+	clear(w.tcpSeq)
+	w.files.Add(1)
+
+	// Section header block
+	shb := make([]byte, 28)
+	binary.LittleEndian.PutUint32(shb[0:], pcapngBlockSHB)
+	binary.LittleEndian.PutUint32(shb[4:], 28)
+	binary.LittleEndian.PutUint32(shb[8:], 0x1A2B3C4D)
+	binary.LittleEndian.PutUint16(shb[12:], 1)
+	binary.LittleEndian.PutUint16(shb[14:], 0)
+	binary.LittleEndian.PutUint64(shb[16:], ^uint64(0)) // unknown section length
+	binary.LittleEndian.PutUint32(shb[24:], 28)
+
+	// Interface description block, microsecond timestamps by default
+	idb := make([]byte, 20)
+	binary.LittleEndian.PutUint32(idb[0:], pcapngBlockIDB)
+	binary.LittleEndian.PutUint32(idb[4:], 20)
+	binary.LittleEndian.PutUint16(idb[8:], pcapLinkTypeEthernet)
+	binary.LittleEndian.PutUint32(idb[12:], 0)
+	binary.LittleEndian.PutUint32(idb[16:], 20)
+
+	return w.write(append(shb, idb...))
+}
+
+func (w *PCAPWriter) writeEPB(ts time.Time, pkt []byte) error {
+	padded := (len(pkt) + 3) &^ 3
+	total := 32 + padded
+	b := make([]byte, total)
+	usec := uint64(ts.UnixMicro())
+	binary.LittleEndian.PutUint32(b[0:], pcapngBlockEPB)
+	binary.LittleEndian.PutUint32(b[4:], uint32(total))
+	binary.LittleEndian.PutUint32(b[8:], 0) // interface
+	binary.LittleEndian.PutUint32(b[12:], uint32(usec>>32))
+	binary.LittleEndian.PutUint32(b[16:], uint32(usec))
+	binary.LittleEndian.PutUint32(b[20:], uint32(len(pkt)))
+	binary.LittleEndian.PutUint32(b[24:], uint32(len(pkt)))
+	copy(b[28:], pkt)
+	binary.LittleEndian.PutUint32(b[total-4:], uint32(total))
+	return w.write(b)
+}
+
+func (w *PCAPWriter) write(b []byte) error {
+	n, err := w.w.Write(b)
+	w.size += int64(n)
+	return err
+}
+
+// rotatedPath returns path of n-th rotated file
+func (w *PCAPWriter) rotatedPath(n int) string {
+	ext := filepath.Ext(w.path)
+	return fmt.Sprintf("%s.%d%s", strings.TrimSuffix(w.path, ext), n, ext)
+}
+
+func (w *PCAPWriter) rotate() error {
+	w.closeFile()
+
+	// Find last rotated file, removing those above limit
+	last := 0
+	for {
+		if _, err := os.Stat(w.rotatedPath(last + 1)); err != nil {
+			break
+		}
+		last++
+	}
+	for n := last; n >= 1; n-- {
+		if w.conf.MaxFiles > 0 && n+1 >= w.conf.MaxFiles {
+			os.Remove(w.rotatedPath(n))
+			continue
+		}
+		if err := os.Rename(w.rotatedPath(n), w.rotatedPath(n+1)); err != nil {
+			return err
+		}
+	}
+
+	if w.conf.MaxFiles == 1 {
+		os.Remove(w.path)
+	} else if err := os.Rename(w.path, w.rotatedPath(1)); err != nil {
+		return err
+	}
+	return w.open()
+}
+
+func (w *PCAPWriter) closeFile() {
+	if w.file == nil {
+		return
+	}
+	if err := w.w.Flush(); err != nil {
+		w.errors.Add(1)
+	}
+	if err := w.file.Close(); err != nil {
+		w.errors.Add(1)
+	}
+	w.file = nil
+	w.w = nil
+}
+
+// Stats returns writer counters
+func (w *PCAPWriter) Stats() PCAPWriterStats {
+	return PCAPWriterStats{
+		Written: w.written.Load(),
+		Dropped: w.dropped.Load(),
+		Errors:  w.errors.Load(),
+		Files:   w.files.Load(),
+	}
+}
+
+// Close writes queued messages and closes file
+func (w *PCAPWriter) Close() error {
+	w.closeOnce.Do(func() {
+		close(w.done)
+	})
+	w.wg.Wait()
+	return nil
+}
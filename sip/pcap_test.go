@@ -0,0 +1,117 @@
+package sip
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testPCAPPackets reads pcapng file and returns packets of enhanced packet blocks
+func testPCAPPackets(t *testing.T, path string) [][]byte {
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	var pkts [][]byte
+	blocks := 0
+	for off := 0; off < len(b); {
+		typ := binary.LittleEndian.Uint32(b[off:])
+		l := int(binary.LittleEndian.Uint32(b[off+4:]))
+		require.Equal(t, l, int(binary.LittleEndian.Uint32(b[off+l-4:])), "block trailing length")
+		switch blocks {
+		case 0:
+			require.Equal(t, uint32(pcapngBlockSHB), typ)
+			require.Equal(t, uint32(0x1A2B3C4D), binary.LittleEndian.Uint32(b[off+8:]))
+		case 1:
+			require.Equal(t, uint32(pcapngBlockIDB), typ)
+			require.Equal(t, uint16(pcapLinkTypeEthernet), binary.LittleEndian.Uint16(b[off+8:]))
+		default:
+			require.Equal(t, uint32(pcapngBlockEPB), typ)
+			caplen := int(binary.LittleEndian.Uint32(b[off+20:]))
+			pkts = append(pkts, b[off+28:off+28+caplen])
+		}
+		blocks++
+		off += l
+	}
+	return pkts
+}
+
+func TestPCAPWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sip.pcapng")
+	w, err := NewPCAPWriter(path, PCAPWriterConfig{})
+	require.NoError(t, err)
+
+	invite := []byte("INVITE sip:bob@10.0.0.2 SIP/2.0\r\nCall-ID: 1\r\nContent-Length: 0\r\n\r\n")
+	trying := []byte("SIP/2.0 100 Trying\r\nCall-ID: 1\r\nContent-Length: 0\r\n\r\n")
+	w.SIPTraceRead("UDP", "10.0.0.2:5060", "10.0.0.1:5070", invite)
+	w.SIPTraceWrite("TLS", "10.0.0.2:5061", "10.0.0.1:40000", invite)
+	w.SIPTraceWrite("TLS", "10.0.0.2:5061", "10.0.0.1:40000", trying)
+	w.SIPTraceRead("UDP", "[::1]:5060", "[::2]:5060", trying)
+	// Unix sockets are skipped
+	w.SIPTraceRead("UNIX", "/tmp/sip.sock", "@", trying)
+	require.NoError(t, w.Close())
+	assert.Equal(t, uint64(4), w.Stats().Written)
+
+	pkts := testPCAPPackets(t, path)
+	require.Len(t, pkts, 4)
+
+	// UDP over IPv4, read from remote
+	p := pkts[0]
+	assert.Equal(t, uint16(0x0800), binary.BigEndian.Uint16(p[12:]))
+	ip := p[14:34]
+	assert.Equal(t, uint8(17), ip[9])
+	assert.Equal(t, []byte{10, 0, 0, 1}, ip[12:16])
+	assert.Equal(t, []byte{10, 0, 0, 2}, ip[16:20])
+	assert.Equal(t, uint16(0), ^pcapChecksumSum(0, ip), "ip checksum")
+	udp := p[34:]
+	assert.Equal(t, uint16(5070), binary.BigEndian.Uint16(udp[0:]))
+	assert.Equal(t, uint16(5060), binary.BigEndian.Uint16(udp[2:]))
+	assert.Equal(t, invite, udp[8:])
+
+	// TCP segments continue sequence
+	tcp1, tcp2 := pkts[1][34:], pkts[2][34:]
+	assert.Equal(t, uint8(6), pkts[1][14+9])
+	assert.Equal(t, uint16(5061), binary.BigEndian.Uint16(tcp1[0:]))
+	assert.Zero(t, pcapL4Checksum(netip.MustParseAddr("10.0.0.2"), netip.MustParseAddr("10.0.0.1"), 6, tcp1), "tcp checksum")
+	seq1 := binary.BigEndian.Uint32(tcp1[4:])
+	assert.Equal(t, seq1+uint32(len(invite)), binary.BigEndian.Uint32(tcp2[4:]))
+	assert.Equal(t, trying, tcp2[20:])
+
+	// IPv6
+	assert.Equal(t, uint16(0x86DD), binary.BigEndian.Uint16(pkts[3][12:]))
+	assert.Equal(t, trying, pkts[3][14+40+8:])
+}
+
+func TestPCAPWriterRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "sip.pcapng")
+	w, err := NewPCAPWriter(path, PCAPWriterConfig{MaxFileSize: 300, MaxFiles: 3})
+	require.NoError(t, err)
+
+	msg := []byte("OPTIONS sip:bob@10.0.0.2 SIP/2.0\r\nCall-ID: 1\r\nContent-Length: 0\r\n\r\n")
+	for i := 0; i < 10; i++ {
+		w.SIPTraceWrite("UDP", "10.0.0.1:5060", "10.0.0.2:5060", msg)
+		// Keep order of writes deterministic for rotation
+		require.Eventually(t, func() bool { return w.Stats().Written == uint64(i+1) }, time.Second, time.Millisecond)
+	}
+	require.NoError(t, w.Close())
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	names := []string{}
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	assert.ElementsMatch(t, []string{"sip.pcapng", "sip.1.pcapng", "sip.2.pcapng"}, names)
+	assert.Greater(t, w.Stats().Files, uint64(3))
+
+	for _, n := range names {
+		pkts := testPCAPPackets(t, filepath.Join(dir, n))
+		assert.LessOrEqual(t, len(pkts), 2)
+	}
+}
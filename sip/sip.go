@@ -11,15 +11,19 @@ const (
 )
 
 var (
+	// SIPDebug enables global tracing of all transports. For tracing per UserAgent use WithTransportLayerTracer
 	SIPDebug  bool
 	siptracer SIPTracer
 )
 
+// SIPTracer receives raw SIP messages. It can be set globally with SIPDebugTracer
+// or per transport layer with WithTransportLayerSIPTracer
 type SIPTracer interface {
 	SIPTraceRead(transport string, laddr string, raddr string, sipmsg []byte)
 	SIPTraceWrite(transport string, laddr string, raddr string, sipmsg []byte)
 }
 
+// SIPDebugTracer sets global tracer used when SIPDebug is enabled. Default writes to stderr
 func SIPDebugTracer(t SIPTracer) {
 	siptracer = t
 }
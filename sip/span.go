@@ -0,0 +1,104 @@
+package sip
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// DefaultSpanHeader is SIP header carrying trace context between user agents
+const DefaultSpanHeader = "X-Trace-Context"
+
+// Span attribute keys set by transaction layer and dialogs
+const (
+	SpanAttrTxKey           = "sip.transaction.key"
+	SpanAttrMethod          = "sip.method"
+	SpanAttrCallID          = "sip.call_id"
+	SpanAttrStatusCode      = "sip.status_code"
+	SpanAttrRetransmissions = "sip.retransmissions"
+	SpanAttrTerminateReason = "sip.terminate_reason"
+	SpanAttrDialogID        = "sip.dialog.id"
+	SpanAttrDialogState     = "sip.dialog.state"
+)
+
+// SpanAttribute is key value attribute of span
+type SpanAttribute struct {
+	Key   string
+	Value any
+}
+
+// SpanTracer opens spans for transaction and dialog lifecycle and propagates
+// trace context through SIP header, so call can be followed across services.
+// It has no dependencies and adapter for OpenTelemetry or other tracing library is implemented outside.
+// SpanRecorder is in memory implementation for tests.
+//
+// Experimental
+type SpanTracer interface {
+	// Start starts span as child of span carried by ctx. Returned context carries new span
+	Start(ctx context.Context, name string, attrs ...SpanAttribute) (context.Context, Span)
+	// Inject encodes trace context of ctx as header value. Empty value is not propagated
+	Inject(ctx context.Context) string
+	// Extract returns ctx carrying remote trace context decoded from header value
+	Extract(ctx context.Context, value string) context.Context
+}
+
+// Span is started by SpanTracer
+type Span interface {
+	SetAttributes(attrs ...SpanAttribute)
+	// AddLink links span with span carried by ctx
+	AddLink(ctx context.Context)
+	// End ends span. Err is not nil when span ended with failure
+	End(err error)
+}
+
+// txSpan is tracing span of transaction
+type txSpan struct {
+	ctx  context.Context
+	span Span
+
+	status          atomic.Int32
+	retransmissions atomic.Int32
+}
+
+func (s *txSpan) end(err error) {
+	cause := TransactionCause(err)
+	attrs := []SpanAttribute{
+		{Key: SpanAttrTerminateReason, Value: cause},
+		{Key: SpanAttrRetransmissions, Value: int(s.retransmissions.Load())},
+	}
+	if status := s.status.Load(); status > 0 {
+		attrs = append(attrs, SpanAttribute{Key: SpanAttrStatusCode, Value: int(status)})
+	}
+	s.span.SetAttributes(attrs...)
+
+	if cause == TransactionCauseTerminated {
+		err = nil
+	}
+	s.span.End(err)
+}
+
+// startTxSpan starts transaction span. For client transaction trace context is injected in request header
+// and for server transaction it is extracted from request header.
+func startTxSpan(ctx context.Context, tracer SpanTracer, header string, kind TransactionKind, req *Request, key string) *txSpan {
+	if kind == TransactionKindServer {
+		if h := req.GetHeader(header); h != nil {
+			ctx = tracer.Extract(ctx, h.Value())
+		}
+	}
+
+	attrs := []SpanAttribute{
+		{Key: SpanAttrTxKey, Value: key},
+		{Key: SpanAttrMethod, Value: string(req.Method)},
+	}
+	if callid := req.CallID(); callid != nil {
+		attrs = append(attrs, SpanAttribute{Key: SpanAttrCallID, Value: callid.Value()})
+	}
+	ctx, span := tracer.Start(ctx, "sip."+string(kind)+"_tx "+string(req.Method), attrs...)
+
+	if kind == TransactionKindClient {
+		if v := tracer.Inject(ctx); v != "" {
+			req.RemoveHeader(header)
+			req.AppendHeader(NewHeader(header, v))
+		}
+	}
+	return &txSpan{ctx: ctx, span: span}
+}
@@ -0,0 +1,131 @@
+package sip
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// RecordedSpan is span recorded by SpanRecorder
+type RecordedSpan struct {
+	TraceID  uint64
+	ID       uint64
+	ParentID uint64
+	Name     string
+
+	Attributes map[string]any
+	// Links are IDs of linked spans
+	Links []uint64
+	Err   error
+	Ended bool
+}
+
+// SpanRecorder is in memory SpanTracer. Useful for testing.
+// Trace context is propagated in header as "<trace id>-<span id>".
+type SpanRecorder struct {
+	mu      sync.Mutex
+	spans   []*RecordedSpan
+	nextID  uint64
+	traceID uint64
+}
+
+type spanRecorderCtxKey struct{}
+
+// spanRecorderRef is trace context carried by context
+type spanRecorderRef struct {
+	traceID uint64
+	spanID  uint64
+}
+
+func NewSpanRecorder() *SpanRecorder {
+	return &SpanRecorder{}
+}
+
+func (r *SpanRecorder) Start(ctx context.Context, name string, attrs ...SpanAttribute) (context.Context, Span) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	s := &RecordedSpan{
+		ID:         r.nextID,
+		Name:       name,
+		Attributes: make(map[string]any),
+	}
+	if parent, ok := ctx.Value(spanRecorderCtxKey{}).(spanRecorderRef); ok {
+		s.TraceID = parent.traceID
+		s.ParentID = parent.spanID
+	} else {
+		r.traceID++
+		s.TraceID = r.traceID
+	}
+	for _, a := range attrs {
+		s.Attributes[a.Key] = a.Value
+	}
+	r.spans = append(r.spans, s)
+
+	ctx = context.WithValue(ctx, spanRecorderCtxKey{}, spanRecorderRef{traceID: s.TraceID, spanID: s.ID})
+	return ctx, &recorderSpan{r: r, s: s}
+}
+
+func (r *SpanRecorder) Inject(ctx context.Context) string {
+	ref, ok := ctx.Value(spanRecorderCtxKey{}).(spanRecorderRef)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("%d-%d", ref.traceID, ref.spanID)
+}
+
+func (r *SpanRecorder) Extract(ctx context.Context, value string) context.Context {
+	var ref spanRecorderRef
+	if _, err := fmt.Sscanf(value, "%d-%d", &ref.traceID, &ref.spanID); err != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, spanRecorderCtxKey{}, ref)
+}
+
+// Spans returns copy of recorded spans in order they were started
+func (r *SpanRecorder) Spans() []RecordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	spans := make([]RecordedSpan, 0, len(r.spans))
+	for _, s := range r.spans {
+		c := *s
+		c.Attributes = make(map[string]any, len(s.Attributes))
+		for k, v := range s.Attributes {
+			c.Attributes[k] = v
+		}
+		c.Links = append([]uint64(nil), s.Links...)
+		spans = append(spans, c)
+	}
+	return spans
+}
+
+type recorderSpan struct {
+	r *SpanRecorder
+	s *RecordedSpan
+}
+
+func (s *recorderSpan) SetAttributes(attrs ...SpanAttribute) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	for _, a := range attrs {
+		s.s.Attributes[a.Key] = a.Value
+	}
+}
+
+func (s *recorderSpan) AddLink(ctx context.Context) {
+	ref, ok := ctx.Value(spanRecorderCtxKey{}).(spanRecorderRef)
+	if !ok {
+		return
+	}
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	s.s.Links = append(s.s.Links, ref.spanID)
+}
+
+func (s *recorderSpan) End(err error) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	s.s.Ended = true
+	s.s.Err = err
+}
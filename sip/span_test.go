@@ -0,0 +1,101 @@
+package sip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransactionLayerSpanTracer(t *testing.T) {
+	rec := NewSpanRecorder()
+
+	tp := NewTransportLayer(net.DefaultResolver, NewParser(), nil)
+	txl := NewTransactionLayer(tp, WithTransactionLayerSpanTracer(rec, "X-Test-Trace"))
+	defer tp.Close()
+
+	serverCtx := make(chan context.Context, 1)
+	txl.OnRequest(func(req *Request, tx *ServerTx) {
+		serverCtx <- tx.TraceContext()
+		res := NewResponseFromRequest(req, 200, "OK", nil)
+		require.NoError(t, tx.Respond(res))
+	})
+
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go tp.ServeUDP(l)
+
+	ctp := NewTransportLayer(net.DefaultResolver, NewParser(), nil)
+	ctxl := NewTransactionLayer(ctp, WithTransactionLayerSpanTracer(rec, "X-Test-Trace"))
+	defer ctp.Close()
+	defer ctxl.Close()
+
+	req := testCreateRequest(t, "OPTIONS", "sip:bob@"+l.LocalAddr().String(), "UDP", "127.0.0.1:0")
+	req.CSeq().MethodName = OPTIONS
+	tx, err := ctxl.Request(context.Background(), req)
+	require.NoError(t, err)
+	require.NotNil(t, req.GetHeader("X-Test-Trace"))
+
+	select {
+	case res := <-tx.Responses():
+		assert.Equal(t, 200, res.StatusCode)
+	case <-time.After(2 * time.Second):
+		t.Fatal("no response")
+	}
+	tx.Terminate()
+	srvCtx := <-serverCtx
+	txl.Close()
+
+	spans := rec.Spans()
+	require.Len(t, spans, 2)
+	client, server := spans[0], spans[1]
+
+	assert.Equal(t, "sip.client_tx OPTIONS", client.Name)
+	assert.Equal(t, tx.Key(), client.Attributes[SpanAttrTxKey])
+	assert.Equal(t, "OPTIONS", client.Attributes[SpanAttrMethod])
+	assert.Equal(t, req.CallID().Value(), client.Attributes[SpanAttrCallID])
+	assert.Equal(t, 200, client.Attributes[SpanAttrStatusCode])
+	assert.Equal(t, 0, client.Attributes[SpanAttrRetransmissions])
+	assert.Equal(t, TransactionCauseTerminated, client.Attributes[SpanAttrTerminateReason])
+	assert.True(t, client.Ended)
+	assert.NoError(t, client.Err)
+
+	// Server span continues trace from header
+	assert.Equal(t, "sip.server_tx OPTIONS", server.Name)
+	assert.Equal(t, client.TraceID, server.TraceID)
+	assert.Equal(t, client.ID, server.ParentID)
+	assert.Equal(t, 200, server.Attributes[SpanAttrStatusCode])
+	assert.True(t, server.Ended)
+	assert.Equal(t, fmt.Sprintf("%d-%d", server.TraceID, server.ID), rec.Inject(srvCtx))
+}
+
+func TestSpanRecorder(t *testing.T) {
+	rec := NewSpanRecorder()
+	ctx, parent := rec.Start(context.Background(), "parent")
+	childCtx, child := rec.Start(ctx, "child", SpanAttribute{Key: "k", Value: "v"})
+
+	// Remote side continues trace
+	remoteCtx := rec.Extract(context.Background(), rec.Inject(childCtx))
+	_, remote := rec.Start(remoteCtx, "remote")
+	parent.AddLink(remoteCtx)
+
+	remote.End(nil)
+	child.End(ErrTransactionTimeout)
+	parent.End(nil)
+
+	spans := rec.Spans()
+	require.Len(t, spans, 3)
+	assert.Equal(t, spans[0].ID, spans[1].ParentID)
+	assert.Equal(t, "v", spans[1].Attributes["k"])
+	assert.ErrorIs(t, spans[1].Err, ErrTransactionTimeout)
+	assert.Equal(t, spans[1].ID, spans[2].ParentID)
+	assert.Equal(t, spans[0].TraceID, spans[2].TraceID)
+	assert.Equal(t, []uint64{spans[1].ID}, spans[0].Links)
+	for _, s := range spans {
+		assert.True(t, s.Ended)
+	}
+}
@@ -52,22 +52,25 @@ func init() {
 	SetTimers(t1, t2, t4)
 }
 
+// SetTimers changes package timers used by transaction layers without own timers.
+// Prefer WithTransactionLayerTimers, as package timers are shared by all user agents in process.
 func SetTimers(t1, t2, t4 time.Duration) {
-	T1 = t1
-	T2 = t2
-	T4 = t4
-	Timer_A = T1
-	Timer_B = 64 * T1
-	Timer_D = 32 * time.Second
-	Timer_E = T1
-	Timer_F = 64 * T1
-	Timer_G = T1
-	Timer_H = 64 * T1
-	Timer_I = T4
-	Timer_J = 64 * T1
-	Timer_K = T4
-	Timer_L = 64 * T1
-	Timer_M = 64 * T1
+	t := NewTimers(t1, t2, t4)
+	T1 = t.T1
+	T2 = t.T2
+	T4 = t.T4
+	Timer_A = t.A
+	Timer_B = t.B
+	Timer_D = t.D
+	Timer_E = t.E
+	Timer_F = t.F
+	Timer_G = t.G
+	Timer_H = t.H
+	Timer_I = t.I
+	Timer_J = t.J
+	Timer_K = t.K
+	Timer_L = t.L
+	Timer_M = t.M
 }
 
 var (
@@ -160,6 +163,8 @@ type baseTx struct {
 	//State machine control
 	fsmMu    sync.Mutex
 	fsmState fsmContextState
+	// fsmStateName is RFC name of fsmState, set together with it
+	fsmStateName string
 
 	// fsmResp fsmErr fsmAck fsmCancel are set on spin FSM
 	// Use it only if tx is inside fsm State
@@ -171,6 +176,15 @@ type baseTx struct {
 
 	log         *slog.Logger
 	onTerminate FnTxTerminate
+	metrics     Metrics
+	span        *txSpan
+	timers      Timers
+	clock       Clock
+	kind        TransactionKind
+	// reliable is transport reliability. Transaction layer sets it from its transport layer
+	reliable   bool
+	events     *txEvents
+	eventState string // last state passed to events
 }
 
 func (tx *baseTx) String() string {
@@ -193,6 +207,33 @@ func (tx *baseTx) Done() <-chan struct{} {
 	return tx.done
 }
 
+// TraceContext returns context carrying span of transaction.
+// It is context.Background when transaction layer has no SpanTracer
+func (tx *baseTx) TraceContext() context.Context {
+	if tx.span == nil {
+		return context.Background()
+	}
+	return tx.span.ctx
+}
+
+// retransmitted reports retransmission to metrics and span
+func (tx *baseTx) retransmitted(kind TransactionKind) {
+	if tx.metrics != nil {
+		tx.metrics.TransactionRetransmission(kind, tx.origin.Method)
+	}
+	if tx.span != nil {
+		tx.span.retransmissions.Add(1)
+	}
+	tx.event(TransactionEvent{Type: TransactionEventRetransmission})
+}
+
+// responded records last response status on span
+func (tx *baseTx) responded(res *Response) {
+	if tx.span != nil {
+		tx.span.status.Store(int32(res.StatusCode))
+	}
+}
+
 // OnTerminate is experimental
 // Callback function can not call any fsm related functions as it will cause deadlock like.
 // Err must not be called,instead error is passed
@@ -228,13 +269,18 @@ func (tx *baseTx) currentFsmState() fsmContextState {
 }
 
 // Initialises the correct kind of FSM based on request method.
-func (tx *baseTx) initFSM(fsmState fsmContextState) {
+func (tx *baseTx) initFSM(fsmState fsmContextState, name string) {
 	tx.fsmMu.Lock()
 	tx.fsmState = fsmState
+	tx.fsmStateName = name
 	tx.fsmMu.Unlock()
+	if tx.events != nil {
+		tx.stateChanged(name)
+	}
 }
 
 func (tx *baseTx) spinFsmUnsafe(in fsmInput) {
+	state := tx.fsmStateName
 	for i := in; i != FsmInputNone; {
 		if TransactionFSMDebug {
 			fname := runtime.FuncForPC(reflect.ValueOf(tx.fsmState).Pointer()).Name()
@@ -242,6 +288,11 @@ func (tx *baseTx) spinFsmUnsafe(in fsmInput) {
 			tx.log.Debug("Changing transaction state", "key", tx.key, "input", fsmString(i), "state", fname)
 		}
 		i = tx.fsmState(i)
+
+		if tx.events != nil && tx.fsmStateName != state {
+			state = tx.fsmStateName
+			tx.stateChanged(state)
+		}
 	}
 }
 
@@ -421,53 +472,3 @@ func makeClientTxKey(msg Message, asMethod RequestMethod) (string, error) {
 	builder.WriteString(string(method))
 	return builder.String(), nil
 }
-
-type transactionStore[T Transaction] struct {
-	items map[string]T
-	mu    sync.RWMutex
-}
-
-func newTransactionStore[T Transaction]() *transactionStore[T] {
-	return &transactionStore[T]{
-		items: make(map[string]T),
-	}
-}
-
-func (store *transactionStore[T]) lock() {
-	store.mu.Lock()
-}
-
-func (store *transactionStore[T]) unlock() {
-	store.mu.Unlock()
-}
-
-func (store *transactionStore[T]) put(key string, tx T) {
-	store.mu.Lock()
-	defer store.mu.Unlock()
-	store.items[key] = tx
-}
-
-func (store *transactionStore[T]) get(key string) (T, bool) {
-	store.mu.RLock()
-	defer store.mu.RUnlock()
-	tx, ok := store.items[key]
-	return tx, ok
-}
-
-func (store *transactionStore[T]) drop(key string) bool {
-	store.mu.Lock()
-	defer store.mu.Unlock()
-	_, exists := store.items[key]
-	delete(store.items, key)
-	return exists
-}
-
-func (store *transactionStore[T]) terminateAll() {
-	store.mu.RLock()
-	defer store.mu.RUnlock()
-	for _, tx := range store.items {
-		store.mu.RUnlock()
-		tx.Terminate() // Calls on terminate to be deleted from store. It is deadlock if called inside loop
-		store.mu.RLock()
-	}
-}
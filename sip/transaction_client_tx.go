@@ -10,15 +10,30 @@ type ClientTx struct {
 	baseTx
 	responses    chan *Response
 	timer_a_time time.Duration // Current duration of timer A.
-	timer_a      *time.Timer
-	timer_b      *time.Timer
+	timer_a      ClockTimer
+	timer_b      ClockTimer
 	timer_d_time time.Duration // Current duration of timer D.
-	timer_d      *time.Timer
-	timer_m      *time.Timer
+	timer_d      ClockTimer
+	timer_m      ClockTimer
+
+	// rtt measures time from request to first response when set
+	rtt         *RTTEstimator
+	rttDest     string
+	rttSentAt   time.Time
+	rttResent   bool
+	rttMeasured bool
 
 	onRetransmission FnTxResponse
+
+	// passUpQueued makes FSM queue responses for caller instead of blocking until they are read.
+	// It is set when FSM runs on shared worker. Queued responses are passed in order on own goroutine
+	passUpQueued bool
+	passUpQueue  []*Response
+	passingUp    bool
 }
 
+// NewClientTx creates transaction. Reliability is derived from request transport with IsReliable.
+// TransactionLayer overrides it with TransportLayer.IsReliable, which also covers custom transports.
 func NewClientTx(key string, origin *Request, conn Connection, logger *slog.Logger) *ClientTx {
 	tx := &ClientTx{}
 	tx.key = key
@@ -28,6 +43,10 @@ func NewClientTx(key string, origin *Request, conn Connection, logger *slog.Logg
 	tx.responses = make(chan *Response)
 	tx.done = make(chan struct{})
 	tx.log = logger
+	tx.timers = GlobalTimers()
+	tx.clock = SystemClock{}
+	tx.kind = TransactionKindClient
+	tx.reliable = IsReliable(origin.Transport())
 
 	tx.origin = origin // TODO:Due to subsequent request like ack we need to use clone to avoid races
 	return tx
@@ -36,13 +55,20 @@ func NewClientTx(key string, origin *Request, conn Connection, logger *slog.Logg
 func (tx *ClientTx) Init() error {
 	tx.initFSM()
 
+	// Response may arrive before write returns, so send time is recorded before
+	if tx.rtt != nil {
+		tx.mu.Lock()
+		tx.rttDest = tx.origin.raddr.String()
+		tx.rttSentAt = tx.clock.Now()
+		tx.mu.Unlock()
+	}
+
 	if err := tx.conn.WriteMsg(tx.origin); err != nil {
 		e := fmt.Errorf("fail to write request on init req=%q: %w", tx.origin.StartLine(), err)
 		return wrapTransportError(e)
 	}
 
-	reliable := IsReliable(tx.origin.Transport())
-	if reliable {
+	if tx.reliable {
 		tx.mu.Lock()
 		tx.timer_d_time = 0
 		tx.mu.Unlock()
@@ -54,19 +80,27 @@ func (tx *ClientTx) Init() error {
 		// Timer A - retransmission
 
 		tx.mu.Lock()
-		tx.timer_a_time = Timer_A
+		tx.timer_a_time = tx.timers.A
 
-		tx.timer_a = time.AfterFunc(tx.timer_a_time, func() {
+		tx.timer_a = tx.clock.AfterFunc(tx.timer_a_time, func() {
 			tx.spinFsm(client_input_timer_a)
 		})
 		// Timer D is set to 32 seconds for unreliable transports
-		tx.timer_d_time = Timer_D
+		tx.timer_d_time = tx.timers.D
 		tx.mu.Unlock()
 	}
 
 	// Timer B - timeout
 	tx.mu.Lock()
-	tx.timer_b = time.AfterFunc(Timer_B, func() {
+	tx.timer_b = tx.clock.AfterFunc(tx.timers.B, func() {
+		if tx.metrics != nil {
+			timer := "F"
+			if tx.origin.IsInvite() {
+				timer = "B"
+			}
+			tx.metrics.TransactionTimeout(timer, tx.origin.Method)
+		}
+		tx.timeoutRTT()
 		tx.spinFsmWithError(client_input_timer_b, fmt.Errorf("Timer_B timed out. %w", ErrTransactionTimeout))
 	})
 	tx.mu.Unlock()
@@ -77,9 +111,9 @@ func (tx *ClientTx) Init() error {
 // Initialises the correct kind of FSM based on request method.
 func (tx *ClientTx) initFSM() {
 	if tx.origin.IsInvite() {
-		tx.baseTx.initFSM(tx.inviteStateCalling)
+		tx.baseTx.initFSM(tx.inviteStateCalling, TransactionStateCalling)
 	} else {
-		tx.baseTx.initFSM(tx.stateCalling)
+		tx.baseTx.initFSM(tx.stateCalling, TransactionStateTrying)
 	}
 }
 
@@ -151,13 +185,58 @@ func (tx *ClientTx) Receive(res *Response) {
 	}
 	// }
 
+	tx.responded(res)
+	tx.event(TransactionEvent{Type: TransactionEventResponseReceived, Response: res})
+	tx.measureRTT()
 	tx.spinFsmWithResponse(input, res)
 }
 
+// measureRTT passes time to first response to RTT estimator.
+// Response after retransmission is ambiguous, so estimate is only backed off
+func (tx *ClientTx) measureRTT() {
+	tx.mu.Lock()
+	if tx.rtt == nil || tx.rttMeasured || tx.rttSentAt.IsZero() {
+		tx.mu.Unlock()
+		return
+	}
+	tx.rttMeasured = true
+	resent, dest, sentAt := tx.rttResent, tx.rttDest, tx.rttSentAt
+	tx.mu.Unlock()
+
+	if resent {
+		tx.rtt.Backoff(dest)
+		return
+	}
+	now := tx.clock.Now()
+	tx.rtt.Observe(dest, now.Sub(sentAt), now)
+}
+
+// timeoutRTT backs off estimate of destination that did not respond at all
+func (tx *ClientTx) timeoutRTT() {
+	tx.mu.Lock()
+	backoff := tx.rtt != nil && !tx.rttMeasured
+	tx.rttMeasured = true
+	dest := tx.rttDest
+	tx.mu.Unlock()
+
+	if backoff {
+		tx.rtt.Backoff(dest)
+	}
+}
+
 func (tx *ClientTx) Connection() Connection {
 	return tx.conn
 }
 
+// indexConnection returns connection for store index. Unreliable transports share connection
+// and never report it closed, so they are not indexed
+func (tx *ClientTx) indexConnection() Connection {
+	if !tx.reliable {
+		return nil
+	}
+	return tx.conn
+}
+
 // func (tx *ClientTx) cancel() {
 // 	if !tx.origin.IsInvite() {
 // 		return
@@ -211,6 +290,10 @@ func (tx *ClientTx) resend() {
 	}
 
 	// tx.log.Debug("resend origin request")
+	tx.retransmitted(TransactionKindClient)
+	tx.mu.Lock()
+	tx.rttResent = true
+	tx.mu.Unlock()
 
 	err := tx.conn.WriteMsg(tx.origin)
 	if err != nil {
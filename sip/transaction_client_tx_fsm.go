@@ -1,9 +1,5 @@
 package sip
 
-import (
-	"time"
-)
-
 // TODO v2
 // Better design could by passing some context through fsm state
 // Context could carry either response or error
@@ -12,26 +8,26 @@ func (tx *ClientTx) inviteStateCalling(s fsmInput) fsmInput {
 	var spinfn fsmState
 	switch s {
 	case client_input_1xx:
-		tx.fsmState, spinfn = tx.inviteStateProcceeding, tx.actInviteProceeding
+		tx.fsmState, tx.fsmStateName, spinfn = tx.inviteStateProcceeding, TransactionStateProceeding, tx.actInviteProceeding
 	case client_input_2xx:
-		tx.fsmState, spinfn = tx.inviteStateAccepted, tx.actPassupAccept
+		tx.fsmState, tx.fsmStateName, spinfn = tx.inviteStateAccepted, TransactionStateAccepted, tx.actPassupAccept
 	case client_input_300_plus:
-		tx.fsmState, spinfn = tx.inviteStateCompleted, tx.actInviteFinal
+		tx.fsmState, tx.fsmStateName, spinfn = tx.inviteStateCompleted, TransactionStateCompleted, tx.actInviteFinal
 
 		// NOTE
 		// https://datatracker.ietf.org/doc/html/rfc3261#section-9.1
 		// defines that no cancel should be sent unless we are in proceeding state
 		// problematic part is wait
 	// case client_input_cancel:
-	// 	tx.fsmState, spinfn = tx.inviteStateCalling, tx.actCancel
+	// 	tx.fsmState, tx.fsmStateName, spinfn = tx.inviteStateCalling, TransactionStateCalling, tx.actCancel
 	// case client_input_canceled:
-	// 	tx.fsmState, spinfn = tx.inviteStateCalling, tx.actInviteCanceled
+	// 	tx.fsmState, tx.fsmStateName, spinfn = tx.inviteStateCalling, TransactionStateCalling, tx.actInviteCanceled
 	case client_input_timer_a:
-		tx.fsmState, spinfn = tx.inviteStateCalling, tx.actInviteResend
+		tx.fsmState, tx.fsmStateName, spinfn = tx.inviteStateCalling, TransactionStateCalling, tx.actInviteResend
 	case client_input_timer_b:
-		tx.fsmState, spinfn = tx.inviteStateTerminated, tx.actTimeout
+		tx.fsmState, tx.fsmStateName, spinfn = tx.inviteStateTerminated, TransactionStateTerminated, tx.actTimeout
 	case client_input_transport_err:
-		tx.fsmState, spinfn = tx.inviteStateTerminated, tx.actTransErr
+		tx.fsmState, tx.fsmStateName, spinfn = tx.inviteStateTerminated, TransactionStateTerminated, tx.actTransErr
 	default:
 		// No changes
 		return FsmInputNone
@@ -44,19 +40,19 @@ func (tx *ClientTx) inviteStateProcceeding(s fsmInput) fsmInput {
 	var spinfn fsmState
 	switch s {
 	case client_input_1xx:
-		tx.fsmState, spinfn = tx.inviteStateProcceeding, tx.actPassup
+		tx.fsmState, tx.fsmStateName, spinfn = tx.inviteStateProcceeding, TransactionStateProceeding, tx.actPassup
 	case client_input_2xx:
-		tx.fsmState, spinfn = tx.inviteStateAccepted, tx.actPassupAccept
+		tx.fsmState, tx.fsmStateName, spinfn = tx.inviteStateAccepted, TransactionStateAccepted, tx.actPassupAccept
 	case client_input_300_plus:
-		tx.fsmState, spinfn = tx.inviteStateCompleted, tx.actInviteFinal
+		tx.fsmState, tx.fsmStateName, spinfn = tx.inviteStateCompleted, TransactionStateCompleted, tx.actInviteFinal
 	// case client_input_cancel:
-	// 	tx.fsmState, spinfn = tx.inviteStateProcceeding, tx.actCancelTimeout
+	// 	tx.fsmState, tx.fsmStateName, spinfn = tx.inviteStateProcceeding, TransactionStateProceeding, tx.actCancelTimeout
 	// case client_input_canceled:
-	// 	tx.fsmState, spinfn = tx.inviteStateProcceeding, tx.actInviteCanceled
+	// 	tx.fsmState, tx.fsmStateName, spinfn = tx.inviteStateProcceeding, TransactionStateProceeding, tx.actInviteCanceled
 	case client_input_timer_b:
-		tx.fsmState, spinfn = tx.inviteStateTerminated, tx.actTimeout
+		tx.fsmState, tx.fsmStateName, spinfn = tx.inviteStateTerminated, TransactionStateTerminated, tx.actTimeout
 	case client_input_transport_err:
-		tx.fsmState, spinfn = tx.inviteStateTerminated, tx.actTransErr
+		tx.fsmState, tx.fsmStateName, spinfn = tx.inviteStateTerminated, TransactionStateTerminated, tx.actTransErr
 	default:
 		// No changes
 		return FsmInputNone
@@ -69,11 +65,11 @@ func (tx *ClientTx) inviteStateCompleted(s fsmInput) fsmInput {
 	var spinfn fsmState
 	switch s {
 	case client_input_300_plus:
-		tx.fsmState, spinfn = tx.inviteStateCompleted, tx.actAckResend
+		tx.fsmState, tx.fsmStateName, spinfn = tx.inviteStateCompleted, TransactionStateCompleted, tx.actAckResend
 	case client_input_transport_err:
-		tx.fsmState, spinfn = tx.inviteStateTerminated, tx.actTransErr
+		tx.fsmState, tx.fsmStateName, spinfn = tx.inviteStateTerminated, TransactionStateTerminated, tx.actTransErr
 	case client_input_timer_d:
-		tx.fsmState, spinfn = tx.inviteStateTerminated, tx.actDelete
+		tx.fsmState, tx.fsmStateName, spinfn = tx.inviteStateTerminated, TransactionStateTerminated, tx.actDelete
 	default:
 		// No changes
 		return FsmInputNone
@@ -98,13 +94,13 @@ func (tx *ClientTx) inviteStateAccepted(s fsmInput) fsmInput {
 		//  "Proceeding" states, it MUST transition to the "Accepted" state, pass
 		//  the 2xx response to the TU, and set Timer M to 64*T1
 		tx.log.Debug("retransimission 2xx detected", "tx", tx.Key())
-		tx.fsmState, spinfn = tx.inviteStateAccepted, tx.actPassupRetransmission
+		tx.fsmState, tx.fsmStateName, spinfn = tx.inviteStateAccepted, TransactionStateAccepted, tx.actPassupRetransmission
 
 	case client_input_transport_err:
 		tx.log.Warn("client transport error detected. Waiting for retransmission", "tx", tx.Key())
-		tx.fsmState, spinfn = tx.inviteStateAccepted, tx.actTranErrNoDelete
+		tx.fsmState, tx.fsmStateName, spinfn = tx.inviteStateAccepted, TransactionStateAccepted, tx.actTranErrNoDelete
 	case client_input_timer_m:
-		tx.fsmState, spinfn = tx.inviteStateTerminated, tx.actDelete
+		tx.fsmState, tx.fsmStateName, spinfn = tx.inviteStateTerminated, TransactionStateTerminated, tx.actDelete
 	default:
 		// No changes
 		return FsmInputNone
@@ -117,7 +113,7 @@ func (tx *ClientTx) inviteStateTerminated(s fsmInput) fsmInput {
 	var spinfn fsmState
 	switch s {
 	case client_input_delete:
-		tx.fsmState, spinfn = tx.inviteStateTerminated, tx.actDelete
+		tx.fsmState, tx.fsmStateName, spinfn = tx.inviteStateTerminated, TransactionStateTerminated, tx.actDelete
 	default:
 		// No changes
 		return FsmInputNone
@@ -129,17 +125,17 @@ func (tx *ClientTx) stateCalling(s fsmInput) fsmInput {
 	var spinfn fsmState
 	switch s {
 	case client_input_1xx:
-		tx.fsmState, spinfn = tx.stateProceeding, tx.actPassup
+		tx.fsmState, tx.fsmStateName, spinfn = tx.stateProceeding, TransactionStateProceeding, tx.actPassup
 	case client_input_2xx:
-		tx.fsmState, spinfn = tx.stateCompleted, tx.actFinal
+		tx.fsmState, tx.fsmStateName, spinfn = tx.stateCompleted, TransactionStateCompleted, tx.actFinal
 	case client_input_300_plus:
-		tx.fsmState, spinfn = tx.stateCompleted, tx.actFinal
+		tx.fsmState, tx.fsmStateName, spinfn = tx.stateCompleted, TransactionStateCompleted, tx.actFinal
 	case client_input_timer_a:
-		tx.fsmState, spinfn = tx.stateCalling, tx.actResend
+		tx.fsmState, tx.fsmStateName, spinfn = tx.stateCalling, TransactionStateTrying, tx.actResend
 	case client_input_timer_b:
-		tx.fsmState, spinfn = tx.stateTerminated, tx.actTimeout
+		tx.fsmState, tx.fsmStateName, spinfn = tx.stateTerminated, TransactionStateTerminated, tx.actTimeout
 	case client_input_transport_err:
-		tx.fsmState, spinfn = tx.stateTerminated, tx.actTransErr
+		tx.fsmState, tx.fsmStateName, spinfn = tx.stateTerminated, TransactionStateTerminated, tx.actTransErr
 	default:
 		return FsmInputNone
 	}
@@ -151,17 +147,17 @@ func (tx *ClientTx) stateProceeding(s fsmInput) fsmInput {
 	var spinfn fsmState
 	switch s {
 	case client_input_1xx:
-		tx.fsmState, spinfn = tx.stateProceeding, tx.actPassup
+		tx.fsmState, tx.fsmStateName, spinfn = tx.stateProceeding, TransactionStateProceeding, tx.actPassup
 	case client_input_2xx:
-		tx.fsmState, spinfn = tx.stateCompleted, tx.actFinal
+		tx.fsmState, tx.fsmStateName, spinfn = tx.stateCompleted, TransactionStateCompleted, tx.actFinal
 	case client_input_300_plus:
-		tx.fsmState, spinfn = tx.stateCompleted, tx.actFinal
+		tx.fsmState, tx.fsmStateName, spinfn = tx.stateCompleted, TransactionStateCompleted, tx.actFinal
 	case client_input_timer_a:
-		tx.fsmState, spinfn = tx.stateProceeding, tx.actResend
+		tx.fsmState, tx.fsmStateName, spinfn = tx.stateProceeding, TransactionStateProceeding, tx.actResend
 	case client_input_timer_b:
-		tx.fsmState, spinfn = tx.stateTerminated, tx.actTimeout
+		tx.fsmState, tx.fsmStateName, spinfn = tx.stateTerminated, TransactionStateTerminated, tx.actTimeout
 	case client_input_transport_err:
-		tx.fsmState, spinfn = tx.stateTerminated, tx.actTransErr
+		tx.fsmState, tx.fsmStateName, spinfn = tx.stateTerminated, TransactionStateTerminated, tx.actTransErr
 	default:
 		return FsmInputNone
 	}
@@ -173,9 +169,9 @@ func (tx *ClientTx) stateCompleted(s fsmInput) fsmInput {
 	var spinfn fsmState
 	switch s {
 	case client_input_delete:
-		tx.fsmState, spinfn = tx.stateTerminated, tx.actDelete
+		tx.fsmState, tx.fsmStateName, spinfn = tx.stateTerminated, TransactionStateTerminated, tx.actDelete
 	case client_input_timer_d:
-		tx.fsmState, spinfn = tx.stateTerminated, tx.actDelete
+		tx.fsmState, tx.fsmStateName, spinfn = tx.stateTerminated, TransactionStateTerminated, tx.actDelete
 	default:
 		return FsmInputNone
 	}
@@ -187,7 +183,7 @@ func (tx *ClientTx) stateTerminated(s fsmInput) fsmInput {
 	var spinfn fsmState
 	switch s {
 	case client_input_delete:
-		tx.fsmState, spinfn = tx.stateTerminated, tx.actDelete
+		tx.fsmState, tx.fsmStateName, spinfn = tx.stateTerminated, TransactionStateTerminated, tx.actDelete
 	default:
 		return FsmInputNone
 	}
@@ -223,8 +219,8 @@ func (tx *ClientTx) actResend() fsmInput {
 
 	tx.timer_a_time *= 2
 	// For non-INVITE, cap timer A at T2 seconds.
-	if tx.timer_a_time > T2 {
-		tx.timer_a_time = T2
+	if tx.timer_a_time > tx.timers.T2 {
+		tx.timer_a_time = tx.timers.T2
 	}
 
 	if tx.timer_a != nil {
@@ -275,7 +271,7 @@ func (tx *ClientTx) actInviteFinal() fsmInput {
 		tx.timer_b = nil
 	}
 
-	tx.timer_d = time.AfterFunc(tx.timer_d_time, func() {
+	tx.timer_d = tx.clock.AfterFunc(tx.timer_d_time, func() {
 		tx.spinFsm(client_input_timer_d)
 	})
 
@@ -303,7 +299,7 @@ func (tx *ClientTx) actFinal() fsmInput {
 
 	// tx.Log().Tracef("timer_d set to %v", tx.timer_d_time)
 	if tx.timer_d_time > 0 {
-		tx.timer_d = time.AfterFunc(tx.timer_d_time, func() {
+		tx.timer_d = tx.clock.AfterFunc(tx.timer_d_time, func() {
 			tx.spinFsm(client_input_timer_d)
 		})
 		return FsmInputNone
@@ -346,10 +342,12 @@ func (tx *ClientTx) actAckResend() fsmInput {
 		// ACK was sent. Now delay to prevent infinite loop as temporarly fix
 		// This is not clear per RFC, but client could generate a lot requests in this case
 		tx.log.Error("ACK loop retransimission. Resending after T2", "tx", tx.Key())
+		timer := tx.clock.NewTimer(tx.timers.T2)
+		defer timer.Stop()
 		select {
 		case <-tx.done:
 			return FsmInputNone
-		case <-time.After(T2):
+		case <-timer.C():
 		}
 	}
 	tx.ack()
@@ -402,7 +400,7 @@ func (tx *ClientTx) actPassupAccept() fsmInput {
 		tx.timer_b = nil
 	}
 
-	tx.timer_m = time.AfterFunc(Timer_M, func() {
+	tx.timer_m = tx.clock.AfterFunc(tx.timers.M, func() {
 		tx.spinFsm(client_input_timer_m)
 	})
 	tx.mu.Unlock()
@@ -434,12 +432,55 @@ func (tx *ClientTx) fsmPassUp() {
 		return
 	}
 
+	if tx.passUpQueued {
+		tx.queuePassUp(lastResp)
+		return
+	}
+
 	select {
 	case <-tx.done:
 	case tx.responses <- lastResp:
 	}
 }
 
+// queuePassUp queues response for caller and starts passing queue if not running
+func (tx *ClientTx) queuePassUp(res *Response) {
+	tx.mu.Lock()
+	tx.passUpQueue = append(tx.passUpQueue, res)
+	if tx.passingUp {
+		tx.mu.Unlock()
+		return
+	}
+	tx.passingUp = true
+	tx.mu.Unlock()
+	go tx.passUpQueuedResponses()
+}
+
+func (tx *ClientTx) passUpQueuedResponses() {
+	for {
+		tx.mu.Lock()
+		if len(tx.passUpQueue) == 0 {
+			tx.passingUp = false
+			tx.mu.Unlock()
+			return
+		}
+		res := tx.passUpQueue[0]
+		tx.passUpQueue[0] = nil
+		tx.passUpQueue = tx.passUpQueue[1:]
+		tx.mu.Unlock()
+
+		select {
+		case <-tx.done:
+			tx.mu.Lock()
+			tx.passUpQueue = nil
+			tx.passingUp = false
+			tx.mu.Unlock()
+			return
+		case tx.responses <- res:
+		}
+	}
+}
+
 func (tx *ClientTx) passUpRetransmission() {
 	// RFC 6026 handling retransmissions
 	lastResp := tx.fsmResp
@@ -0,0 +1,166 @@
+package sip
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Transaction states as named by RFC 3261 17. Server INVITE Accepted state is from RFC 6026
+const (
+	TransactionStateCalling    = "Calling"
+	TransactionStateTrying     = "Trying"
+	TransactionStateProceeding = "Proceeding"
+	TransactionStateCompleted  = "Completed"
+	TransactionStateConfirmed  = "Confirmed"
+	TransactionStateAccepted   = "Accepted"
+	TransactionStateTerminated = "Terminated"
+)
+
+type TransactionEventType int
+
+const (
+	TransactionEventCreated TransactionEventType = iota
+	TransactionEventStateChanged
+	TransactionEventRetransmission
+	TransactionEventResponseReceived
+	TransactionEventResponseSent
+	TransactionEventTerminated
+)
+
+func (t TransactionEventType) String() string {
+	switch t {
+	case TransactionEventCreated:
+		return "created"
+	case TransactionEventStateChanged:
+		return "state_changed"
+	case TransactionEventRetransmission:
+		return "retransmission"
+	case TransactionEventResponseReceived:
+		return "response_received"
+	case TransactionEventResponseSent:
+		return "response_sent"
+	case TransactionEventTerminated:
+		return "terminated"
+	}
+	return "unknown"
+}
+
+// TransactionEvent is lifecycle event of client or server transaction
+type TransactionEvent struct {
+	Type   TransactionEventType
+	Kind   TransactionKind
+	Key    string
+	Method RequestMethod
+	Time   time.Time
+
+	// FromState and State are set on TransactionEventStateChanged. FromState is empty for initial state
+	FromState string
+	State     string
+	// Response is copy of received or sent response. Sent responses include
+	// automatic 100 Trying and retransmissions
+	Response *Response
+	// Err is set on TransactionEventTerminated
+	Err error
+}
+
+// TransactionEventHandler receives transaction events. It is called on single goroutine
+// in order of events, so it can block without blocking transactions.
+type TransactionEventHandler func(ev TransactionEvent)
+
+// txEvents passes events to handler over queue. Events are dropped when queue is full
+type txEvents struct {
+	queue   chan TransactionEvent
+	handler TransactionEventHandler
+	dropped atomic.Uint64
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+func newTxEvents(h TransactionEventHandler, queueSize int) *txEvents {
+	if queueSize <= 0 {
+		queueSize = 1024
+	}
+	e := &txEvents{
+		queue:   make(chan TransactionEvent, queueSize),
+		handler: h,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+func (e *txEvents) run() {
+	defer close(e.done)
+	for {
+		select {
+		case ev := <-e.queue:
+			e.handler(ev)
+		case <-e.stop:
+			// Pass what is queued
+			for {
+				select {
+				case ev := <-e.queue:
+					e.handler(ev)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (e *txEvents) emit(ev TransactionEvent) {
+	select {
+	case e.queue <- ev:
+	default:
+		e.dropped.Add(1)
+	}
+}
+
+func (e *txEvents) close() {
+	e.stopOnce.Do(func() { close(e.stop) })
+	<-e.done
+}
+
+// event emits transaction event if layer has event handler
+func (tx *baseTx) event(ev TransactionEvent) {
+	if tx.events == nil {
+		return
+	}
+	ev.Kind = tx.kind
+	ev.Key = tx.key
+	ev.Method = tx.origin.Method
+	ev.Time = tx.clock.Now()
+	if ev.Response != nil {
+		// Handler runs on other goroutine while response can still be changed
+		ev.Response = ev.Response.Clone()
+	}
+	tx.events.emit(ev)
+}
+
+// stateChanged emits state change. Terminated state is emitted on termination, as
+// transaction can be terminated without reaching it
+func (tx *baseTx) stateChanged(name string) {
+	if name == TransactionStateTerminated {
+		return
+	}
+	tx.mu.Lock()
+	from := tx.eventState
+	tx.eventState = name
+	tx.mu.Unlock()
+	tx.event(TransactionEvent{Type: TransactionEventStateChanged, FromState: from, State: name})
+}
+
+// terminated emits change to Terminated state and termination
+func (tx *baseTx) terminated(err error) {
+	tx.mu.Lock()
+	from := tx.eventState
+	tx.eventState = TransactionStateTerminated
+	tx.mu.Unlock()
+	tx.event(TransactionEvent{Type: TransactionEventStateChanged, FromState: from, State: TransactionStateTerminated})
+	tx.event(TransactionEvent{Type: TransactionEventTerminated, Err: err})
+}
@@ -0,0 +1,207 @@
+package sip
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testTxEvents struct {
+	mu     sync.Mutex
+	events []TransactionEvent
+}
+
+func (e *testTxEvents) handle(ev TransactionEvent) {
+	e.mu.Lock()
+	e.events = append(e.events, ev)
+	e.mu.Unlock()
+}
+
+// list returns events of kind as type or state for easier comparing
+func (e *testTxEvents) list(kind TransactionKind) []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var list []string
+	for _, ev := range e.events {
+		if ev.Kind != kind {
+			continue
+		}
+		if ev.Type == TransactionEventStateChanged {
+			list = append(list, ev.FromState+">"+ev.State)
+			continue
+		}
+		list = append(list, ev.Type.String())
+	}
+	return list
+}
+
+func TestTransactionLayerEventHandler(t *testing.T) {
+	timers := NewTimers(10*time.Millisecond, 40*time.Millisecond, 10*time.Millisecond)
+	timers.D = 10 * time.Millisecond
+
+	srvEvents := &testTxEvents{}
+	srvTp := NewTransportLayer(net.DefaultResolver, NewParser(), nil)
+	srvTxl := NewTransactionLayer(srvTp, WithTransactionLayerTimers(timers), WithTransactionLayerEventHandler(srvEvents.handle, 0))
+	defer srvTp.Close()
+	srvTxl.OnRequest(func(req *Request, tx *ServerTx) {
+		require.NoError(t, tx.Respond(NewResponseFromRequest(req, StatusOK, "OK", nil)))
+	})
+
+	udpConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go srvTp.ServeUDP(udpConn)
+
+	cliEvents := &testTxEvents{}
+	cliTp := NewTransportLayer(net.DefaultResolver, NewParser(), nil)
+	cliTxl := NewTransactionLayer(cliTp, WithTransactionLayerTimers(timers), WithTransactionLayerEventHandler(cliEvents.handle, 0))
+	defer cliTp.Close()
+
+	req := testCreateRequest(t, "OPTIONS", "sip:bob@"+udpConn.LocalAddr().String(), "UDP", "127.0.0.1:0")
+	req.CSeq().MethodName = OPTIONS
+	tx, err := cliTxl.Request(context.Background(), req)
+	require.NoError(t, err)
+
+	select {
+	case res := <-tx.Responses():
+		assert.Equal(t, StatusOK, res.StatusCode)
+	case <-time.After(3 * time.Second):
+		t.Fatal("no response")
+	}
+
+	// Timer D and J terminate transactions
+	<-tx.Done()
+	require.Eventually(t, func() bool {
+		_, server := srvTxl.ActiveTransactions()
+		return server == 0
+	}, 3*time.Second, 10*time.Millisecond)
+
+	// Closing passes all queued events
+	cliTxl.Close()
+	srvTxl.Close()
+
+	assert.Equal(t, []string{
+		"created",
+		">" + TransactionStateTrying,
+		"response_received",
+		TransactionStateTrying + ">" + TransactionStateCompleted,
+		TransactionStateCompleted + ">" + TransactionStateTerminated,
+		"terminated",
+	}, cliEvents.list(TransactionKindClient))
+
+	assert.Equal(t, []string{
+		"created",
+		">" + TransactionStateTrying,
+		"response_sent",
+		TransactionStateTrying + ">" + TransactionStateCompleted,
+		TransactionStateCompleted + ">" + TransactionStateTerminated,
+		"terminated",
+	}, srvEvents.list(TransactionKindServer))
+
+	ev := cliEvents.events[0]
+	assert.Equal(t, tx.Key(), ev.Key)
+	assert.Equal(t, OPTIONS, ev.Method)
+	assert.False(t, ev.Time.IsZero())
+	assert.Zero(t, cliTxl.TransactionEventsDropped())
+}
+
+func TestTransactionEventsDropped(t *testing.T) {
+	block := make(chan struct{})
+	e := newTxEvents(func(ev TransactionEvent) { <-block }, 1)
+
+	// First is taken by handler, second is queued
+	e.emit(TransactionEvent{})
+	require.Eventually(t, func() bool { return len(e.queue) == 0 }, time.Second, time.Millisecond)
+	e.emit(TransactionEvent{})
+	e.emit(TransactionEvent{})
+	assert.EqualValues(t, 1, e.dropped.Load())
+	close(block)
+	e.close()
+}
+
+func TestTransactionLayerEventHandlerInvite(t *testing.T) {
+	timers := NewTimers(10*time.Millisecond, 40*time.Millisecond, 10*time.Millisecond)
+	timers.Trying = 10 * time.Millisecond
+
+	srvEvents := &testTxEvents{}
+	srvTp := NewTransportLayer(net.DefaultResolver, NewParser(), nil)
+	srvTxl := NewTransactionLayer(srvTp, WithTransactionLayerTimers(timers), WithTransactionLayerEventHandler(srvEvents.handle, 0))
+	defer srvTp.Close()
+
+	responded := make(chan *Response, 1)
+	srvTxl.OnRequest(func(req *Request, tx *ServerTx) {
+		// Let automatic 100 Trying be sent
+		time.Sleep(5 * timers.Trying)
+		res := NewResponseFromRequest(req, StatusBusyHere, "Busy Here", nil)
+		require.NoError(t, tx.Respond(res))
+		responded <- res
+	})
+
+	udpConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go srvTp.ServeUDP(udpConn)
+
+	client, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer client.Close()
+
+	req := testCreateRequest(t, "INVITE", "sip:bob@"+udpConn.LocalAddr().String(), "UDP", client.LocalAddr().String())
+	_, err = client.WriteTo([]byte(req.String()), udpConn.LocalAddr())
+	require.NoError(t, err)
+
+	parser := NewParser()
+	readResponse := func() *Response {
+		buf := make([]byte, 65535)
+		client.SetReadDeadline(time.Now().Add(3 * time.Second))
+		n, _, err := client.ReadFrom(buf)
+		require.NoError(t, err)
+		msg, err := parser.ParseSIP(buf[:n])
+		require.NoError(t, err)
+		return msg.(*Response)
+	}
+	assert.Equal(t, StatusTrying, readResponse().StatusCode)
+	res := readResponse()
+	assert.Equal(t, StatusBusyHere, res.StatusCode)
+	// Wait Timer G retransmission before ACK
+	assert.Equal(t, StatusBusyHere, readResponse().StatusCode)
+
+	ack := newAckRequestNon2xx(req, res, nil)
+	_, err = client.WriteTo([]byte(ack.String()), udpConn.LocalAddr())
+	require.NoError(t, err)
+
+	sent := <-responded
+	require.Eventually(t, func() bool {
+		_, server := srvTxl.ActiveTransactions()
+		return server == 0
+	}, 3*time.Second, 10*time.Millisecond)
+	srvTxl.Close()
+
+	var states []string
+	var codes []int
+	for _, ev := range srvEvents.events {
+		switch ev.Type {
+		case TransactionEventStateChanged:
+			states = append(states, ev.FromState+">"+ev.State)
+		case TransactionEventResponseSent:
+			codes = append(codes, ev.Response.StatusCode)
+			if ev.Response.StatusCode == StatusBusyHere {
+				assert.NotSame(t, sent, ev.Response, "response must be copied")
+			}
+		}
+	}
+	assert.Equal(t, []string{
+		">" + TransactionStateProceeding,
+		TransactionStateProceeding + ">" + TransactionStateCompleted,
+		TransactionStateCompleted + ">" + TransactionStateConfirmed,
+		TransactionStateConfirmed + ">" + TransactionStateTerminated,
+	}, states)
+	require.GreaterOrEqual(t, len(codes), 3)
+	assert.Equal(t, StatusTrying, codes[0])
+	for _, code := range codes[1:] {
+		assert.Equal(t, StatusBusyHere, code, "final response and retransmissions")
+	}
+}
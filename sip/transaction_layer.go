@@ -29,6 +29,25 @@ type TransactionLayer struct {
 
 	terminateOnConnClose bool
 
+	useWorkerPool   bool
+	workers         int
+	workerQueueSize int
+	workerKey       TransactionDispatchKey
+	workerPool      *txWorkerPool
+	overloadHandler func(msg Message)
+	metrics         Metrics
+	spanTracer      SpanTracer
+	spanHeader      string
+
+	// timers are used instead of package timers when set
+	timers *Timers
+	clock  Clock
+	rtt    *RTTEstimator
+
+	eventHandler   TransactionEventHandler
+	eventQueueSize int
+	events         *txEvents
+
 	log *slog.Logger
 }
 
@@ -59,6 +78,101 @@ func WithTransactionLayerTerminateOnConnClose() TransactionLayerOption {
 	}
 }
 
+// WithTransactionLayerWorkerPool replaces goroutine per message with fixed number of workers.
+// Each worker has queue of queueSize, and messages are distributed by key so that order per call
+// or transaction is kept. When queue is full, datagram is passed to overload handler instead,
+// while stream (reliable) transports wait for free place as their messages are never retransmitted.
+// Workers <= 0 defaults to GOMAXPROCS.
+//
+// Workers only match and process transactions. Request and unhandled response handlers
+// are called on own goroutine, so handler can block (waiting ACK, responses of new requests).
+// Responses of client transactions are queued per transaction, so caller not reading them does not block worker.
+//
+// Experimental
+func WithTransactionLayerWorkerPool(workers int, queueSize int, key TransactionDispatchKey) TransactionLayerOption {
+	return func(txl *TransactionLayer) {
+		txl.workers = workers
+		txl.workerQueueSize = queueSize
+		txl.workerKey = key
+		txl.useWorkerPool = true
+	}
+}
+
+// WithTransactionLayerOverloadHandler is called with message that could not be queued by worker pool.
+// It is called on transport read goroutine and it must not block. It is called only for
+// datagram transports.
+// For ex. requests can be answered with stateless 503 and Retry-After.
+// Default drops message, which for UDP means peer will retransmit.
+func WithTransactionLayerOverloadHandler(f func(msg Message)) TransactionLayerOption {
+	return func(txl *TransactionLayer) {
+		txl.overloadHandler = f
+	}
+}
+
+// WithTransactionLayerMetrics reports started and terminated transactions,
+// retransmissions and timeouts to m.
+func WithTransactionLayerMetrics(m Metrics) TransactionLayerOption {
+	return func(txl *TransactionLayer) {
+		txl.metrics = m
+	}
+}
+
+// WithTransactionLayerTimers sets SIP timers for all transactions of this layer instead of package timers.
+// Client transaction timers can be overridden per request with ContextWithTimers.
+func WithTransactionLayerTimers(t Timers) TransactionLayerOption {
+	return func(txl *TransactionLayer) {
+		txl.timers = &t
+	}
+}
+
+// WithTransactionLayerClock sets clock used by transaction timers and dialogs. Default is SystemClock.
+// Fake clock allows testing retransmissions and timeouts by moving time forward, see siptest.FakeClock
+func WithTransactionLayerClock(c Clock) TransactionLayerOption {
+	return func(txl *TransactionLayer) {
+		txl.clock = c
+	}
+}
+
+// WithTransactionLayerRTTEstimator enables adaptive T1 per destination.
+// Client transactions over unreliable transports measure round-trip time to first response,
+// and Timer A and Timer E of next transactions to same destination are based on estimate.
+// Other timers like Timer B and F stay as configured. Estimates can be read with RTTEstimator().Estimates()
+//
+// Experimental
+func WithTransactionLayerRTTEstimator(e *RTTEstimator) TransactionLayerOption {
+	return func(txl *TransactionLayer) {
+		txl.rtt = e
+	}
+}
+
+// WithTransactionLayerEventHandler passes lifecycle events of all client and server transactions to h:
+// created, state changed, retransmission, response received or sent and terminated.
+// Events are queued with queueSize (<= 0 is 1024) and h is called on single goroutine, so transactions are never blocked.
+// When queue is full events are dropped, see TransactionEventsDropped.
+//
+// Experimental
+func WithTransactionLayerEventHandler(h TransactionEventHandler, queueSize int) TransactionLayerOption {
+	return func(txl *TransactionLayer) {
+		txl.eventHandler = h
+		txl.eventQueueSize = queueSize
+	}
+}
+
+// WithTransactionLayerSpanTracer opens span for every client and server transaction.
+// Trace context is injected in requests and extracted from requests with header. Empty header is DefaultSpanHeader.
+// Span of transaction can be read with TraceContext.
+//
+// Experimental
+func WithTransactionLayerSpanTracer(t SpanTracer, header string) TransactionLayerOption {
+	return func(txl *TransactionLayer) {
+		if header == "" {
+			header = DefaultSpanHeader
+		}
+		txl.spanTracer = t
+		txl.spanHeader = header
+	}
+}
+
 func NewTransactionLayer(tpl *TransportLayer, options ...TransactionLayerOption) *TransactionLayer {
 	txl := &TransactionLayer{
 		tpl:                tpl,
@@ -67,6 +181,7 @@ func NewTransactionLayer(tpl *TransportLayer, options ...TransactionLayerOption)
 
 		reqHandler:    defaultRequestHandler,
 		unRespHandler: defaultUnhandledRespHandler,
+		clock:         SystemClock{},
 	}
 	txl.log = DefaultLogger().With("caller", "TransactionLayer")
 
@@ -74,6 +189,14 @@ func NewTransactionLayer(tpl *TransportLayer, options ...TransactionLayerOption)
 		o(txl)
 	}
 
+	if txl.eventHandler != nil {
+		txl.events = newTxEvents(txl.eventHandler, txl.eventQueueSize)
+	}
+
+	if txl.useWorkerPool {
+		txl.workerPool = newTxWorkerPool(txl.workers, txl.workerQueueSize, txl.workerKey, txl.handleMessageSync)
+	}
+
 	//Send all transport messages to our transaction layer
 	tpl.OnMessage(txl.handleMessage)
 
@@ -90,6 +213,9 @@ func NewTransactionLayer(tpl *TransportLayer, options ...TransactionLayerOption)
 	if tpl.wss != nil {
 		tpl.wss.onConnClose = notify
 	}
+	if tpl.unix != nil {
+		tpl.unix.onConnClose = notify
+	}
 
 	return txl
 }
@@ -99,7 +225,8 @@ func (txl *TransactionLayer) OnRequest(h TransactionRequestHandler) {
 }
 
 // OnConnectionClose is called when a reliable transport connection (TCP, TLS,
-// WS, WSS) is closed by the remote side or due to a read error.
+// WS, WSS, UNIX) is closed by the remote side or due to a read error.
+// For WS, WSS this includes ping timeout.
 func (txl *TransactionLayer) OnConnectionClose(conn Connection) {
 	if txl.terminateOnConnClose {
 		txl.terminateClientTransactions(conn)
@@ -108,25 +235,17 @@ func (txl *TransactionLayer) OnConnectionClose(conn Connection) {
 }
 
 func (txl *TransactionLayer) terminateClientTransactions(conn Connection) {
-	txl.clientTransactions.mu.RLock()
-	for _, tx := range txl.clientTransactions.items {
-		if tx.conn == conn {
-			go tx.spinFsmWithError(client_input_transport_err,
-				fmt.Errorf("connection closed: %w", ErrTransactionTransport))
-		}
+	for _, tx := range txl.clientTransactions.byConnection(conn) {
+		go tx.spinFsmWithError(client_input_transport_err,
+			fmt.Errorf("connection closed: %w", ErrTransactionTransport))
 	}
-	txl.clientTransactions.mu.RUnlock()
 }
 
 func (txl *TransactionLayer) terminateServerTransactions(conn Connection) {
-	txl.serverTransactions.mu.RLock()
-	for _, tx := range txl.serverTransactions.items {
-		if tx.conn == conn {
-			go tx.spinFsmWithError(server_input_transport_err,
-				fmt.Errorf("connection closed: %w", ErrTransactionTransport))
-		}
+	for _, tx := range txl.serverTransactions.byConnection(conn) {
+		go tx.spinFsmWithError(server_input_transport_err,
+			fmt.Errorf("connection closed: %w", ErrTransactionTransport))
 	}
-	txl.serverTransactions.mu.RUnlock()
 }
 
 // handleMessage is entry for handling requests and responses from transport
@@ -134,6 +253,16 @@ func (txl *TransactionLayer) handleMessage(msg Message) {
 	// Having concurency here we increased throghput but also solving deadlock
 	// Current client transactions are blocking on passUp and this may block when calling tx.Receive
 	// forking here can remove this
+	if txl.workerPool != nil {
+		if txl.tpl.IsReliable(msg.Transport()) {
+			txl.workerPool.dispatchWait(msg)
+			return
+		}
+		if !txl.workerPool.dispatch(msg) {
+			txl.overload(msg)
+		}
+		return
+	}
 
 	switch msg := msg.(type) {
 	case *Request:
@@ -145,6 +274,34 @@ func (txl *TransactionLayer) handleMessage(msg Message) {
 	}
 }
 
+// handleMessageSync is handling message on worker
+func (txl *TransactionLayer) handleMessageSync(msg Message) {
+	switch msg := msg.(type) {
+	case *Request:
+		txl.handleRequestBackground(msg)
+	case *Response:
+		txl.handleResponseBackground(msg)
+	default:
+		txl.log.Error("unsupported message, skip it")
+	}
+}
+
+func (txl *TransactionLayer) overload(msg Message) {
+	if txl.overloadHandler != nil {
+		txl.overloadHandler(msg)
+		return
+	}
+	txl.log.Warn("Worker queue full, message dropped", "src", msg.Source())
+}
+
+// WorkerPoolStats returns worker pool counters. Zero stats are returned if worker pool is not used
+func (txl *TransactionLayer) WorkerPoolStats() TransactionWorkerPoolStats {
+	if txl.workerPool == nil {
+		return TransactionWorkerPoolStats{}
+	}
+	return txl.workerPool.stats()
+}
+
 func (txl *TransactionLayer) handleRequestBackground(req *Request) {
 	if err := txl.handleRequest(req); err != nil {
 		txl.log.Error("Server tx failed to handle request", "error", err, "req", req.StartLine())
@@ -226,28 +383,34 @@ func (txl *TransactionLayer) rejectMalformedRequest(req *Request, reason error)
 }
 
 func (txl *TransactionLayer) serverTxRequest(req *Request, key string) error {
-	txl.serverTransactions.lock()
-	tx, exists := txl.serverTransactions.items[key]
+	tx, exists, err := txl.serverTransactions.loadOrCreate(key, func() (*ServerTx, error) {
+		tx, err := txl.serverTxCreate(req, key)
+		if err != nil {
+			return nil, err
+		}
+		tx.OnTerminate(txl.serverTxTerminate)
+		return tx, nil
+	})
+	if err != nil {
+		return err
+	}
 	if exists {
-		txl.serverTransactions.unlock()
 		if err := tx.Receive(req); err != nil {
 			return fmt.Errorf("failed to receive req: %w", err)
 		}
 		return nil
 	}
 
-	tx, err := txl.serverTxCreate(req, key)
-	if err != nil {
-		txl.serverTransactions.unlock()
-		return err
-	}
-
-	// put tx to store
-	txl.serverTransactions.items[key] = tx
-	tx.OnTerminate(txl.serverTxTerminate)
-	txl.serverTransactions.unlock()
+	txl.metricsTxStarted(&tx.baseTx, TransactionKindServer)
+	txl.spanTxStarted(&tx.baseTx)
+	txl.eventsTxStarted(&tx.baseTx)
 
 	// pass request and transaction to handler
+	if txl.workerPool != nil {
+		// Handler must not block worker
+		go txl.reqHandler(req, tx)
+		return nil
+	}
 	txl.reqHandler(req, tx)
 	return nil
 }
@@ -263,6 +426,15 @@ func (txl *TransactionLayer) serverTxCreate(req *Request, key string) (*ServerTx
 	}
 
 	tx := NewServerTx(key, req, conn, txl.log)
+	tx.reliable = txl.tpl.IsReliable(req.Transport())
+	tx.metrics = txl.metrics
+	tx.timers = txl.Timers()
+	tx.clock = txl.clock
+	tx.events = txl.events
+	tx.event(TransactionEvent{Type: TransactionEventCreated})
+	if txl.spanTracer != nil {
+		tx.span = startTxSpan(context.Background(), txl.spanTracer, txl.spanHeader, TransactionKindServer, req, key)
+	}
 	if err := tx.Init(); err != nil {
 		// Init failed: this tx never reaches delete(), so release the connection
 		// reference serverRequestConnection took here (mirrors the conn.TryClose
@@ -270,6 +442,12 @@ func (txl *TransactionLayer) serverTxCreate(req *Request, key string) (*ServerTx
 		if conn != nil {
 			conn.TryClose()
 		}
+		if tx.span != nil {
+			tx.span.span.End(err)
+		}
+		if tx.events != nil {
+			tx.terminated(err)
+		}
 		return tx, err
 	}
 	return tx, nil
@@ -291,6 +469,10 @@ func (txl *TransactionLayer) handleResponse(res *Response) error {
 	if !exists {
 		// RFC 3261 - 17.1.1.2.
 		// Not matched responses should be passed directly to the UA
+		if txl.workerPool != nil {
+			go txl.unRespHandler(res)
+			return nil
+		}
 		txl.unRespHandler(res)
 		return nil
 	}
@@ -335,21 +517,55 @@ func (txl *TransactionLayer) clientTxRequest(ctx context.Context, req *Request,
 		return nil, fmt.Errorf("client transcation failed to request connection: %w", err)
 	}
 
-	txl.clientTransactions.lock()
-	tx, exists := txl.clientTransactions.items[key]
+	var span *txSpan
+	if txl.spanTracer != nil {
+		span = startTxSpan(ctx, txl.spanTracer, txl.spanHeader, TransactionKindClient, req, key)
+	}
+
+	tx, exists, _ := txl.clientTransactions.loadOrCreate(key, func() (*ClientTx, error) {
+		tx := txl.clientTxCreate(ctx, req, key, conn)
+		tx.span = span
+		tx.OnTerminate(txl.clientTxTerminate)
+		return tx, nil
+	})
 	if exists {
-		txl.clientTransactions.unlock()
 		conn.TryClose()
-		return nil, fmt.Errorf("client transaction %q already exists", key)
+		err := fmt.Errorf("client transaction %q already exists", key)
+		if span != nil {
+			span.span.End(err)
+		}
+		return nil, err
 	}
-	tx = NewClientTx(key, req, conn, txl.log)
-
-	txl.clientTransactions.items[key] = tx
-	tx.OnTerminate(txl.clientTxTerminate)
-	txl.clientTransactions.unlock()
+	txl.metricsTxStarted(&tx.baseTx, TransactionKindClient)
+	txl.spanTxStarted(&tx.baseTx)
+	txl.eventsTxStarted(&tx.baseTx)
 	return tx, nil
 }
 
+func (txl *TransactionLayer) clientTxCreate(ctx context.Context, req *Request, key string, conn Connection) *ClientTx {
+	tx := NewClientTx(key, req, conn, txl.log)
+	tx.reliable = txl.tpl.IsReliable(req.Transport())
+	tx.metrics = txl.metrics
+	tx.clock = txl.clock
+	tx.events = txl.events
+	// Worker must not wait for caller reading responses
+	tx.passUpQueued = txl.workerPool != nil
+	tx.event(TransactionEvent{Type: TransactionEventCreated})
+	if t, ok := timersFromContext(ctx); ok {
+		tx.timers = t
+	} else {
+		tx.timers = txl.Timers()
+		if txl.rtt != nil && !tx.reliable {
+			tx.rtt = txl.rtt
+			if t1, ok := txl.rtt.T1(req.raddr.String()); ok {
+				tx.timers.A = t1
+				tx.timers.E = t1
+			}
+		}
+	}
+	return tx
+}
+
 func (txl *TransactionLayer) Respond(res *Response) (*ServerTx, error) {
 	key, err := ServerTxKeyMake(res)
 	if err != nil {
@@ -381,6 +597,49 @@ func (txl *TransactionLayer) serverTxTerminate(key string, err error) {
 	}
 }
 
+// metricsTxStarted reports started transaction and its termination
+func (txl *TransactionLayer) metricsTxStarted(tx *baseTx, kind TransactionKind) {
+	m := txl.metrics
+	if m == nil {
+		return
+	}
+	method := tx.origin.Method
+	m.TransactionStarted(kind, method)
+	if !tx.OnTerminate(func(key string, err error) {
+		m.TransactionTerminated(kind, method, TransactionCause(err))
+	}) {
+		// Terminated already
+		m.TransactionTerminated(kind, method, TransactionCauseTerminated)
+	}
+}
+
+// spanTxStarted ends transaction span on termination
+func (txl *TransactionLayer) spanTxStarted(tx *baseTx) {
+	span := tx.span
+	if span == nil {
+		return
+	}
+	if !tx.OnTerminate(func(key string, err error) {
+		span.end(err)
+	}) {
+		// Terminated already
+		span.end(ErrTransactionTerminated)
+	}
+}
+
+// eventsTxStarted emits termination of transaction
+func (txl *TransactionLayer) eventsTxStarted(tx *baseTx) {
+	if tx.events == nil {
+		return
+	}
+	if !tx.OnTerminate(func(key string, err error) {
+		tx.terminated(err)
+	}) {
+		// Terminated already
+		tx.terminated(ErrTransactionTerminated)
+	}
+}
+
 // RFC 17.1.3.
 func (txl *TransactionLayer) getClientTx(key string) (*ClientTx, bool) {
 	return txl.clientTransactions.get(key)
@@ -401,9 +660,46 @@ func (txl *TransactionLayer) getServerTx(key string) (*ServerTx, bool) {
 	// return tx.(*ServerTx), true
 }
 
+// Timers returns timers of this layer or package timers if layer has none
+func (txl *TransactionLayer) Timers() Timers {
+	if txl.timers != nil {
+		return *txl.timers
+	}
+	return GlobalTimers()
+}
+
+// RTTEstimator returns estimator set with WithTransactionLayerRTTEstimator or nil
+func (txl *TransactionLayer) RTTEstimator() *RTTEstimator {
+	return txl.rtt
+}
+
+// Clock returns clock used by transaction timers
+func (txl *TransactionLayer) Clock() Clock {
+	return txl.clock
+}
+
+// TransactionEventsDropped returns number of transaction events dropped due to full queue
+func (txl *TransactionLayer) TransactionEventsDropped() uint64 {
+	if txl.events == nil {
+		return 0
+	}
+	return txl.events.dropped.Load()
+}
+
+// ActiveTransactions returns number of client and server transactions not yet terminated
+func (txl *TransactionLayer) ActiveTransactions() (client int, server int) {
+	return txl.clientTransactions.len(), txl.serverTransactions.len()
+}
+
 func (txl *TransactionLayer) Close() {
+	if txl.workerPool != nil {
+		txl.workerPool.close()
+	}
 	txl.clientTransactions.terminateAll()
 	txl.serverTransactions.terminateAll()
+	if txl.events != nil {
+		txl.events.close()
+	}
 	txl.log.Debug("transaction layer closed")
 }
 
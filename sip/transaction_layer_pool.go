@@ -0,0 +1,141 @@
+package sip
+
+import (
+	"hash/fnv"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// TransactionDispatchKey selects how messages are distributed to workers.
+// Messages with same key are always handled by same worker, in order they are received.
+type TransactionDispatchKey int
+
+const (
+	// TransactionDispatchCallID keeps order of all messages within call
+	TransactionDispatchCallID TransactionDispatchKey = iota
+	// TransactionDispatchBranch keeps order within transaction (top Via branch). CANCEL has same branch as INVITE
+	TransactionDispatchBranch
+)
+
+// TransactionWorkerPoolStats are counters of transaction layer worker pool
+type TransactionWorkerPoolStats struct {
+	// Queued is number of messages currently waiting in queues
+	Queued int
+	// Dispatched is number of messages accepted by workers
+	Dispatched uint64
+	// Overloaded is number of messages rejected due to full queue
+	Overloaded uint64
+}
+
+type txWorkerPool struct {
+	queues []chan Message
+	key    TransactionDispatchKey
+	handle func(msg Message)
+
+	done      chan struct{}
+	closeOnce sync.Once
+
+	dispatched atomic.Uint64
+	overloaded atomic.Uint64
+}
+
+func newTxWorkerPool(workers int, queueSize int, key TransactionDispatchKey, handle func(msg Message)) *txWorkerPool {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if queueSize <= 0 {
+		queueSize = 1024
+	}
+
+	p := &txWorkerPool{
+		queues: make([]chan Message, workers),
+		key:    key,
+		handle: handle,
+		done:   make(chan struct{}),
+	}
+	for i := range p.queues {
+		p.queues[i] = make(chan Message, queueSize)
+		go p.worker(p.queues[i])
+	}
+	return p
+}
+
+func (p *txWorkerPool) worker(queue chan Message) {
+	for {
+		select {
+		case <-p.done:
+			return
+		case msg := <-queue:
+			p.handle(msg)
+		}
+	}
+}
+
+// dispatch queues message without blocking. Returns false if worker queue is full
+func (p *txWorkerPool) dispatch(msg Message) bool {
+	queue := p.queues[p.shard(msg)]
+	select {
+	case <-p.done:
+		// Layer is closed, nothing to process
+		return true
+	case queue <- msg:
+		p.dispatched.Add(1)
+		return true
+	default:
+		p.overloaded.Add(1)
+		return false
+	}
+}
+
+// dispatchWait queues message and waits for free place in worker queue.
+// Used for stream transports where dropped message is never retransmitted,
+// so waiting pushes back on connection reader instead.
+func (p *txWorkerPool) dispatchWait(msg Message) {
+	queue := p.queues[p.shard(msg)]
+	select {
+	case <-p.done:
+	case queue <- msg:
+		p.dispatched.Add(1)
+	}
+}
+
+func (p *txWorkerPool) shard(msg Message) int {
+	if len(p.queues) == 1 {
+		return 0
+	}
+
+	var key string
+	switch p.key {
+	case TransactionDispatchBranch:
+		if via := msg.Via(); via != nil && via.Params != nil {
+			key, _ = via.Params.Get("branch")
+		}
+	default:
+		if callid := msg.CallID(); callid != nil {
+			key = callid.Value()
+		}
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(len(p.queues)))
+}
+
+func (p *txWorkerPool) stats() TransactionWorkerPoolStats {
+	queued := 0
+	for _, q := range p.queues {
+		queued += len(q)
+	}
+	return TransactionWorkerPoolStats{
+		Queued:     queued,
+		Dispatched: p.dispatched.Load(),
+		Overloaded: p.overloaded.Load(),
+	}
+}
+
+func (p *txWorkerPool) close() {
+	p.closeOnce.Do(func() {
+		close(p.done)
+	})
+}
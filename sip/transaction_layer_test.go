@@ -63,13 +63,13 @@ func TestIntegrationTransactionLayerServerTx(t *testing.T) {
 
 	wg.Wait()
 	require.EqualValues(t, 1, atomic.LoadInt32(&count))
-	require.EqualValues(t, 1, len(txl.serverTransactions.items))
+	require.EqualValues(t, 1, txl.serverTransactions.len())
 
 	// After termination of transaction, it  must be removed from list
-	tx := txl.serverTransactions.items[key]
+	tx, _ := txl.serverTransactions.get(key)
 	require.NotNil(t, tx)
 	tx.Terminate()
-	require.EqualValues(t, 0, len(txl.serverTransactions.items))
+	require.EqualValues(t, 0, txl.serverTransactions.len())
 }
 
 func TestTransactionLayerMalformedRequestStateless400(t *testing.T) {
@@ -176,6 +176,282 @@ func TestTransactionLayerClientTx(t *testing.T) {
 	wg.Wait()
 	// Only one transaction will be created and executed
 	require.EqualValues(t, 1, atomic.LoadInt32(&count))
-	require.Equal(t, 2, tp.udp.pool.Size())
+	// Same connection is stored under local and remote address
+	require.Equal(t, 1, tp.udp.pool.Size())
 	assert.True(t, tp.udp.pool.Get("127.0.0.1:9876") != nil)
 }
+
+func TestTransactionLayerWorkerPool(t *testing.T) {
+	tp := NewTransportLayer(net.DefaultResolver, NewParser(), nil)
+	defer tp.Close()
+
+	handled := make(chan string, 10)
+	overloaded := make(chan Message, 10)
+	txl := NewTransactionLayer(tp,
+		WithTransactionLayerWorkerPool(1, 1, TransactionDispatchCallID),
+		WithTransactionLayerOverloadHandler(func(msg Message) {
+			overloaded <- msg
+		}),
+		WithTransactionLayerUnhandledResponseHandler(func(r *Response) {
+			handled <- r.Reason
+		}),
+	)
+	defer txl.Close()
+
+	// Block worker so that queue fills
+	block := make(chan struct{})
+	txl.workerPool.close()
+	txl.workerPool = newTxWorkerPool(1, 1, TransactionDispatchCallID, func(msg Message) {
+		<-block
+		txl.handleMessageSync(msg)
+	})
+
+	req := testCreateRequest(t, "OPTIONS", "sip:bob@127.0.0.1", "UDP", "127.0.0.1:5090")
+	newResponse := func(reason string) *Response {
+		res := NewResponseFromRequest(req, StatusOK, reason, nil)
+		res.SetTransport("UDP")
+		return res
+	}
+
+	// First is picked by worker and blocks, second waits in queue, third is overload
+	txl.handleMessage(newResponse("first"))
+	require.Eventually(t, func() bool {
+		return txl.WorkerPoolStats().Queued == 0
+	}, time.Second, time.Millisecond)
+	txl.handleMessage(newResponse("second"))
+	txl.handleMessage(newResponse("third"))
+
+	select {
+	case msg := <-overloaded:
+		assert.Equal(t, "third", msg.(*Response).Reason)
+	case <-time.After(time.Second):
+		t.Fatal("expected overload")
+	}
+
+	// Stream message is never dropped, it waits for worker
+	streamQueued := make(chan struct{})
+	go func() {
+		res := newResponse("stream")
+		res.SetTransport("TCP")
+		txl.handleMessage(res)
+		close(streamQueued)
+	}()
+	select {
+	case <-streamQueued:
+		t.Fatal("stream message must wait for free worker queue")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(block)
+	<-streamQueued
+	got := []string{<-handled, <-handled, <-handled}
+	assert.ElementsMatch(t, []string{"first", "second", "stream"}, got)
+
+	stats := txl.WorkerPoolStats()
+	assert.Equal(t, uint64(3), stats.Dispatched)
+	assert.Equal(t, uint64(1), stats.Overloaded)
+	assert.Len(t, overloaded, 0)
+}
+
+func TestTransactionLayerWorkerPoolResponseNotRead(t *testing.T) {
+	// Peer responds 200 OK on every request
+	peer, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer peer.Close()
+	responded := make(chan struct{}, 10)
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, raddr, err := peer.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			msg, err := ParseMessage(buf[:n])
+			if err != nil {
+				continue
+			}
+			res := NewResponseFromRequest(msg.(*Request), StatusOK, "OK", nil)
+			peer.WriteTo([]byte(res.String()), raddr)
+			responded <- struct{}{}
+		}
+	}()
+
+	tp := NewTransportLayer(net.DefaultResolver, NewParser(), nil)
+	defer tp.Close()
+	// Single worker, so both transactions are on same shard
+	txl := NewTransactionLayer(tp, WithTransactionLayerWorkerPool(1, 10, TransactionDispatchCallID))
+	defer txl.Close()
+
+	request := func() *ClientTx {
+		req := testCreateRequest(t, "OPTIONS", "sip:bob@"+peer.LocalAddr().String(), "UDP", "127.0.0.1:0")
+		req.CSeq().MethodName = OPTIONS
+		tx, err := txl.Request(context.Background(), req)
+		require.NoError(t, err)
+		return tx
+	}
+
+	// Caller never reads responses of first transaction
+	tx1 := request()
+	defer tx1.Terminate()
+	<-responded
+	time.Sleep(50 * time.Millisecond)
+
+	tx2 := request()
+	defer tx2.Terminate()
+	select {
+	case res := <-tx2.Responses():
+		assert.Equal(t, StatusOK, res.StatusCode)
+	case <-time.After(2 * time.Second):
+		t.Fatal("response blocked by transaction not reading responses")
+	}
+
+	// Response of first is still delivered once read
+	select {
+	case res := <-tx1.Responses():
+		assert.Equal(t, StatusOK, res.StatusCode)
+	case <-time.After(time.Second):
+		t.Fatal("no response on first transaction")
+	}
+}
+
+func TestTransactionLayerWorkerPoolHandlerWaitsAck(t *testing.T) {
+	tp := NewTransportLayer(net.DefaultResolver, NewParser(), nil)
+	defer tp.Close()
+
+	// Single worker. Handler waiting ACK would block it if called on worker
+	txl := NewTransactionLayer(tp, WithTransactionLayerWorkerPool(1, 10, TransactionDispatchCallID))
+	defer txl.Close()
+
+	acked := make(chan *Request, 1)
+	txl.OnRequest(func(req *Request, tx *ServerTx) {
+		if err := tx.Respond(NewResponseFromRequest(req, StatusBusyHere, "Busy Here", nil)); err != nil {
+			t.Error(err)
+			return
+		}
+		select {
+		case ack := <-tx.Acks():
+			acked <- ack
+		case <-tx.Done():
+		}
+	})
+
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go tp.ServeUDP(l)
+
+	client, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer client.Close()
+
+	invite, _, _ := testCreateInvite(t, "sip:bob@"+l.LocalAddr().String(), "UDP", client.LocalAddr().String())
+	_, err = client.WriteTo([]byte(invite.String()), l.LocalAddr())
+	require.NoError(t, err)
+
+	buf := make([]byte, 2048)
+	client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var res *Response
+	for res == nil || res.IsProvisional() {
+		n, _, err := client.ReadFrom(buf)
+		require.NoError(t, err)
+		msg, err := ParseMessage(buf[:n])
+		require.NoError(t, err)
+		res = msg.(*Response)
+	}
+	require.Equal(t, StatusBusyHere, res.StatusCode)
+
+	ack := newAckRequestNon2xx(invite, res, nil)
+	_, err = client.WriteTo([]byte(ack.String()), l.LocalAddr())
+	require.NoError(t, err)
+
+	select {
+	case ack := <-acked:
+		assert.True(t, ack.IsAck())
+	case <-time.After(2 * time.Second):
+		t.Fatal("handler did not receive ACK")
+	}
+}
+
+func TestTransactionWorkerPoolOrder(t *testing.T) {
+	var mu sync.Mutex
+	got := map[string][]int{}
+	var wg sync.WaitGroup
+
+	p := newTxWorkerPool(4, 100, TransactionDispatchCallID, func(msg Message) {
+		defer wg.Done()
+		res := msg.(*Response)
+		mu.Lock()
+		got[res.CallID().Value()] = append(got[res.CallID().Value()], res.StatusCode)
+		mu.Unlock()
+	})
+	defer p.close()
+
+	calls := []*Request{}
+	for i := 0; i < 8; i++ {
+		calls = append(calls, testCreateRequest(t, "INVITE", "sip:bob@127.0.0.1", "UDP", "127.0.0.1:5090"))
+		callid := CallIDHeader("call-" + string(rune('a'+i)))
+		calls[i].ReplaceHeader(&callid)
+	}
+
+	for code := 100; code < 150; code++ {
+		for _, req := range calls {
+			wg.Add(1)
+			require.True(t, p.dispatch(NewResponseFromRequest(req, code, "", nil)))
+		}
+	}
+	wg.Wait()
+
+	require.Len(t, got, len(calls))
+	for callid, codes := range got {
+		for i, code := range codes {
+			require.Equal(t, 100+i, code, callid)
+		}
+	}
+}
+
+func TestTransactionLayerTimers(t *testing.T) {
+	// Destination never responds
+	sink, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer sink.Close()
+
+	tp := NewTransportLayer(net.DefaultResolver, NewParser(), nil)
+	txl := NewTransactionLayer(tp, WithTransactionLayerTimers(NewTimers(10*time.Millisecond, 40*time.Millisecond, 50*time.Millisecond)))
+	defer tp.Close()
+	defer txl.Close()
+	assert.Equal(t, 10*time.Millisecond, txl.Timers().T1)
+
+	t.Run("Layer", func(t *testing.T) {
+		req := testCreateRequest(t, "OPTIONS", "sip:bob@"+sink.LocalAddr().String(), "UDP", "127.0.0.1:0")
+		req.CSeq().MethodName = OPTIONS
+		tx, err := txl.Request(context.Background(), req)
+		require.NoError(t, err)
+		assert.Equal(t, 640*time.Millisecond, tx.timers.B)
+
+		select {
+		case <-tx.Done():
+			assert.ErrorIs(t, tx.Err(), ErrTransactionTimeout)
+		case <-time.After(3 * time.Second):
+			t.Fatal("transaction did not time out with layer timers")
+		}
+	})
+
+	t.Run("PerRequest", func(t *testing.T) {
+		req := testCreateRequest(t, "OPTIONS", "sip:bob@"+sink.LocalAddr().String(), "UDP", "127.0.0.1:0")
+		req.CSeq().MethodName = OPTIONS
+		ctx := ContextWithTimers(context.Background(), NewTimers(time.Millisecond, 4*time.Millisecond, 5*time.Millisecond))
+		tx, err := txl.Request(ctx, req)
+		require.NoError(t, err)
+		defer tx.Terminate()
+		assert.Equal(t, time.Millisecond, tx.timers.T1)
+		assert.Equal(t, 64*time.Millisecond, tx.timers.B)
+	})
+}
+
+func TestNewTimers(t *testing.T) {
+	timers := NewTimers(500*time.Millisecond, 4*time.Second, 5*time.Second)
+	assert.Equal(t, 32*time.Second, timers.B)
+	assert.Equal(t, 32*time.Second, timers.F)
+	assert.Equal(t, 5*time.Second, timers.K)
+	assert.Equal(t, 32*time.Second, timers.D)
+	assert.Equal(t, 200*time.Millisecond, timers.Trying)
+}
@@ -0,0 +1,189 @@
+package sip
+
+import (
+	"sync"
+	"time"
+)
+
+// RTTEstimate is smoothed round-trip time of single destination, calculated same way as TCP RTO
+// https://datatracker.ietf.org/doc/html/rfc6298
+type RTTEstimate struct {
+	// SRTT is smoothed round-trip time
+	SRTT time.Duration
+	// RTTVar is round-trip time variation
+	RTTVar time.Duration
+	// T1 is value used for Timer A and Timer E. It is SRTT + 4*RTTVar within estimator bounds,
+	// and it is doubled when response is received only after retransmission
+	T1 time.Duration
+	// Samples is number of measured round-trip times
+	Samples int
+	// Updated is time of last sample
+	Updated time.Time
+}
+
+// RTTEstimator keeps round-trip time estimates per destination IP:port.
+// Client transactions over unreliable transports measure time from request to first response and
+// use estimated T1 of destination for Timer A and Timer E. Responses received after retransmission
+// are not measured as it is not known which request they answer (Karn's algorithm).
+//
+// Transactions timing out with Timer B or F back off destination as well.
+// Estimates without samples for TTL are expired and number of destinations is capped, see SetLimits.
+//
+// NOTE: for INVITE first response is usually 100 Trying, which may include peer delay before sending it.
+type RTTEstimator struct {
+	mu    sync.Mutex
+	min   time.Duration
+	max   time.Duration
+	dests map[string]*RTTEstimate
+
+	size      int
+	ttl       time.Duration
+	lastSweep time.Time
+}
+
+const (
+	rttEstimatorSize = 10000
+	rttEstimateTTL   = 10 * time.Minute
+)
+
+// NewRTTEstimator creates estimator with T1 bounded to [min, max].
+// Max should not be higher than T2, as T2 caps retransmission interval.
+func NewRTTEstimator(min, max time.Duration) *RTTEstimator {
+	return &RTTEstimator{
+		min:   min,
+		max:   max,
+		dests: make(map[string]*RTTEstimate),
+		size:  rttEstimatorSize,
+		ttl:   rttEstimateTTL,
+	}
+}
+
+// SetLimits sets max number of destinations and time after which estimate without new samples expires.
+// When full, oldest estimate is removed for new destination. Defaults are 10000 and 10 minutes
+func (e *RTTEstimator) SetLimits(size int, ttl time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.size = size
+	e.ttl = ttl
+}
+
+// Observe adds measured round-trip time to destination estimate
+func (e *RTTEstimator) Observe(dest string, rtt time.Duration, now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.sweep(now)
+	est, exists := e.dests[dest]
+	if !exists {
+		e.evict()
+		est = &RTTEstimate{
+			SRTT:   rtt,
+			RTTVar: rtt / 2,
+		}
+		e.dests[dest] = est
+	} else {
+		diff := est.SRTT - rtt
+		if diff < 0 {
+			diff = -diff
+		}
+		est.RTTVar = (3*est.RTTVar + diff) / 4
+		est.SRTT = (7*est.SRTT + rtt) / 8
+	}
+	est.Samples++
+	est.Updated = now
+	est.T1 = e.bound(est.SRTT + 4*est.RTTVar)
+}
+
+// Backoff doubles T1 of destination. It is called when response is received only after retransmission
+// or transaction timed out, so that too low estimate does not keep retransmissions going.
+func (e *RTTEstimator) Backoff(dest string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	est, exists := e.dests[dest]
+	if !exists {
+		return
+	}
+	est.T1 = e.bound(2 * est.T1)
+}
+
+// T1 returns estimated T1 for destination. It returns false if destination has no samples
+func (e *RTTEstimator) T1(dest string) (time.Duration, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	est, exists := e.dests[dest]
+	if !exists {
+		return 0, false
+	}
+	return est.T1, true
+}
+
+// Estimate returns estimate of destination
+func (e *RTTEstimator) Estimate(dest string) (RTTEstimate, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	est, exists := e.dests[dest]
+	if !exists {
+		return RTTEstimate{}, false
+	}
+	return *est, true
+}
+
+// Estimates returns copy of all destination estimates. Useful for monitoring
+func (e *RTTEstimator) Estimates() map[string]RTTEstimate {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	m := make(map[string]RTTEstimate, len(e.dests))
+	for dest, est := range e.dests {
+		m[dest] = *est
+	}
+	return m
+}
+
+// Forget removes destination estimate
+func (e *RTTEstimator) Forget(dest string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.dests, dest)
+}
+
+// sweep removes expired estimates. Must be called under lock
+func (e *RTTEstimator) sweep(now time.Time) {
+	if e.ttl <= 0 || now.Sub(e.lastSweep) < e.ttl {
+		return
+	}
+	e.lastSweep = now
+	for dest, est := range e.dests {
+		if now.Sub(est.Updated) >= e.ttl {
+			delete(e.dests, dest)
+		}
+	}
+}
+
+// evict removes oldest estimate when there is no room for new destination. Must be called under lock
+func (e *RTTEstimator) evict() {
+	if e.size <= 0 || len(e.dests) < e.size {
+		return
+	}
+	var oldest string
+	var oldestTime time.Time
+	for dest, est := range e.dests {
+		if oldest == "" || est.Updated.Before(oldestTime) {
+			oldest, oldestTime = dest, est.Updated
+		}
+	}
+	delete(e.dests, oldest)
+}
+
+func (e *RTTEstimator) bound(t1 time.Duration) time.Duration {
+	if t1 < e.min {
+		return e.min
+	}
+	if e.max > 0 && t1 > e.max {
+		return e.max
+	}
+	return t1
+}
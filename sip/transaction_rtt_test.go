@@ -0,0 +1,209 @@
+package sip
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRTTEstimator(t *testing.T) {
+	e := NewRTTEstimator(10*time.Millisecond, 2*time.Second)
+	now := time.Now()
+
+	_, ok := e.T1("10.0.0.1:5060")
+	assert.False(t, ok)
+
+	e.Observe("10.0.0.1:5060", 300*time.Millisecond, now)
+	est, ok := e.Estimate("10.0.0.1:5060")
+	require.True(t, ok)
+	assert.Equal(t, 300*time.Millisecond, est.SRTT)
+	assert.Equal(t, 150*time.Millisecond, est.RTTVar)
+	assert.Equal(t, 900*time.Millisecond, est.T1)
+	assert.Equal(t, 1, est.Samples)
+
+	e.Observe("10.0.0.1:5060", 100*time.Millisecond, now)
+	est, _ = e.Estimate("10.0.0.1:5060")
+	assert.Equal(t, 275*time.Millisecond, est.SRTT)
+	assert.Equal(t, 162500*time.Microsecond, est.RTTVar)
+	assert.Equal(t, 925*time.Millisecond, est.T1)
+
+	e.Backoff("10.0.0.1:5060")
+	t1, _ := e.T1("10.0.0.1:5060")
+	assert.Equal(t, 1850*time.Millisecond, t1)
+	e.Backoff("10.0.0.1:5060")
+	t1, _ = e.T1("10.0.0.1:5060")
+	assert.Equal(t, 2*time.Second, t1, "max bound")
+
+	e.Observe("192.168.0.1:5060", time.Millisecond, now)
+	t1, _ = e.T1("192.168.0.1:5060")
+	assert.Equal(t, 10*time.Millisecond, t1, "min bound")
+
+	assert.Len(t, e.Estimates(), 2)
+	e.Forget("192.168.0.1:5060")
+	assert.Len(t, e.Estimates(), 1)
+}
+
+func TestTransactionLayerRTTEstimator(t *testing.T) {
+	// Peer responds 200 OK on every request
+	peer, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer peer.Close()
+	go func() {
+		parser := NewParser()
+		buf := make([]byte, 65535)
+		for {
+			n, raddr, err := peer.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			msg, err := parser.ParseSIP(buf[:n])
+			if err != nil {
+				continue
+			}
+			res := NewResponseFromRequest(msg.(*Request), StatusOK, "OK", nil)
+			peer.WriteTo([]byte(res.String()), raddr)
+		}
+	}()
+
+	rtt := NewRTTEstimator(50*time.Millisecond, 4*time.Second)
+	// Not global timers, as other tests change them. Retransmission would skip measurement
+	timers := NewTimers(time.Second, 4*time.Second, 5*time.Second)
+	tp := NewTransportLayer(net.DefaultResolver, NewParser(), nil)
+	txl := NewTransactionLayer(tp, WithTransactionLayerRTTEstimator(rtt), WithTransactionLayerTimers(timers))
+	defer tp.Close()
+	defer txl.Close()
+	assert.Equal(t, rtt, txl.RTTEstimator())
+
+	request := func() *ClientTx {
+		req := testCreateRequest(t, "OPTIONS", "sip:bob@"+peer.LocalAddr().String(), "UDP", "127.0.0.1:0")
+		req.CSeq().MethodName = OPTIONS
+		tx, err := txl.Request(context.Background(), req)
+		require.NoError(t, err)
+
+		select {
+		case res := <-tx.Responses():
+			assert.Equal(t, StatusOK, res.StatusCode)
+		case <-time.After(3 * time.Second):
+			t.Fatal("no response")
+		}
+		tx.Terminate()
+		return tx
+	}
+
+	tx := request()
+	assert.Equal(t, timers.A, tx.timers.A, "no estimate yet")
+
+	est, ok := rtt.Estimate(peer.LocalAddr().String())
+	require.True(t, ok)
+	assert.Equal(t, 1, est.Samples)
+	assert.Equal(t, 50*time.Millisecond, est.T1)
+
+	tx = request()
+	assert.Equal(t, 50*time.Millisecond, tx.timers.A)
+	assert.Equal(t, 50*time.Millisecond, tx.timers.E)
+	assert.Equal(t, timers.B, tx.timers.B, "timeout is not changed")
+
+	est, _ = rtt.Estimate(peer.LocalAddr().String())
+	assert.Equal(t, 2, est.Samples)
+}
+
+func TestRTTEstimatorLimits(t *testing.T) {
+	e := NewRTTEstimator(10*time.Millisecond, 2*time.Second)
+	e.SetLimits(2, time.Minute)
+	now := time.Now()
+
+	e.Observe("10.0.0.1:5060", 100*time.Millisecond, now)
+	e.Observe("10.0.0.2:5060", 100*time.Millisecond, now.Add(time.Second))
+	e.Observe("10.0.0.3:5060", 100*time.Millisecond, now.Add(2*time.Second))
+	assert.Len(t, e.Estimates(), 2)
+	_, ok := e.Estimate("10.0.0.1:5060")
+	assert.False(t, ok, "oldest is evicted")
+
+	// Existing destination does not evict
+	e.Observe("10.0.0.2:5060", 100*time.Millisecond, now.Add(3*time.Second))
+	assert.Len(t, e.Estimates(), 2)
+
+	// Estimates without samples for TTL expire
+	e.Observe("10.0.0.2:5060", 100*time.Millisecond, now.Add(time.Minute+3*time.Second))
+	_, ok = e.Estimate("10.0.0.3:5060")
+	assert.False(t, ok)
+	_, ok = e.Estimate("10.0.0.2:5060")
+	assert.True(t, ok)
+}
+
+func TestTransactionLayerRTTEstimatorTimeout(t *testing.T) {
+	// Peer never responds
+	peer, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer peer.Close()
+
+	rtt := NewRTTEstimator(5*time.Millisecond, time.Second)
+	rtt.Observe(peer.LocalAddr().String(), 5*time.Millisecond, time.Now())
+	t1, _ := rtt.T1(peer.LocalAddr().String())
+
+	tp := NewTransportLayer(net.DefaultResolver, NewParser(), nil)
+	txl := NewTransactionLayer(tp,
+		WithTransactionLayerRTTEstimator(rtt),
+		WithTransactionLayerTimers(NewTimers(time.Millisecond, 4*time.Millisecond, 5*time.Millisecond)),
+	)
+	defer tp.Close()
+	defer txl.Close()
+
+	req := testCreateRequest(t, "OPTIONS", "sip:bob@"+peer.LocalAddr().String(), "UDP", "127.0.0.1:0")
+	req.CSeq().MethodName = OPTIONS
+	tx, err := txl.Request(context.Background(), req)
+	require.NoError(t, err)
+
+	select {
+	case <-tx.Done():
+		assert.ErrorIs(t, tx.Err(), ErrTransactionTimeout)
+	case <-time.After(3 * time.Second):
+		t.Fatal("transaction did not time out")
+	}
+
+	backoff, _ := rtt.T1(peer.LocalAddr().String())
+	assert.Equal(t, 2*t1, backoff)
+}
+
+// rttTestConn calls onWrite before write returns, like response arriving on loopback
+type rttTestConn struct {
+	onWrite func(msg Message)
+}
+
+func (c *rttTestConn) LocalAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5090}
+}
+func (c *rttTestConn) WriteMsg(msg Message) error {
+	c.onWrite(msg)
+	return nil
+}
+func (c *rttTestConn) Ref(i int) int          { return 1 }
+func (c *rttTestConn) TryClose() (int, error) { return 0, nil }
+func (c *rttTestConn) Close() error           { return nil }
+
+func TestClientTxRTTResponseBeforeWriteReturns(t *testing.T) {
+	rtt := NewRTTEstimator(time.Millisecond, time.Second)
+	req := testCreateRequest(t, "OPTIONS", "sip:bob@127.0.0.1:5060", "UDP", "127.0.0.1:5090")
+	req.CSeq().MethodName = OPTIONS
+	req.raddr = Addr{IP: net.IPv4(127, 0, 0, 1), Port: 5060}
+
+	conn := &rttTestConn{}
+	tx := NewClientTx("key", req, conn, slog.Default())
+	tx.rtt = rtt
+	conn.onWrite = func(msg Message) {
+		if msg == req {
+			tx.measureRTT()
+		}
+	}
+	require.NoError(t, tx.Init())
+	defer tx.Terminate()
+
+	est, ok := rtt.Estimate("127.0.0.1:5060")
+	require.True(t, ok, "response before write returned must be measured")
+	assert.Equal(t, 1, est.Samples)
+}
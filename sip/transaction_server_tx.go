@@ -11,18 +11,19 @@ type ServerTx struct {
 	acks chan *Request
 	// cancels chan *Request
 	onCancel     func(r *Request)
-	timer_g      *time.Timer
+	timer_g      ClockTimer
 	timer_g_time time.Duration
-	timer_h      *time.Timer
-	timer_i      *time.Timer
+	timer_h      ClockTimer
+	timer_i      ClockTimer
 	timer_i_time time.Duration
-	timer_j      *time.Timer
+	timer_j      ClockTimer
 	timer_j_time time.Duration
-	timer_1xx    *time.Timer
-	timer_l      *time.Timer
-	reliable     bool
+	timer_1xx    ClockTimer
+	timer_l      ClockTimer
 }
 
+// NewServerTx creates transaction. Reliability is derived from request transport with IsReliable.
+// TransactionLayer overrides it with TransportLayer.IsReliable, which also covers custom transports.
 func NewServerTx(key string, origin *Request, conn Connection, logger *slog.Logger) *ServerTx {
 	tx := new(ServerTx)
 	tx.key = key
@@ -33,6 +34,9 @@ func NewServerTx(key string, origin *Request, conn Connection, logger *slog.Logg
 	// tx.cancels = make(chan *Request)
 	tx.done = make(chan struct{})
 	tx.log = logger
+	tx.timers = GlobalTimers()
+	tx.clock = SystemClock{}
+	tx.kind = TransactionKindServer
 	tx.origin = origin // NOTE: user may do some changes on this request which creates RACE
 	tx.reliable = IsReliable(origin.Transport())
 	return tx
@@ -43,16 +47,16 @@ func (tx *ServerTx) Init() error {
 
 	tx.mu.Lock()
 	if !tx.reliable {
-		tx.timer_g_time = Timer_G
-		tx.timer_i_time = Timer_I
-		tx.timer_j_time = Timer_J
+		tx.timer_g_time = tx.timers.G
+		tx.timer_i_time = tx.timers.I
+		tx.timer_j_time = tx.timers.J
 	}
 	tx.mu.Unlock()
 
 	// RFC 3261 - 17.2.1
 	if tx.Origin().IsInvite() {
 		tx.mu.Lock()
-		tx.timer_1xx = time.AfterFunc(Timer_1xx, func() {
+		tx.timer_1xx = tx.clock.AfterFunc(tx.timers.Trying, func() {
 			trying := NewResponseFromRequest(
 				tx.Origin(),
 				100,
@@ -74,6 +78,15 @@ func (tx *ServerTx) Connection() Connection {
 	return tx.conn
 }
 
+// indexConnection returns connection for store index. Unreliable transports share connection
+// and never report it closed, so they are not indexed
+func (tx *ServerTx) indexConnection() Connection {
+	if !tx.reliable {
+		return nil
+	}
+	return tx.conn
+}
+
 // Receive is endpoint for handling received server requests.
 // NOTE: it could block while passing request to client,
 // therefore running in seperate goroutine is needed
@@ -89,6 +102,7 @@ func (tx *ServerTx) Receive(req *Request) error {
 	switch {
 	case req.Method == tx.origin.Method:
 		input = server_input_request
+		tx.retransmitted(TransactionKindServer)
 	case req.IsAck(): // ACK for non-2xx response
 		input = server_input_ack
 	case req.IsCancel():
@@ -122,6 +136,7 @@ func (tx *ServerTx) Respond(res *Response) error {
 	default:
 		input = server_input_user_300_plus
 	}
+	tx.responded(res)
 	tx.spinFsmWithResponse(input, res)
 	// In case of termination or some error
 	return tx.Err()
@@ -217,9 +232,9 @@ func (tx *ServerTx) registerOnCancel(f FnTxCancel) {
 // Choose the right FSM init function depending on request method.
 func (tx *ServerTx) initFSM() {
 	if tx.Origin().IsInvite() {
-		tx.baseTx.initFSM(tx.inviteStateProcceeding)
+		tx.baseTx.initFSM(tx.inviteStateProcceeding, TransactionStateProceeding)
 	} else {
-		tx.baseTx.initFSM(tx.stateTrying)
+		tx.baseTx.initFSM(tx.stateTrying, TransactionStateTrying)
 	}
 }
 
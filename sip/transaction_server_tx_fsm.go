@@ -1,9 +1,5 @@
 package sip
 
-import (
-	"time"
-)
-
 // TODO v2
 // Originally forked from https://github.com/ghettovoice/gosip by @ghetovoice
 // Better design could by passing some context through fsm state
@@ -14,18 +10,18 @@ func (tx *ServerTx) inviteStateProcceeding(s fsmInput) fsmInput {
 	var spinfn fsmState
 	switch s {
 	case server_input_request:
-		tx.fsmState, spinfn = tx.inviteStateProcceeding, tx.actRespond
+		tx.fsmState, tx.fsmStateName, spinfn = tx.inviteStateProcceeding, TransactionStateProceeding, tx.actRespond
 	case server_input_cancel:
-		tx.fsmState, spinfn = tx.inviteStateProcceeding, tx.actCancel
+		tx.fsmState, tx.fsmStateName, spinfn = tx.inviteStateProcceeding, TransactionStateProceeding, tx.actCancel
 	case server_input_user_1xx:
-		tx.fsmState, spinfn = tx.inviteStateProcceeding, tx.actRespond
+		tx.fsmState, tx.fsmStateName, spinfn = tx.inviteStateProcceeding, TransactionStateProceeding, tx.actRespond
 	case server_input_user_2xx:
 		// https://www.rfc-editor.org/rfc/rfc6026#section-7.1
-		tx.fsmState, spinfn = tx.inviteStateAccepted, tx.actRespondAccept
+		tx.fsmState, tx.fsmStateName, spinfn = tx.inviteStateAccepted, TransactionStateAccepted, tx.actRespondAccept
 	case server_input_user_300_plus:
-		tx.fsmState, spinfn = tx.inviteStateCompleted, tx.actRespondComplete
+		tx.fsmState, tx.fsmStateName, spinfn = tx.inviteStateCompleted, TransactionStateCompleted, tx.actRespondComplete
 	case server_input_transport_err:
-		tx.fsmState, spinfn = tx.inviteStateTerminated, tx.actTransErr
+		tx.fsmState, tx.fsmStateName, spinfn = tx.inviteStateTerminated, TransactionStateTerminated, tx.actTransErr
 	default:
 		return FsmInputNone
 	}
@@ -37,15 +33,15 @@ func (tx *ServerTx) inviteStateCompleted(s fsmInput) fsmInput {
 	var spinfn fsmState
 	switch s {
 	case server_input_request:
-		tx.fsmState, spinfn = tx.inviteStateCompleted, tx.actRespond
+		tx.fsmState, tx.fsmStateName, spinfn = tx.inviteStateCompleted, TransactionStateCompleted, tx.actRespond
 	case server_input_ack:
-		tx.fsmState, spinfn = tx.inviteStateConfirmed, tx.actConfirm
+		tx.fsmState, tx.fsmStateName, spinfn = tx.inviteStateConfirmed, TransactionStateConfirmed, tx.actConfirm
 	case server_input_timer_g:
-		tx.fsmState, spinfn = tx.inviteStateCompleted, tx.actRespondComplete
+		tx.fsmState, tx.fsmStateName, spinfn = tx.inviteStateCompleted, TransactionStateCompleted, tx.actRespondComplete
 	case server_input_timer_h:
-		tx.fsmState, spinfn = tx.inviteStateTerminated, tx.actDelete
+		tx.fsmState, tx.fsmStateName, spinfn = tx.inviteStateTerminated, TransactionStateTerminated, tx.actDelete
 	case server_input_transport_err:
-		tx.fsmState, spinfn = tx.inviteStateTerminated, tx.actTransErr
+		tx.fsmState, tx.fsmStateName, spinfn = tx.inviteStateTerminated, TransactionStateTerminated, tx.actTransErr
 	default:
 		// No changes
 		return FsmInputNone
@@ -58,7 +54,7 @@ func (tx *ServerTx) inviteStateConfirmed(s fsmInput) fsmInput {
 	var spinfn fsmState
 	switch s {
 	case server_input_timer_i:
-		tx.fsmState, spinfn = tx.inviteStateTerminated, tx.actDelete
+		tx.fsmState, tx.fsmStateName, spinfn = tx.inviteStateTerminated, TransactionStateTerminated, tx.actDelete
 	default:
 		// No changes
 		return FsmInputNone
@@ -71,15 +67,15 @@ func (tx *ServerTx) inviteStateAccepted(s fsmInput) fsmInput {
 	var spinfn fsmState
 	switch s {
 	case server_input_ack:
-		tx.fsmState, spinfn = tx.inviteStateAccepted, tx.actPassupAck
+		tx.fsmState, tx.fsmStateName, spinfn = tx.inviteStateAccepted, TransactionStateAccepted, tx.actPassupAck
 	case server_input_user_2xx:
 		// The server transaction MUST NOT generate 2xx retransmissions on its
 		// own.  Any retransmission of the 2xx response passed from the TU to
 		// the transaction while in the "Accepted" state MUST be passed to the
 		// transport layer for transmission.
-		tx.fsmState, spinfn = tx.inviteStateAccepted, tx.actRespond
+		tx.fsmState, tx.fsmStateName, spinfn = tx.inviteStateAccepted, TransactionStateAccepted, tx.actRespond
 	case server_input_timer_l:
-		tx.fsmState, spinfn = tx.inviteStateTerminated, tx.actDelete
+		tx.fsmState, tx.fsmStateName, spinfn = tx.inviteStateTerminated, TransactionStateTerminated, tx.actDelete
 	default:
 		return FsmInputNone
 	}
@@ -91,7 +87,7 @@ func (tx *ServerTx) inviteStateTerminated(s fsmInput) fsmInput {
 	// Terminated
 	switch s {
 	case server_input_delete:
-		tx.fsmState, spinfn = tx.inviteStateTerminated, tx.actDelete
+		tx.fsmState, tx.fsmStateName, spinfn = tx.inviteStateTerminated, TransactionStateTerminated, tx.actDelete
 	default:
 		// No changes
 		return FsmInputNone
@@ -103,13 +99,13 @@ func (tx *ServerTx) stateTrying(s fsmInput) fsmInput {
 	var spinfn fsmState
 	switch s {
 	case server_input_user_1xx:
-		tx.fsmState, spinfn = tx.stateProceeding, tx.actRespond
+		tx.fsmState, tx.fsmStateName, spinfn = tx.stateProceeding, TransactionStateProceeding, tx.actRespond
 	case server_input_user_2xx:
-		tx.fsmState, spinfn = tx.stateCompleted, tx.actFinal
+		tx.fsmState, tx.fsmStateName, spinfn = tx.stateCompleted, TransactionStateCompleted, tx.actFinal
 	case server_input_user_300_plus:
-		tx.fsmState, spinfn = tx.stateCompleted, tx.actFinal
+		tx.fsmState, tx.fsmStateName, spinfn = tx.stateCompleted, TransactionStateCompleted, tx.actFinal
 	case server_input_transport_err:
-		tx.fsmState, spinfn = tx.stateTerminated, tx.actTransErr
+		tx.fsmState, tx.fsmStateName, spinfn = tx.stateTerminated, TransactionStateTerminated, tx.actTransErr
 	default:
 		// No changes
 		return FsmInputNone
@@ -122,15 +118,15 @@ func (tx *ServerTx) stateProceeding(s fsmInput) fsmInput {
 	var spinfn fsmState
 	switch s {
 	case server_input_request:
-		tx.fsmState, spinfn = tx.stateProceeding, tx.actRespond
+		tx.fsmState, tx.fsmStateName, spinfn = tx.stateProceeding, TransactionStateProceeding, tx.actRespond
 	case server_input_user_1xx:
-		tx.fsmState, spinfn = tx.stateProceeding, tx.actRespond
+		tx.fsmState, tx.fsmStateName, spinfn = tx.stateProceeding, TransactionStateProceeding, tx.actRespond
 	case server_input_user_2xx:
-		tx.fsmState, spinfn = tx.stateCompleted, tx.actFinal
+		tx.fsmState, tx.fsmStateName, spinfn = tx.stateCompleted, TransactionStateCompleted, tx.actFinal
 	case server_input_user_300_plus:
-		tx.fsmState, spinfn = tx.stateCompleted, tx.actFinal
+		tx.fsmState, tx.fsmStateName, spinfn = tx.stateCompleted, TransactionStateCompleted, tx.actFinal
 	case server_input_transport_err:
-		tx.fsmState, spinfn = tx.stateTerminated, tx.actTransErr
+		tx.fsmState, tx.fsmStateName, spinfn = tx.stateTerminated, TransactionStateTerminated, tx.actTransErr
 	default:
 		// No changes
 		return FsmInputNone
@@ -143,11 +139,11 @@ func (tx *ServerTx) stateCompleted(s fsmInput) fsmInput {
 	var spinfn fsmState
 	switch s {
 	case server_input_request:
-		tx.fsmState, spinfn = tx.stateCompleted, tx.actRespond
+		tx.fsmState, tx.fsmStateName, spinfn = tx.stateCompleted, TransactionStateCompleted, tx.actRespond
 	case server_input_timer_j:
-		tx.fsmState, spinfn = tx.stateTerminated, tx.actDelete
+		tx.fsmState, tx.fsmStateName, spinfn = tx.stateTerminated, TransactionStateTerminated, tx.actDelete
 	case server_input_transport_err:
-		tx.fsmState, spinfn = tx.stateTerminated, tx.actTransErr
+		tx.fsmState, tx.fsmStateName, spinfn = tx.stateTerminated, TransactionStateTerminated, tx.actTransErr
 	default:
 		// No changes
 		return FsmInputNone
@@ -160,7 +156,7 @@ func (tx *ServerTx) stateTerminated(s fsmInput) fsmInput {
 	var spinfn fsmState
 	switch s {
 	case server_input_delete:
-		tx.fsmState, spinfn = tx.stateTerminated, tx.actDelete
+		tx.fsmState, tx.fsmStateName, spinfn = tx.stateTerminated, TransactionStateTerminated, tx.actDelete
 	default:
 		// No changes
 		return FsmInputNone
@@ -185,13 +181,14 @@ func (tx *ServerTx) actRespondComplete() fsmInput {
 		tx.mu.Lock()
 		if tx.timer_g == nil {
 
-			tx.timer_g = time.AfterFunc(tx.timer_g_time, func() {
+			tx.timer_g = tx.clock.AfterFunc(tx.timer_g_time, func() {
+				tx.retransmitted(TransactionKindServer)
 				tx.spinFsm(server_input_timer_g)
 			})
 		} else {
 			tx.timer_g_time *= 2
-			if tx.timer_g_time > T2 {
-				tx.timer_g_time = T2
+			if tx.timer_g_time > tx.timers.T2 {
+				tx.timer_g_time = tx.timers.T2
 			}
 
 			tx.timer_g.Reset(tx.timer_g_time)
@@ -201,7 +198,7 @@ func (tx *ServerTx) actRespondComplete() fsmInput {
 
 	tx.mu.Lock()
 	if tx.timer_h == nil {
-		tx.timer_h = time.AfterFunc(Timer_H, func() {
+		tx.timer_h = tx.clock.AfterFunc(tx.timers.H, func() {
 			tx.spinFsm(server_input_timer_h)
 		})
 	}
@@ -216,7 +213,7 @@ func (tx *ServerTx) actRespondAccept() fsmInput {
 	}
 
 	tx.mu.Lock()
-	tx.timer_l = time.AfterFunc(Timer_L, func() {
+	tx.timer_l = tx.clock.AfterFunc(tx.timers.L, func() {
 		tx.spinFsm(server_input_timer_l)
 	})
 	tx.mu.Unlock()
@@ -240,7 +237,7 @@ func (tx *ServerTx) actFinal() fsmInput {
 	//    Timer J to fire in 64*T1 seconds for unreliable transports, and zero
 	//    seconds for reliable transports.
 	tx.mu.Lock()
-	tx.timer_j = time.AfterFunc(tx.timer_j_time, func() {
+	tx.timer_j = tx.clock.AfterFunc(tx.timer_j_time, func() {
 		tx.spinFsm(server_input_timer_j)
 	})
 	tx.mu.Unlock()
@@ -283,7 +280,7 @@ func (tx *ServerTx) actConfirm() fsmInput {
 	}
 
 	// If transport is reliable this will be 0 and fire imediately
-	tx.timer_i = time.AfterFunc(tx.timer_i_time, func() {
+	tx.timer_i = tx.clock.AfterFunc(tx.timer_i_time, func() {
 		tx.spinFsm(server_input_timer_i)
 	})
 
@@ -339,5 +336,7 @@ func (tx *ServerTx) passResp() error {
 		tx.fsmErr = wrapTransportError(err)
 		return err
 	}
+	// Covers 100 Trying and retransmissions as well
+	tx.event(TransactionEvent{Type: TransactionEventResponseSent, Response: lastResp})
 	return nil
 }
@@ -0,0 +1,157 @@
+package sip
+
+import (
+	"sync"
+)
+
+// transactionStoreShards must be power of 2
+const transactionStoreShards = 32
+
+type storedTransaction interface {
+	Transaction
+	// indexConnection returns connection under which transaction is indexed, or nil
+	indexConnection() Connection
+}
+
+// transactionStore keeps transactions in shards by key, so that transactions of different calls
+// do not contend on same lock. Each shard has secondary index by connection, which allows finding
+// transactions of closed connection without scanning all. Only transactions over reliable transports
+// are indexed, as connection close is reported only for them.
+type transactionStore[T storedTransaction] struct {
+	shards [transactionStoreShards]transactionShard[T]
+}
+
+type transactionShard[T storedTransaction] struct {
+	mu    sync.RWMutex
+	items map[string]T
+	conns map[Connection]map[string]T
+}
+
+func newTransactionStore[T storedTransaction]() *transactionStore[T] {
+	store := &transactionStore[T]{}
+	for i := range store.shards {
+		store.shards[i].items = make(map[string]T)
+		store.shards[i].conns = make(map[Connection]map[string]T)
+	}
+	return store
+}
+
+func (store *transactionStore[T]) shard(key string) *transactionShard[T] {
+	// FNV-1a
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return &store.shards[h&(transactionStoreShards-1)]
+}
+
+// loadOrCreate returns existing transaction or stores one returned by create.
+// Create is called under shard lock, so transaction registering OnTerminate there
+// will be dropped only after it is stored.
+func (store *transactionStore[T]) loadOrCreate(key string, create func() (T, error)) (tx T, loaded bool, err error) {
+	shard := store.shard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if tx, exists := shard.items[key]; exists {
+		return tx, true, nil
+	}
+
+	tx, err = create()
+	if err != nil {
+		return tx, false, err
+	}
+	shard.items[key] = tx
+	shard.index(key, tx)
+	return tx, false, nil
+}
+
+func (store *transactionStore[T]) get(key string) (T, bool) {
+	shard := store.shard(key)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+	tx, ok := shard.items[key]
+	return tx, ok
+}
+
+func (store *transactionStore[T]) drop(key string) bool {
+	shard := store.shard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	tx, exists := shard.items[key]
+	if !exists {
+		return false
+	}
+	delete(shard.items, key)
+	shard.unindex(key, tx)
+	return true
+}
+
+// byConnection returns transactions using conn
+func (store *transactionStore[T]) byConnection(conn Connection) []T {
+	var list []T
+	for i := range store.shards {
+		shard := &store.shards[i]
+		shard.mu.RLock()
+		for _, tx := range shard.conns[conn] {
+			list = append(list, tx)
+		}
+		shard.mu.RUnlock()
+	}
+	return list
+}
+
+func (store *transactionStore[T]) len() int {
+	n := 0
+	for i := range store.shards {
+		shard := &store.shards[i]
+		shard.mu.RLock()
+		n += len(shard.items)
+		shard.mu.RUnlock()
+	}
+	return n
+}
+
+func (store *transactionStore[T]) terminateAll() {
+	var list []T
+	for i := range store.shards {
+		shard := &store.shards[i]
+		shard.mu.RLock()
+		for _, tx := range shard.items {
+			list = append(list, tx)
+		}
+		shard.mu.RUnlock()
+	}
+
+	for _, tx := range list {
+		tx.Terminate() // Calls on terminate to be deleted from store. It is deadlock if called under lock
+	}
+}
+
+// index adds tx to connection index. Must be called under shard lock
+func (shard *transactionShard[T]) index(key string, tx T) {
+	conn := tx.indexConnection()
+	if conn == nil {
+		return
+	}
+	txs, exists := shard.conns[conn]
+	if !exists {
+		txs = make(map[string]T)
+		shard.conns[conn] = txs
+	}
+	txs[key] = tx
+}
+
+// unindex removes tx from connection index. Must be called under shard lock
+func (shard *transactionShard[T]) unindex(key string, tx T) {
+	conn := tx.indexConnection()
+	if conn == nil {
+		return
+	}
+	if txs, exists := shard.conns[conn]; exists {
+		delete(txs, key)
+		if len(txs) == 0 {
+			delete(shard.conns, conn)
+		}
+	}
+}
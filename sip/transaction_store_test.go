@@ -0,0 +1,150 @@
+package sip
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransactionStore(t *testing.T) {
+	store := newTransactionStore[*ClientTx]()
+	conn1 := &TCPConnection{}
+	conn2 := &TCPConnection{}
+	req := testCreateRequest(t, "OPTIONS", "sip:bob@127.0.0.1", "TCP", "127.0.0.1:5090")
+
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		conn := conn1
+		if i%4 == 0 {
+			conn = conn2
+		}
+		_, loaded, err := store.loadOrCreate(key, func() (*ClientTx, error) {
+			return NewClientTx(key, req, conn, slog.Default()), nil
+		})
+		require.NoError(t, err)
+		require.False(t, loaded)
+	}
+	assert.Equal(t, 100, store.len())
+	assert.Len(t, store.byConnection(conn1), 75)
+	assert.Len(t, store.byConnection(conn2), 25)
+
+	tx, loaded, err := store.loadOrCreate("key-1", func() (*ClientTx, error) {
+		t.Fatal("must not be created")
+		return nil, nil
+	})
+	require.NoError(t, err)
+	assert.True(t, loaded)
+	assert.Equal(t, "key-1", tx.Key())
+
+	_, loaded, err = store.loadOrCreate("key-err", func() (*ClientTx, error) {
+		return nil, fmt.Errorf("failed")
+	})
+	require.Error(t, err)
+	assert.False(t, loaded)
+	_, exists := store.get("key-err")
+	assert.False(t, exists)
+
+	for i := 0; i < 100; i += 4 {
+		assert.True(t, store.drop(fmt.Sprintf("key-%d", i)))
+	}
+	assert.False(t, store.drop("key-0"))
+	assert.Empty(t, store.byConnection(conn2))
+	for i := range store.shards {
+		_, exists = store.shards[i].conns[conn2]
+		assert.False(t, exists, "connection index must be cleaned")
+	}
+	assert.Equal(t, 75, store.len())
+
+	// Unreliable transport is not indexed
+	udpConn := &UDPConnection{}
+	udpReq := testCreateRequest(t, "OPTIONS", "sip:bob@127.0.0.1", "UDP", "127.0.0.1:5090")
+	_, _, err = store.loadOrCreate("key-udp", func() (*ClientTx, error) {
+		return NewClientTx("key-udp", udpReq, udpConn, slog.Default()), nil
+	})
+	require.NoError(t, err)
+	_, exists = store.get("key-udp")
+	assert.True(t, exists)
+	assert.Empty(t, store.byConnection(udpConn))
+}
+
+// mutexTransactionStore is previous store with single lock, kept for benchmark comparison
+type mutexTransactionStore[T Transaction] struct {
+	items map[string]T
+	mu    sync.RWMutex
+}
+
+func (store *mutexTransactionStore[T]) loadOrCreate(key string, create func() (T, error)) (T, bool, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if tx, exists := store.items[key]; exists {
+		return tx, true, nil
+	}
+	tx, err := create()
+	if err != nil {
+		return tx, false, err
+	}
+	store.items[key] = tx
+	return tx, false, nil
+}
+
+func (store *mutexTransactionStore[T]) get(key string) (T, bool) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	tx, ok := store.items[key]
+	return tx, ok
+}
+
+func (store *mutexTransactionStore[T]) drop(key string) bool {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	_, exists := store.items[key]
+	delete(store.items, key)
+	return exists
+}
+
+func BenchmarkTransactionStore(b *testing.B) {
+	// Transactions share one connection, like on UDP
+	conn := &UDPConnection{}
+	req := NewRequest(OPTIONS, Uri{Host: "127.0.0.1"})
+
+	run := func(b *testing.B, loadOrCreate func(key string, create func() (*ClientTx, error)), get func(key string), drop func(key string)) {
+		var id atomic.Int64
+		b.RunParallel(func(pb *testing.PB) {
+			prefix := strconv.FormatInt(id.Add(1), 10) + "-"
+			i := 0
+			for pb.Next() {
+				key := prefix + strconv.Itoa(i)
+				i++
+				loadOrCreate(key, func() (*ClientTx, error) {
+					return NewClientTx(key, req, conn, slog.Default()), nil
+				})
+				get(key)
+				drop(key)
+			}
+		})
+	}
+
+	b.Run("Mutex", func(b *testing.B) {
+		store := &mutexTransactionStore[*ClientTx]{items: make(map[string]*ClientTx)}
+		run(b,
+			func(key string, create func() (*ClientTx, error)) { store.loadOrCreate(key, create) },
+			func(key string) { store.get(key) },
+			func(key string) { store.drop(key) },
+		)
+	})
+
+	b.Run("Sharded", func(b *testing.B) {
+		store := newTransactionStore[*ClientTx]()
+		run(b,
+			func(key string, create func() (*ClientTx, error)) { store.loadOrCreate(key, create) },
+			func(key string) { store.get(key) },
+			func(key string) { store.drop(key) },
+		)
+	})
+}
@@ -0,0 +1,81 @@
+package sip
+
+import (
+	"context"
+	"time"
+)
+
+// Timers are SIP transaction timers https://datatracker.ietf.org/doc/html/rfc3261#appendix-A
+// Unlike package timers they can be set per transaction layer, so user agents in same process
+// can have different values. Use NewTimers to populate all timers from T1, T2 and T4.
+type Timers struct {
+	// T1: Round-trip time (RTT) estimate
+	T1 time.Duration
+	// T2: Maximum retransmission interval for non-INVITE requests and INVITE responses
+	T2 time.Duration
+	// T4: Maximum duration that a message can remain in the network
+	T4 time.Duration
+
+	A, B, D, E, F, G, H, I, J, K, L, M time.Duration
+
+	// Trying is delay before INVITE server transaction sends 100 Trying on its own
+	Trying time.Duration
+}
+
+// NewTimers returns timers calculated from t1, t2 and t4 same way as SetTimers
+func NewTimers(t1, t2, t4 time.Duration) Timers {
+	return Timers{
+		T1:     t1,
+		T2:     t2,
+		T4:     t4,
+		A:      t1,
+		B:      64 * t1,
+		D:      32 * time.Second,
+		E:      t1,
+		F:      64 * t1,
+		G:      t1,
+		H:      64 * t1,
+		I:      t4,
+		J:      64 * t1,
+		K:      t4,
+		L:      64 * t1,
+		M:      64 * t1,
+		Trying: 200 * time.Millisecond,
+	}
+}
+
+// GlobalTimers returns current package timers changed by SetTimers.
+// Transactions use them when transaction layer has no own timers.
+func GlobalTimers() Timers {
+	return Timers{
+		T1:     T1,
+		T2:     T2,
+		T4:     T4,
+		A:      Timer_A,
+		B:      Timer_B,
+		D:      Timer_D,
+		E:      Timer_E,
+		F:      Timer_F,
+		G:      Timer_G,
+		H:      Timer_H,
+		I:      Timer_I,
+		J:      Timer_J,
+		K:      Timer_K,
+		L:      Timer_L,
+		M:      Timer_M,
+		Trying: Timer_1xx,
+	}
+}
+
+type timersCtxKey struct{}
+
+// ContextWithTimers overrides transaction layer timers for client transaction created with ctx.
+// For ex. higher T1 for single request going over satellite link.
+func ContextWithTimers(ctx context.Context, t Timers) context.Context {
+	return context.WithValue(ctx, timersCtxKey{}, t)
+}
+
+func timersFromContext(ctx context.Context) (Timers, bool) {
+	t, ok := ctx.Value(timersCtxKey{}).(Timers)
+	return t, ok
+}
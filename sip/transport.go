@@ -28,8 +28,11 @@ const (
 	DefaultWssPort int = 443
 )
 
-// Protocol implements network specific features.
-type transport interface {
+// Transport implements network specific features.
+// Custom transports can be registered with TransportLayer.RegisterTransport.
+// Transport is considered reliable (stream based) unless it implements
+// ReliableTransport returning false, see TransportLayer.IsReliable.
+type Transport interface {
 	// GetConnection returns connection from transport
 	// addr must be resolved to IP:port
 	GetConnection(addr string) Connection
@@ -37,6 +40,13 @@ type transport interface {
 	Close() error
 }
 
+// ReliableTransport is optional interface of custom Transport.
+// Unreliable (datagram) transport must implement it returning false, so that
+// transactions retransmit requests and responses.
+type ReliableTransport interface {
+	Reliable() bool
+}
+
 // TransportReadProps describes the transport read connection properties
 type TransportReadProps struct {
 	Transport  string
@@ -60,6 +70,9 @@ func DefaultPort(transport string) int {
 		return DefaultWsPort
 	case "wss":
 		return DefaultWssPort
+	case "unix", "unixgram":
+		// Unix sockets are addressed by path
+		return 0
 	default:
 		return DefaultTcpPort
 	}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"net"
 	"sync"
+	"sync/atomic"
 
 	"golang.org/x/sync/singleflight"
 )
@@ -33,11 +34,38 @@ var bufPool = sync.Pool{
 	},
 }
 
+// ConnectionPoolStrategy defines how connection is picked when pool
+// keeps multiple connections for same remote address
+type ConnectionPoolStrategy int
+
+const (
+	// ConnectionPoolRoundRobin rotates over connections of remote address
+	ConnectionPoolRoundRobin ConnectionPoolStrategy = iota
+	// ConnectionPoolLeastLoaded picks connection with lowest reference count
+	ConnectionPoolLeastLoaded
+)
+
+type connectionGroup struct {
+	conns []Connection
+	next  uint32
+}
+
 type connectionPool struct {
 	// TODO consider sync.Map way with atomic checks to reduce mutex contention
 	sync.RWMutex
 	m  map[string]Connection
 	sf singleflight.Group
+
+	// groups holds dialed connections per remote address when maxConns > 1
+	groups   map[string]*connectionGroup
+	maxConns int
+	strategy ConnectionPoolStrategy
+
+	// conns counts entries in m and groups per connection, so distinct connections are known
+	conns map[Connection]int
+	size  atomic.Int64
+	// onSize is called with number of distinct connections after every change
+	onSize func(size int)
 }
 
 func newConnectionPool() *connectionPool {
@@ -48,6 +76,22 @@ func newConnectionPool() *connectionPool {
 
 func (p *connectionPool) init() {
 	p.m = make(map[string]Connection)
+	p.groups = make(map[string]*connectionGroup)
+	p.conns = make(map[Connection]int)
+	p.maxConns = 1
+}
+
+// setMaxConns allows pool to keep up to size connections per remote address.
+// Dialing same remote address creates new connection until size is reached
+// and after that existing connections are picked by strategy.
+func (p *connectionPool) setMaxConns(size int, strategy ConnectionPoolStrategy) {
+	if size < 1 {
+		size = 1
+	}
+	p.Lock()
+	p.maxConns = size
+	p.strategy = strategy
+	p.Unlock()
 }
 
 func (p *connectionPool) addSingleflight(raddr Addr, laddr Addr, reuse bool, do func() (Connection, error)) (Connection, error) {
@@ -63,7 +107,7 @@ func (p *connectionPool) addSingleflight(raddr Addr, laddr Addr, reuse bool, do
 					return c, nil
 				}
 			} else {
-				if c := p.getUnref(a); c != nil {
+				if c := p.getUnrefReuse(a); c != nil {
 					return c, nil
 				}
 			}
@@ -76,11 +120,7 @@ func (p *connectionPool) addSingleflight(raddr Addr, laddr Addr, reuse bool, do
 			// Singleflight will return cached so we need todo this
 			c.Ref(-1)
 
-			p.Lock()
-			defer p.Unlock()
-
-			p.m[a] = c
-			p.m[c.LocalAddr().String()] = c
+			p.store(a, c)
 			return c, nil
 		})
 		if err != nil {
@@ -100,11 +140,23 @@ func (p *connectionPool) addSingleflight(raddr Addr, laddr Addr, reuse bool, do
 	if c.Ref(0) < 1 {
 		c.Ref(1) // Make 1 reference count by default
 	}
-	p.m[a] = c
-	p.m[c.LocalAddr().String()] = c
+	p.store(a, c)
 	return c, nil
 }
 
+// store adds dialed connection under remote and local address
+func (p *connectionPool) store(a string, c Connection) {
+	p.Lock()
+	p.set(c.LocalAddr().String(), c)
+	if p.maxConns <= 1 {
+		p.set(a, c)
+	} else {
+		p.addToGroup(a, c)
+	}
+	p.Unlock()
+	p.sizeChanged()
+}
+
 func (p *connectionPool) Add(a string, c Connection) {
 	// TODO how about multi connection support for same remote address
 	// We can then check ref count
@@ -113,8 +165,30 @@ func (p *connectionPool) Add(a string, c Connection) {
 		c.Ref(1) // Make 1 reference count by default
 	}
 	p.Lock()
-	p.m[a] = c
+	p.set(a, c)
 	p.Unlock()
+	p.sizeChanged()
+}
+
+// addListener adds listener connection under its local address. Multiple listeners on same
+// address (SO_REUSEPORT) are kept as group, so closing one keeps others in pool
+func (p *connectionPool) addListener(a string, c Connection) {
+	if c.Ref(0) < 1 {
+		c.Ref(1)
+	}
+	p.Lock()
+	if existing, exists := p.m[a]; exists && existing != c {
+		// Move to group
+		p.del(a)
+		p.addToGroup(a, existing)
+	}
+	if _, exists := p.groups[a]; exists {
+		p.addToGroup(a, c)
+	} else {
+		p.set(a, c)
+	}
+	p.Unlock()
+	p.sizeChanged()
 }
 
 // Getting connection pool increases reference
@@ -136,6 +210,11 @@ func (p *connectionPool) Get(a string) (c Connection) {
 
 func (p *connectionPool) getUnref(a string) (c Connection) {
 	p.RLock()
+	if g, exists := p.groups[a]; exists {
+		c = p.pick(g)
+		p.RUnlock()
+		return c
+	}
 	c, exists := p.m[a]
 	p.RUnlock()
 	if !exists {
@@ -144,11 +223,55 @@ func (p *connectionPool) getUnref(a string) (c Connection) {
 	return c
 }
 
+// getUnrefReuse returns existing connection only if no more connections should be dialed
+// for this remote address
+func (p *connectionPool) getUnrefReuse(a string) (c Connection) {
+	p.RLock()
+	if p.maxConns <= 1 {
+		c = p.m[a]
+	} else if g, exists := p.groups[a]; exists && len(g.conns) >= p.maxConns {
+		c = p.pick(g)
+	}
+	p.RUnlock()
+	return c
+}
+
+// pick selects connection from group. Must be called under lock
+func (p *connectionPool) pick(g *connectionGroup) Connection {
+	switch len(g.conns) {
+	case 0:
+		return nil
+	case 1:
+		return g.conns[0]
+	}
+
+	if p.strategy == ConnectionPoolLeastLoaded {
+		c := g.conns[0]
+		min := c.Ref(0)
+		for _, cc := range g.conns[1:] {
+			if ref := cc.Ref(0); ref < min {
+				c, min = cc, ref
+			}
+		}
+		return c
+	}
+
+	n := atomic.AddUint32(&g.next, 1)
+	return g.conns[(n-1)%uint32(len(g.conns))]
+}
+
 // CloseAndDelete closes connection and deletes from pool
 func (p *connectionPool) CloseAndDelete(c Connection, addr string) error {
 	p.Lock()
-	defer p.Unlock()
-	delete(p.m, addr)
+	if !p.removeFromGroup(addr, c) {
+		// Address may be already taken by other connection
+		if cc, exists := p.m[addr]; exists && cc == c {
+			p.del(addr)
+		}
+	}
+	p.Unlock()
+	p.sizeChanged()
+
 	ref, _ := c.TryClose() // Be nice. Saves from double closing
 	if ref > 0 {
 		return c.Close()
@@ -156,43 +279,152 @@ func (p *connectionPool) CloseAndDelete(c Connection, addr string) error {
 	return nil
 }
 
+// removeFromGroup removes connection from remote address group. Must be called under lock
+func (p *connectionPool) removeFromGroup(addr string, c Connection) bool {
+	g, exists := p.groups[addr]
+	if !exists {
+		return false
+	}
+
+	for i, cc := range g.conns {
+		if cc == c {
+			g.conns = append(g.conns[:i], g.conns[i+1:]...)
+			p.unref(c)
+			break
+		}
+	}
+	if len(g.conns) == 0 {
+		delete(p.groups, addr)
+	}
+	return true
+}
+
 func (p *connectionPool) Delete(addr string) {
 	p.Lock()
-	defer p.Unlock()
-	delete(p.m, addr)
+	p.del(addr)
+	p.delGroup(addr)
+	p.Unlock()
+	p.sizeChanged()
 }
 
 func (p *connectionPool) DeleteMultiple(addrs []string) {
 	p.Lock()
-	defer p.Unlock()
 	for _, a := range addrs {
-		delete(p.m, a)
+		p.del(a)
+		p.delGroup(a)
 	}
+	p.Unlock()
+	p.sizeChanged()
 }
 
 // Clear will clear all connection from pool and close them
 func (p *connectionPool) Clear() error {
 	p.Lock()
-	defer p.Unlock()
-
-	defer func() {
-		// Remove all
-		p.m = make(map[string]Connection)
-	}()
-
 	var werr error
-	for _, c := range p.m {
+	for c := range p.conns {
 		if c.Ref(0) <= 0 {
 			continue
 		}
 		werr = errors.Join(werr, c.Close())
 	}
+
+	// Remove all
+	p.m = make(map[string]Connection)
+	p.groups = make(map[string]*connectionGroup)
+	p.conns = make(map[Connection]int)
+	p.size.Store(0)
+	p.Unlock()
+	p.sizeChanged()
 	return werr
 }
 
-func (p *connectionPool) Size() int {
+// CloseIdle closes stream connections that are not used by any transaction, that is
+// only reading and idle (TransportIdleConnection) references are left.
+// Reading goroutine then removes connection from pool
+func (p *connectionPool) CloseIdle() error {
+	var idle []Connection
 	p.RLock()
-	l := len(p.m)
+	for c := range p.conns {
+		if c.Ref(0) <= 1+TransportIdleConnection {
+			idle = append(idle, c)
+		}
+	}
 	p.RUnlock()
-	return l
+
+	var werr error
+	for _, c := range idle {
+		if err := c.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			werr = errors.Join(werr, err)
+		}
+	}
+	return werr
+}
+
+// set stores connection under address. Must be called under lock
+func (p *connectionPool) set(a string, c Connection) {
+	if old, exists := p.m[a]; exists {
+		if old == c {
+			return
+		}
+		p.unref(old)
+	}
+	p.m[a] = c
+	p.ref(c)
+}
+
+// del removes address. Must be called under lock
+func (p *connectionPool) del(a string) {
+	if old, exists := p.m[a]; exists {
+		delete(p.m, a)
+		p.unref(old)
+	}
+}
+
+// addToGroup appends connection to address group. Must be called under lock
+func (p *connectionPool) addToGroup(a string, c Connection) {
+	g, exists := p.groups[a]
+	if !exists {
+		g = &connectionGroup{}
+		p.groups[a] = g
+	}
+	g.conns = append(g.conns, c)
+	p.ref(c)
+}
+
+// delGroup removes address group. Must be called under lock
+func (p *connectionPool) delGroup(a string) {
+	if g, exists := p.groups[a]; exists {
+		delete(p.groups, a)
+		for _, c := range g.conns {
+			p.unref(c)
+		}
+	}
+}
+
+// ref and unref count pool entries of connection. Must be called under lock
+func (p *connectionPool) ref(c Connection) {
+	p.conns[c]++
+	p.size.Store(int64(len(p.conns)))
+}
+
+func (p *connectionPool) unref(c Connection) {
+	if p.conns[c] <= 1 {
+		delete(p.conns, c)
+	} else {
+		p.conns[c]--
+	}
+	p.size.Store(int64(len(p.conns)))
+}
+
+// sizeChanged reports number of distinct connections. It is called after unlock,
+// and as latest size is loaded, last report is always current size
+func (p *connectionPool) sizeChanged() {
+	if p.onSize != nil {
+		p.onSize(int(p.size.Load()))
+	}
+}
+
+// Size returns number of distinct connections in pool
+func (p *connectionPool) Size() int {
+	return int(p.size.Load())
 }
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/emiago/sipgo/fakes"
+	"github.com/stretchr/testify/require"
 )
 
 func TestConnectionPool(t *testing.T) {
@@ -47,3 +48,114 @@ func BenchmarkConnectionPool(b *testing.B) {
 		}
 	}
 }
+
+func TestConnectionPoolMultipleConnections(t *testing.T) {
+	pool := newConnectionPool()
+	pool.setMaxConns(3, ConnectionPoolRoundRobin)
+
+	raddr := Addr{IP: net.ParseIP("127.0.0.2"), Port: 5060}
+	port := 10000
+	dial := func() (Connection, error) {
+		port++
+		return &TCPConnection{
+			Conn: &fakes.TCPConn{
+				LAddr: net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: port},
+				RAddr: net.TCPAddr{IP: raddr.IP, Port: raddr.Port},
+			},
+			refcount: 2,
+		}, nil
+	}
+
+	conns := make(map[Connection]struct{})
+	for i := 0; i < 3; i++ {
+		c, err := pool.addSingleflight(raddr, Addr{}, true, dial)
+		require.NoError(t, err)
+		conns[c] = struct{}{}
+	}
+	require.Len(t, conns, 3, "pool must dial new connection until full")
+
+	// Pool is full so existing are returned in round robin
+	picked := make(map[Connection]struct{})
+	for i := 0; i < 3; i++ {
+		c, err := pool.addSingleflight(raddr, Addr{}, true, dial)
+		require.NoError(t, err)
+		require.Contains(t, conns, c)
+		picked[c] = struct{}{}
+	}
+	require.Len(t, picked, 3)
+
+	// Closing one connection removes it only from group
+	var closed Connection
+	for c := range conns {
+		closed = c
+		break
+	}
+	require.NoError(t, pool.CloseAndDelete(closed, raddr.String()))
+	for i := 0; i < 3; i++ {
+		c := pool.Get(raddr.String())
+		require.NotNil(t, c)
+		require.NotEqual(t, closed, c)
+	}
+
+	t.Run("LeastLoaded", func(t *testing.T) {
+		pool.setMaxConns(2, ConnectionPoolLeastLoaded)
+		var busy Connection
+		for c := range conns {
+			if c != closed {
+				busy = c
+				break
+			}
+		}
+		busy.Ref(10)
+
+		for i := 0; i < 3; i++ {
+			c := pool.Get(raddr.String())
+			require.NotEqual(t, busy, c)
+		}
+	})
+}
+
+func TestConnectionPoolSize(t *testing.T) {
+	pool := newConnectionPool()
+	pool.setMaxConns(2, ConnectionPoolRoundRobin)
+	var sizes []int
+	pool.onSize = func(size int) {
+		// Must not be called under lock
+		pool.Size()
+		sizes = append(sizes, size)
+	}
+
+	raddr := Addr{IP: net.ParseIP("127.0.0.2"), Port: 5060}
+	port := 10000
+	dial := func() (Connection, error) {
+		port++
+		return &TCPConnection{
+			Conn: &fakes.TCPConn{
+				LAddr: net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: port},
+				RAddr: net.TCPAddr{IP: raddr.IP, Port: raddr.Port},
+			},
+			refcount: 2,
+		}, nil
+	}
+
+	// Connections in group are stored also under local address, but counted once
+	c1, err := pool.addSingleflight(raddr, Addr{}, true, dial)
+	require.NoError(t, err)
+	c2, err := pool.addSingleflight(raddr, Addr{}, true, dial)
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 2}, sizes)
+
+	pool.Add("127.0.0.3:5060", c1)
+	require.Equal(t, 2, sizes[len(sizes)-1])
+	require.Equal(t, 2, pool.Size())
+
+	require.NoError(t, pool.CloseAndDelete(c2, raddr.String()))
+	// Still stored under local address
+	require.Equal(t, 2, sizes[len(sizes)-1])
+	pool.Delete(c2.LocalAddr().String())
+	require.Equal(t, 1, sizes[len(sizes)-1])
+	require.Equal(t, 1, pool.Size())
+
+	require.NoError(t, pool.Clear())
+	require.Equal(t, 0, sizes[len(sizes)-1])
+}
@@ -7,7 +7,9 @@ import (
 	"fmt"
 	"log/slog"
 	"net"
+	"net/http"
 	"net/netip"
+	"slices"
 	"sync"
 	"time"
 )
@@ -17,6 +19,7 @@ var (
 
 	// Errors
 	ErrTransportNotSuported = errors.New("protocol not supported")
+	ErrTransportRegistered  = errors.New("transport already registered")
 
 	// No need yet to expose
 	errTransportConnectionDoesNotExists = errors.New("connection does not exists")
@@ -30,9 +33,17 @@ type TransportLayer struct {
 	ws  *TransportWS
 	wss *TransportWSS
 
-	listenPorts   map[string][]int
-	listenPortsMu sync.Mutex
-	dnsResolver   *net.Resolver
+	unix     *TransportUnix
+	unixgram *TransportUnixgram
+
+	// transports holds custom registered transports by lower case network
+	transports   map[string]Transport
+	transportsMu sync.RWMutex
+
+	// listeners are active listeners in order they were started
+	listeners   []*transportListener
+	listenersMu sync.RWMutex
+	dnsResolver *net.Resolver
 
 	handlers []MessageHandler
 
@@ -41,6 +52,23 @@ type TransportLayer struct {
 	// connectionReuse will force connection reuse when passing request
 	connectionReuse bool
 	readFilter      TransportReadFilter
+	rateLimiter     *TransportRateLimiter
+
+	udpReadBatchSize  int
+	udpWriteBatchSize int
+
+	// socketOptions are per transport network
+	socketOptions map[string]*SocketOptions
+
+	tracers []SIPEventTracer
+	trace   layerTrace
+	metrics Metrics
+
+	// connectionPoolSize is max connections per remote address for stream transports
+	connectionPoolSize     int
+	connectionPoolStrategy ConnectionPoolStrategy
+
+	tlsClientConfig TLSClientConfigFunc
 
 	// dnsPreferSRV does always SRV lookup first
 	dnsPreferSRV bool
@@ -63,6 +91,58 @@ func WithTransportLayerConnectionReuse(f bool) TransportLayerOption {
 	}
 }
 
+// WithTransportLayerConnectionPool allows keeping up to size connections per remote address
+// on stream transports (TCP, TLS, WS, WSS). New connection is dialed on request until size is reached,
+// and after that existing connections are picked by strategy.
+// Default size is 1, meaning single connection per remote address.
+func WithTransportLayerConnectionPool(size int, strategy ConnectionPoolStrategy) TransportLayerOption {
+	return func(l *TransportLayer) {
+		l.connectionPoolSize = size
+		l.connectionPoolStrategy = strategy
+	}
+}
+
+// WithTransportLayerTLSClientConfig allows picking TLS config for each destination on TLS and WSS dial.
+// For ex. different SNI, client certificate or root CAs per carrier trunk.
+func WithTransportLayerTLSClientConfig(f TLSClientConfigFunc) TransportLayerOption {
+	return func(l *TransportLayer) {
+		l.tlsClientConfig = f
+	}
+}
+
+// WithTransportLayerRateLimiter enables per source IP rate limiting and flood protection
+// on UDP, TCP, TLS, WS and WSS before messages are parsed.
+// Limiter can be shared between transport layers.
+func WithTransportLayerRateLimiter(rl *TransportRateLimiter) TransportLayerOption {
+	return func(l *TransportLayer) {
+		l.rateLimiter = rl
+	}
+}
+
+// WithTransportLayerUDPReadBatch enables reading up to size datagrams with single syscall
+// on UDP listeners (recvmmsg on Linux). Useful for high rate UDP traffic.
+func WithTransportLayerUDPReadBatch(size int) TransportLayerOption {
+	return func(l *TransportLayer) {
+		l.udpReadBatchSize = size
+	}
+}
+
+// WithTransportLayerUDPWriteBatch enables sending up to size concurrently written datagrams
+// with single syscall (sendmmsg on Linux). Responses are still sent from socket that received request.
+func WithTransportLayerUDPWriteBatch(size int) TransportLayerOption {
+	return func(l *TransportLayer) {
+		l.udpWriteBatchSize = size
+	}
+}
+
+// WithTransportLayerMetrics reports messages sent and received, parse errors
+// and connection pool sizes of all transports to m.
+func WithTransportLayerMetrics(m Metrics) TransportLayerOption {
+	return func(l *TransportLayer) {
+		l.metrics = m
+	}
+}
+
 func WithTransportLayerDNSLookupSRV(preferSRV bool) TransportLayerOption {
 	return func(l *TransportLayer) {
 		l.dnsPreferSRV = preferSRV
@@ -97,6 +177,9 @@ type TransportsConfig struct {
 	TLS *TransportTLS
 	WS  *TransportWS
 	WSS *TransportWSS
+
+	UNIX     *TransportUnix
+	UNIXGRAM *TransportUnixgram
 }
 
 func WithTransportLayerTransports(conf TransportsConfig) TransportLayerOption {
@@ -116,7 +199,7 @@ func NewTransportLayer(
 	option ...TransportLayerOption,
 ) *TransportLayer {
 	l := &TransportLayer{
-		listenPorts:     make(map[string][]int),
+		transports:      make(map[string]Transport),
 		dnsResolver:     dnsResolver,
 		connectionReuse: true,
 		log:             DefaultLogger().With("caller", "TransportLayer"),
@@ -138,6 +221,8 @@ func NewTransportLayer(
 			log:             l.log.With("caller", "Transport<UDP>"),
 			connectionReuse: l.connectionReuse,
 			readFilter:      l.readFilter,
+			ReadBatchSize:   l.udpReadBatchSize,
+			WriteBatchSize:  l.udpWriteBatchSize,
 		},
 		TCP: &TransportTCP{
 			log:             l.log.With("caller", "Transport<TCP>"),
@@ -155,7 +240,6 @@ func NewTransportLayer(
 			log:        l.log.With("caller", "Transport<WS>"),
 			readFilter: l.readFilter,
 		},
-		// TODO. Using default dial tls, but it needs to configurable via client
 		WSS: &TransportWSS{
 			TransportWS: &TransportWS{
 				log:             l.log.With("caller", "Transport<WSS>"),
@@ -164,6 +248,20 @@ func NewTransportLayer(
 				readFilter:      l.readFilter,
 			},
 		},
+		UNIX: &TransportUnix{
+			TransportTCP: &TransportTCP{
+				log:             l.log.With("caller", "Transport<UNIX>"),
+				connectionReuse: l.connectionReuse,
+				readFilter:      l.readFilter,
+			},
+		},
+		UNIXGRAM: &TransportUnixgram{
+			TransportUDP: &TransportUDP{
+				log:             l.log.With("caller", "Transport<UNIXGRAM>"),
+				connectionReuse: l.connectionReuse,
+				readFilter:      l.readFilter,
+			},
+		},
 	}
 
 	l.withTransports(transports)
@@ -173,6 +271,43 @@ func NewTransportLayer(
 	l.tls.init(sipparser, tlsConfig)
 	l.ws.init(sipparser)
 	l.wss.init(sipparser, tlsConfig)
+	l.unix.init(sipparser)
+	l.unixgram.init(sipparser)
+
+	l.trace.tracers = l.tracers
+	l.trace.metrics = l.metrics
+	l.udp.trace = newConnTrace(&l.trace, l.udp.Network())
+	l.tcp.trace = newConnTrace(&l.trace, l.tcp.Network())
+	l.tls.trace = newConnTrace(&l.trace, l.tls.Network())
+	l.ws.trace = newConnTrace(&l.trace, l.ws.Network())
+	l.wss.trace = newConnTrace(&l.trace, l.wss.Network())
+	l.unix.trace = newConnTrace(&l.trace, l.unix.Network())
+	l.unixgram.trace = newConnTrace(&l.trace, l.unixgram.Network())
+
+	if l.tlsClientConfig != nil {
+		if l.tls.ClientConfig == nil {
+			l.tls.ClientConfig = l.tlsClientConfig
+		}
+		if l.wss.ClientConfig == nil {
+			l.wss.ClientConfig = l.tlsClientConfig
+		}
+	}
+
+	if m := l.metrics; m != nil {
+		l.udp.pool.onSize = func(size int) { m.ConnectionPoolSize(l.udp.Network(), size) }
+		l.tcp.pool.onSize = func(size int) { m.ConnectionPoolSize(l.tcp.Network(), size) }
+		l.tls.pool.onSize = func(size int) { m.ConnectionPoolSize(l.tls.Network(), size) }
+		l.ws.pool.onSize = func(size int) { m.ConnectionPoolSize(l.ws.Network(), size) }
+		l.wss.pool.onSize = func(size int) { m.ConnectionPoolSize(l.wss.Network(), size) }
+		l.unix.pool.onSize = func(size int) { m.ConnectionPoolSize(l.unix.Network(), size) }
+		l.unixgram.pool.onSize = func(size int) { m.ConnectionPoolSize(l.unixgram.Network(), size) }
+	}
+
+	if l.connectionPoolSize > 1 {
+		for _, p := range []*connectionPool{l.tcp.pool, l.tls.pool, l.ws.pool, l.wss.pool} {
+			p.setMaxConns(l.connectionPoolSize, l.connectionPoolStrategy)
+		}
+	}
 
 	return l
 }
@@ -182,29 +317,87 @@ func (l *TransportLayer) withTransports(conf TransportsConfig) {
 		l.udp = conf.UDP
 		l.udp.connectionReuse = l.connectionReuse
 		l.udp.readFilter = l.readFilter
+		l.udp.rateLimiter = l.rateLimiter
+		if l.udp.SocketOptions == nil {
+			l.udp.SocketOptions = l.socketOptions["udp"]
+		}
 	}
 	if conf.TCP != nil && l.tcp == nil {
 		l.tcp = conf.TCP
 		l.tcp.connectionReuse = l.connectionReuse
 		l.tcp.readFilter = l.readFilter
+		l.tcp.rateLimiter = l.rateLimiter
+		if l.tcp.SocketOptions == nil {
+			l.tcp.SocketOptions = l.socketOptions["tcp"]
+		}
 	}
 	if conf.TLS != nil && l.tls == nil {
 		l.tls = conf.TLS
 		l.tls.connectionReuse = l.connectionReuse
 		l.tls.readFilter = l.readFilter
+		l.tls.rateLimiter = l.rateLimiter
+		if l.tls.SocketOptions == nil {
+			l.tls.SocketOptions = l.socketOptions["tls"]
+		}
 	}
 	if conf.WS != nil && l.ws == nil {
 		l.ws = conf.WS
 		l.ws.connectionReuse = l.connectionReuse
 		l.ws.readFilter = l.readFilter
+		l.ws.rateLimiter = l.rateLimiter
+		if l.ws.SocketOptions == nil {
+			l.ws.SocketOptions = l.socketOptions["ws"]
+		}
 	}
 	if conf.WSS != nil && l.wss == nil {
 		l.wss = conf.WSS
 		l.wss.connectionReuse = l.connectionReuse
 		l.wss.readFilter = l.readFilter
+		l.wss.rateLimiter = l.rateLimiter
+		if l.wss.SocketOptions == nil {
+			l.wss.SocketOptions = l.socketOptions["wss"]
+		}
+	}
+	if conf.UNIX != nil && l.unix == nil {
+		l.unix = conf.UNIX
+		l.unix.connectionReuse = l.connectionReuse
+		l.unix.readFilter = l.readFilter
+	}
+	if conf.UNIXGRAM != nil && l.unixgram == nil {
+		l.unixgram = conf.UNIXGRAM
+		l.unixgram.connectionReuse = l.connectionReuse
+		l.unixgram.readFilter = l.readFilter
 	}
 }
 
+// RegisterTransport registers custom transport for network.
+// Requests with this network in Via are then routed to this transport.
+// Builtin networks (udp, tcp, tls, ws, wss, unix, unixgram) can not be registered,
+// use WithTransportLayerTransports to customize them.
+//
+// Transport serving incoming messages must pass them to HandleMessage.
+func (l *TransportLayer) RegisterTransport(network string, t Transport) error {
+	network = NetworkToLower(network)
+	switch network {
+	case "udp", "tcp", "tls", "ws", "wss", "unix", "unixgram":
+		return fmt.Errorf("%w: %s is builtin", ErrTransportRegistered, network)
+	}
+
+	l.transportsMu.Lock()
+	defer l.transportsMu.Unlock()
+	if _, exists := l.transports[network]; exists {
+		return fmt.Errorf("%w: %s", ErrTransportRegistered, network)
+	}
+	l.transports[network] = t
+	return nil
+}
+
+// HandleMessage passes message read by transport to layer handlers.
+// Should be used by custom transports. Message must have transport and source set.
+func (l *TransportLayer) HandleMessage(msg Message) {
+	l.handleMessage(msg)
+}
+
 // OnMessage is main function which will be called on any new message by transport layer
 // Consider there is no concurency and you need to make sure that you do not block too long
 // This is intentional as higher concurency can slow things
@@ -239,90 +432,87 @@ func (l *TransportLayer) handleMessage(msg Message) {
 
 // ServeUDP will listen on udp connection
 func (l *TransportLayer) ServeUDP(c net.PacketConn) error {
-	_, port, err := ParseAddr(c.LocalAddr().String())
-	if err != nil {
-		return err
-	}
-
-	l.addListenPort("udp", port)
-
+	defer l.addListener("udp", c.LocalAddr(), c)()
 	return l.udp.Serve(c, l.handleMessage)
 }
 
 // ServeTCP will listen on tcp connection
 func (l *TransportLayer) ServeTCP(c net.Listener) error {
-	_, port, err := ParseAddr(c.Addr().String())
-	if err != nil {
-		return err
-	}
-
-	l.addListenPort("tcp", port)
-
+	defer l.addListener("tcp", c.Addr(), c)()
 	return l.tcp.Serve(c, l.handleMessage)
 }
 
 // ServeWS will listen on ws connection
 func (l *TransportLayer) ServeWS(c net.Listener) error {
-	_, port, err := ParseAddr(c.Addr().String())
-	if err != nil {
-		return err
-	}
-
-	l.addListenPort("ws", port)
-
+	defer l.addListener("ws", c.Addr(), c)()
 	return l.ws.Serve(c, l.handleMessage)
 }
 
 // ServeTLS will listen on tcp connection
 func (l *TransportLayer) ServeTLS(c net.Listener) error {
-	_, port, err := ParseAddr(c.Addr().String())
-	if err != nil {
-		return err
-	}
-
-	l.addListenPort("tls", port)
+	defer l.addListener("tls", c.Addr(), c)()
 	return l.tls.Serve(c, l.handleMessage)
 }
 
 // ServeWSS will listen on wss connection
 func (l *TransportLayer) ServeWSS(c net.Listener) error {
-	_, port, err := ParseAddr(c.Addr().String())
-	if err != nil {
-		return err
-	}
-	l.addListenPort("wss", port)
-
+	defer l.addListener("wss", c.Addr(), c)()
 	return l.wss.Serve(c, l.handleMessage)
 }
 
-func (l *TransportLayer) addListenPort(network string, port int) {
-	l.listenPortsMu.Lock()
-	defer l.listenPortsMu.Unlock()
+// WSHandler returns http.Handler upgrading requests to SIP over websocket.
+// It allows serving WS transport from existing HTTP server, where
+// origin checks, auth, cookies or path routing can be done by HTTP middleware
+func (l *TransportLayer) WSHandler() http.Handler {
+	return l.ws.httpHandler(l.handleMessage, func(laddr net.Addr) func() {
+		return l.addHandlerListener("ws", laddr)
+	})
+}
 
-	if _, ok := l.listenPorts[network]; !ok {
-		if l.listenPorts[network] == nil {
-			l.listenPorts[network] = make([]int, 0)
-		}
-		l.listenPorts[network] = append(l.listenPorts[network], port)
-	}
+// WSSHandler is same as WSHandler but for HTTP servers doing TLS termination.
+// Messages are received with WSS transport
+func (l *TransportLayer) WSSHandler() http.Handler {
+	return l.wss.httpHandler(l.handleMessage, func(laddr net.Addr) func() {
+		return l.addHandlerListener("wss", laddr)
+	})
 }
 
+// ServeUnix will listen on unix stream socket
+func (l *TransportLayer) ServeUnix(c net.Listener) error {
+	defer l.addListener("unix", c.Addr(), c)()
+	return l.unix.Serve(c, l.handleMessage)
+}
+
+// ServeUnixgram will listen on unix datagram socket
+func (l *TransportLayer) ServeUnixgram(c net.PacketConn) error {
+	defer l.addListener("unixgram", c.LocalAddr(), c)()
+	return l.unixgram.Serve(c, l.handleMessage)
+}
+
+// GetListenPort returns port of first active listener for network
 func (l *TransportLayer) GetListenPort(network string) int {
-	network = NetworkToLower(network)
-	ports, _ := l.listenPorts[network]
+	ports := l.ListenPorts(network)
 	if len(ports) > 0 {
 		return ports[0]
 	}
 	return 0
 }
 
+// ListenPorts returns ports of active listeners for network, in order they were started
 func (l *TransportLayer) ListenPorts(network string) []int {
-	l.listenPortsMu.Lock()
-	defer l.listenPortsMu.Unlock()
-
 	network = NetworkToLower(network)
-	ports, _ := l.listenPorts[network]
-	return append(ports[:0:0], ports...) // Faster clone without cloning other slice fields
+
+	l.listenersMu.RLock()
+	defer l.listenersMu.RUnlock()
+
+	var ports []int
+	for _, ln := range l.listeners {
+		if ln.info.Network != network || ln.port == 0 || slices.Contains(ports, ln.port) {
+			continue
+		}
+		ports = append(ports, ln.port)
+	}
+	return ports
 }
 
 func (l *TransportLayer) WriteMsg(msg Message) error {
@@ -433,7 +623,9 @@ func (l *TransportLayer) ClientRequestConnection(ctx context.Context, req *Reque
 	// This is probably client forcing host:port
 	if laddr.IP != nil && laddr.Port > 0 {
 		c = transport.GetConnection(laddr.String())
-	} else if l.connectionReuse {
+	} else if l.connectionReuse && l.connectionPoolSize <= 1 {
+		// With multiple connections per remote address we let transport decide
+		// as creating connection returns existing one once pool is full
 		addr := raddr.String()
 		c = transport.GetConnection(addr)
 	}
@@ -468,7 +660,7 @@ func (l *TransportLayer) serverRequestConnection(ctx context.Context, req *Reque
 	}
 
 	sourceAddr := req.MessageData.Source()
-	if IsReliable(network) && sourceAddr != "" {
+	if l.IsReliable(network) && sourceAddr != "" {
 		// If the "sent-protocol" is a reliable transport protocol such as
 		//  TCP or SCTP, or TLS over those, the response MUST be sent using
 		//  the existing connection to the source of the original request
@@ -579,6 +771,11 @@ func (l *TransportLayer) resolveRemoteAddr(ctx context.Context, network string,
 		raddr.Port = DefaultPort(network)
 	}
 
+	if network == "unix" || network == "unixgram" {
+		// Host is socket path or name mapped by transport
+		return nil
+	}
+
 	netaddr, err := netip.ParseAddr(host)
 	// dns srv lookup
 	if err != nil || !netaddr.IsValid() {
@@ -612,6 +809,17 @@ func (l *TransportLayer) overrideSentBy(c Connection, viaHop *ViaHeader) error {
 	la := c.LocalAddr()
 	laStr := la.String()
 
+	if n := la.Network(); n == "unix" || n == "unixgram" {
+		// Sent-by is local socket path. Unbound sockets have no path
+		if viaHop.Host == "" {
+			viaHop.Host = laStr
+		}
+		if viaHop.Host == "" || viaHop.Host == "@" {
+			viaHop.Host = "localhost"
+		}
+		return nil
+	}
+
 	host, port, err := ParseAddr(laStr)
 	if err != nil {
 		return fmt.Errorf("fail to parse local connection address network=%s addr=%s: %w", la.Network(), laStr, err)
@@ -774,7 +982,19 @@ func (l *TransportLayer) Close() error {
 	return werr
 }
 
-func (l *TransportLayer) getTransport(network string) transport {
+// CloseIdleConnections closes stream (TCP, TLS, WS, WSS, UNIX) connections, dialed or accepted,
+// which are not used by any transaction. Connections still in use are kept.
+func (l *TransportLayer) CloseIdleConnections() error {
+	var werr error
+	for _, p := range []*connectionPool{l.tcp.pool, l.tls.pool, l.ws.pool, l.wss.pool, l.unix.pool} {
+		if err := p.CloseIdle(); err != nil {
+			werr = errors.Join(werr, err)
+		}
+	}
+	return werr
+}
+
+func (l *TransportLayer) getTransport(network string) Transport {
 	switch network {
 	case "udp":
 		return l.udp
@@ -786,21 +1006,62 @@ func (l *TransportLayer) getTransport(network string) transport {
 		return l.ws
 	case "wss":
 		return l.wss
+	case "unix":
+		return l.unix
+	case "unixgram":
+		return l.unixgram
 	}
-	return nil
+
+	l.transportsMu.RLock()
+	t, exists := l.transports[network]
+	l.transportsMu.RUnlock()
+	if !exists {
+		return nil
+	}
+	return t
 }
 
-func (l *TransportLayer) allTransports() []transport {
-	return []transport{l.udp, l.tcp, l.tls, l.ws, l.wss}
+func (l *TransportLayer) allTransports() []Transport {
+	l.transportsMu.RLock()
+	defer l.transportsMu.RUnlock()
+
+	all := make([]Transport, 0, 7+len(l.transports))
+	all = append(all, l.udp, l.tcp, l.tls, l.ws, l.wss, l.unix, l.unixgram)
+	for _, t := range l.transports {
+		all = append(all, t)
+	}
+	return all
 }
 
-func IsReliable(network string) bool {
+// IsReliable checks builtin and custom transports registered on this layer.
+// Custom transport is reliable unless it implements ReliableTransport returning false.
+func (l *TransportLayer) IsReliable(network string) bool {
 	switch network {
-	case "udp", "UDP":
+	case "udp", "UDP", "unixgram", "UNIXGRAM":
 		return false
-	default:
+	case "tcp", "TCP", "tls", "TLS", "ws", "WS", "wss", "WSS", "unix", "UNIX":
 		return true
 	}
+
+	l.transportsMu.RLock()
+	t, exists := l.transports[NetworkToLower(network)]
+	l.transportsMu.RUnlock()
+	if exists {
+		if r, ok := t.(ReliableTransport); ok {
+			return r.Reliable()
+		}
+	}
+	return true
+}
+
+// IsReliable checks builtin networks. Unknown networks are reliable,
+// use TransportLayer.IsReliable for custom registered transports.
+func IsReliable(network string) bool {
+	switch network {
+	case "udp", "UDP", "unixgram", "UNIXGRAM":
+		return false
+	}
+	return true
 }
 
 // NetworkToLower is faster function converting UDP, TCP to udp, tcp
@@ -817,6 +1078,10 @@ func NetworkToLower(network string) string {
 		return "ws"
 	case "WSS":
 		return "wss"
+	case "UNIX":
+		return "unix"
+	case "UNIXGRAM":
+		return "unixgram"
 	default:
 		return ASCIIToLower(network)
 	}
@@ -836,6 +1101,10 @@ func NetworkToUpper(network string) string {
 		return "WS"
 	case "wss":
 		return "WSS"
+	case "unix":
+		return "UNIX"
+	case "unixgram":
+		return "UNIXGRAM"
 	default:
 		return ASCIIToUpper(network)
 	}
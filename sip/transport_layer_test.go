@@ -336,3 +336,99 @@ func TestTransportLayerResolving(t *testing.T) {
 	assert.True(t, addr.IP.To4() != nil)
 	assert.Equal(t, "127.0.0.1:0", addr.String())
 }
+
+type testMemTransport struct {
+	created chan Addr
+	conn    Connection
+}
+
+func (t *testMemTransport) GetConnection(addr string) Connection { return nil }
+func (t *testMemTransport) CreateConnection(ctx context.Context, laddr Addr, raddr Addr, handler MessageHandler) (Connection, error) {
+	t.created <- raddr
+	return t.conn, nil
+}
+func (t *testMemTransport) Close() error   { return nil }
+func (t *testMemTransport) Reliable() bool { return false }
+
+func TestTransportLayerRegisterTransport(t *testing.T) {
+	tp := NewTransportLayer(net.DefaultResolver, NewParser(), nil)
+	defer tp.Close()
+
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	mem := &testMemTransport{
+		created: make(chan Addr, 1),
+		conn:    &TCPConnection{Conn: clientConn, refcount: 1},
+	}
+	require.NoError(t, tp.RegisterTransport("MEM", mem))
+	require.ErrorIs(t, tp.RegisterTransport("mem", mem), ErrTransportRegistered)
+	require.ErrorIs(t, tp.RegisterTransport("tcp", mem), ErrTransportRegistered)
+
+	require.False(t, tp.IsReliable("MEM"))
+	require.True(t, tp.IsReliable("TCP"))
+
+	// Registry is per layer
+	other := NewTransportLayer(net.DefaultResolver, NewParser(), nil)
+	defer other.Close()
+	require.True(t, other.IsReliable("MEM"))
+
+	req := NewRequest(OPTIONS, Uri{Host: "127.0.0.2", Port: 5060})
+	req.AppendHeader(&ViaHeader{Host: "127.0.0.1", Port: 5060})
+	req.SetTransport("MEM")
+
+	conn, err := tp.ClientRequestConnection(context.TODO(), req)
+	require.NoError(t, err)
+	require.Equal(t, mem.conn, conn)
+	raddr := <-mem.created
+	require.Equal(t, "127.0.0.2:5060", raddr.String())
+
+	msgs := make(chan Message, 1)
+	tp.OnMessage(func(msg Message) { msgs <- msg })
+	tp.HandleMessage(req)
+	require.Equal(t, req, <-msgs)
+}
+
+func TestTransportLayerListeners(t *testing.T) {
+	tp := NewTransportLayer(net.DefaultResolver, NewParser(), nil)
+	defer tp.Close()
+
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer udp.Close()
+	tcp1, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer tcp1.Close()
+	tcp2, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer tcp2.Close()
+
+	go tp.ServeUDP(udp)
+	served := make(chan error, 1)
+	go func() {
+		served <- tp.ServeTCP(tcp1)
+	}()
+	require.Eventually(t, func() bool { return len(tp.Listeners()) == 2 }, time.Second, 10*time.Millisecond)
+	go tp.ServeTCP(tcp2)
+	require.Eventually(t, func() bool { return len(tp.Listeners()) == 3 }, time.Second, 10*time.Millisecond)
+
+	port1 := tcp1.Addr().(*net.TCPAddr).Port
+	port2 := tcp2.Addr().(*net.TCPAddr).Port
+	assert.Equal(t, []int{port1, port2}, tp.ListenPorts("TCP"))
+	assert.Equal(t, port1, tp.GetListenPort("tcp"))
+	assert.Contains(t, tp.Listeners(), ListenerInfo{Network: "udp", Addr: udp.LocalAddr().String()})
+
+	err = tp.CloseListener("tcp", "127.0.0.1:1")
+	require.ErrorIs(t, err, ErrListenerNotFound)
+
+	require.NoError(t, tp.CloseListener("tcp", tcp1.Addr().String()))
+	select {
+	case <-served:
+	case <-time.After(time.Second):
+		t.Fatal("listener not stopped")
+	}
+	assert.Equal(t, []int{port2}, tp.ListenPorts("tcp"))
+	assert.Equal(t, port2, tp.GetListenPort("tcp"))
+	assert.Len(t, tp.Listeners(), 2)
+}
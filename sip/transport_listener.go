@@ -0,0 +1,160 @@
+package sip
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// ErrListenerNotFound is returned when no active listener matches
+var ErrListenerNotFound = errors.New("listener not found")
+
+// ListenerInfo describes active listener of transport layer
+type ListenerInfo struct {
+	// Network is transport network in lower case: udp, tcp, tls, ws, wss, unix, unixgram
+	Network string
+	// Addr is local listening address. For unix networks it is socket path
+	Addr string
+	// TLS is true for secured listeners
+	TLS bool
+	// Handler is true for listeners served by external HTTP server with WSHandler or WSSHandler.
+	// These are listed while they have connections and can not be closed by transport layer
+	Handler bool
+}
+
+func (i ListenerInfo) String() string {
+	return fmt.Sprintf("%s:%s", i.Network, i.Addr)
+}
+
+type transportListener struct {
+	info   ListenerInfo
+	port   int
+	closer io.Closer
+	// conns is number of connections accepted by http handler on this address
+	conns int
+}
+
+func newTransportListener(network string, addr net.Addr, closer io.Closer) *transportListener {
+	ln := &transportListener{
+		info: ListenerInfo{
+			Network: network,
+			Addr:    addr.String(),
+			TLS:     network == "tls" || network == "wss",
+		},
+		closer: closer,
+	}
+	if network != "unix" && network != "unixgram" {
+		_, ln.port, _ = ParseAddr(ln.info.Addr)
+	}
+	return ln
+}
+
+// addListener registers active listener. Returned function must be called once listener stops serving
+func (l *TransportLayer) addListener(network string, addr net.Addr, closer io.Closer) func() {
+	ln := newTransportListener(network, addr, closer)
+
+	l.listenersMu.Lock()
+	l.listeners = append(l.listeners, ln)
+	l.listenersMu.Unlock()
+
+	return func() {
+		l.listenersMu.Lock()
+		defer l.listenersMu.Unlock()
+		l.removeListenerLocked(ln)
+	}
+}
+
+// addHandlerListener registers local address on which http handler accepted connection.
+// Listener is owned by http server, so it stays registered until returned function is called
+// for every accepted connection, or it is removed with CloseListener
+func (l *TransportLayer) addHandlerListener(network string, addr net.Addr) func() {
+	ln := newTransportListener(network, addr, nil)
+	ln.info.Handler = true
+
+	l.listenersMu.Lock()
+	defer l.listenersMu.Unlock()
+	for _, v := range l.listeners {
+		if v.info == ln.info {
+			ln = v
+			break
+		}
+	}
+	if ln.conns == 0 {
+		l.listeners = append(l.listeners, ln)
+	}
+	ln.conns++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.listenersMu.Lock()
+			defer l.listenersMu.Unlock()
+			ln.conns--
+			if ln.conns > 0 {
+				return
+			}
+			l.removeListenerLocked(ln)
+		})
+	}
+}
+
+// removeListenerLocked must be called under listenersMu lock
+func (l *TransportLayer) removeListenerLocked(ln *transportListener) {
+	for i, v := range l.listeners {
+		if v == ln {
+			l.listeners = append(l.listeners[:i], l.listeners[i+1:]...)
+			return
+		}
+	}
+}
+
+// Listeners returns currently active listeners
+func (l *TransportLayer) Listeners() []ListenerInfo {
+	l.listenersMu.RLock()
+	defer l.listenersMu.RUnlock()
+
+	infos := make([]ListenerInfo, 0, len(l.listeners))
+	for _, ln := range l.listeners {
+		infos = append(infos, ln.info)
+	}
+	return infos
+}
+
+// CloseListener stops listener on network and local address. Established connections are kept.
+// For UDP all sockets bound on address (SO_REUSEPORT) are closed.
+// Listeners of WSHandler and WSSHandler are owned by HTTP server, so they are only unregistered.
+func (l *TransportLayer) CloseListener(network string, addr string) error {
+	network = NetworkToLower(network)
+
+	var closers []io.Closer
+	found := false
+	l.listenersMu.Lock()
+	for i := 0; i < len(l.listeners); i++ {
+		ln := l.listeners[i]
+		if ln.info.Network != network || ln.info.Addr != addr {
+			continue
+		}
+		found = true
+		if ln.closer != nil {
+			closers = append(closers, ln.closer)
+			continue
+		}
+		l.listeners = append(l.listeners[:i], l.listeners[i+1:]...)
+		i--
+	}
+	l.listenersMu.Unlock()
+
+	if !found {
+		return fmt.Errorf("%s %s: %w", network, addr, ErrListenerNotFound)
+	}
+
+	var err error
+	for _, c := range closers {
+		if e := c.Close(); e != nil && !errors.Is(e, net.ErrClosed) {
+			err = errors.Join(err, e)
+		}
+	}
+	return err
+}
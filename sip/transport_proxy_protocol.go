@@ -0,0 +1,339 @@
+package sip
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ProxyProtocolHeaderTimeout is max time to wait for PROXY header after connection is accepted
+	ProxyProtocolHeaderTimeout = 5 * time.Second
+
+	ErrProxyProtocolHeader = errors.New("invalid PROXY protocol header")
+
+	proxyProtocolV1Prefix = []byte("PROXY ")
+	proxyProtocolV2Sig    = []byte("\x0D\x0A\x0D\x0A\x00\x0D\x0A\x51\x55\x49\x54\x0A")
+)
+
+const proxyProtocolV1MaxLen = 107
+
+// ProxyProtocolListener wraps listener and reads PROXY protocol v1 or v2 header
+// on every accepted connection, as sent by load balancers like HAProxy or AWS NLB.
+// Accepted connection RemoteAddr returns client address from header, so
+// message source, received and rport are based on real client.
+//
+// Header can set any source address, so it should be accepted only from load balancers, see TrustedProxies.
+//
+// For TLS it must wrap TCP listener before TLS listener is created.
+// https://www.haproxy.org/download/2.9/doc/proxy-protocol.txt
+type ProxyProtocolListener struct {
+	net.Listener
+
+	// TrustedProxies are networks of load balancers. Header is parsed only on connections from them,
+	// while connections from other peers sending header are closed.
+	// If empty, all peers are trusted and listener must be reachable only by load balancers.
+	TrustedProxies []*net.IPNet
+	// Optional accepts connections without PROXY header, also from untrusted peers.
+	// Real connection remote address is used
+	Optional bool
+	// HeaderTimeout overrides ProxyProtocolHeaderTimeout
+	HeaderTimeout time.Duration
+
+	once  sync.Once
+	conns chan net.Conn
+	done  chan struct{}
+	err   error
+}
+
+// NewProxyProtocolListener wraps listener with PROXY protocol parsing.
+// Header is required on every connection
+func NewProxyProtocolListener(l net.Listener) *ProxyProtocolListener {
+	return &ProxyProtocolListener{
+		Listener: l,
+	}
+}
+
+// Accept returns next connection with PROXY header read.
+// Header is read on own goroutine per connection, so slow or silent client does not block accepting others.
+// Connections with invalid header are closed and not returned.
+func (l *ProxyProtocolListener) Accept() (net.Conn, error) {
+	l.once.Do(func() {
+		l.conns = make(chan net.Conn)
+		l.done = make(chan struct{})
+		go l.acceptLoop()
+	})
+
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.done:
+		return nil, l.err
+	}
+}
+
+func (l *ProxyProtocolListener) acceptLoop() {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			l.err = err
+			close(l.done)
+			return
+		}
+
+		go func() {
+			c, err := l.readHeader(conn)
+			if err != nil {
+				DefaultLogger().Error("PROXY protocol header read failed", "raddr", conn.RemoteAddr().String(), "error", err)
+				conn.Close()
+				return
+			}
+
+			select {
+			case l.conns <- c:
+			case <-l.done:
+				c.Close()
+			}
+		}()
+	}
+}
+
+func (l *ProxyProtocolListener) readHeader(conn net.Conn) (net.Conn, error) {
+	timeout := l.HeaderTimeout
+	if timeout == 0 {
+		timeout = ProxyProtocolHeaderTimeout
+	}
+	if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+
+	c := &ProxyProtocolConn{
+		Conn:   conn,
+		reader: bufio.NewReader(conn),
+	}
+
+	if !l.trusted(conn.RemoteAddr()) {
+		if !l.Optional {
+			return nil, errProxyProtocolUntrusted
+		}
+		// Header is not parsed, but connection sending it is not plain client either
+		sig, err := c.reader.Peek(len(proxyProtocolV1Prefix))
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Equal(sig, proxyProtocolV1Prefix) || bytes.Equal(sig, proxyProtocolV2Sig[:len(sig)]) {
+			return nil, errProxyProtocolUntrusted
+		}
+		if err := conn.SetReadDeadline(time.Time{}); err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+
+	raddr, err := readProxyProtocolHeader(c.reader)
+	if err != nil {
+		if !errors.Is(err, errProxyProtocolNoHeader) || !l.Optional {
+			return nil, err
+		}
+	}
+	c.raddr = raddr
+
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// trusted checks is peer allowed to send PROXY header
+func (l *ProxyProtocolListener) trusted(addr net.Addr) bool {
+	if len(l.TrustedProxies) == 0 {
+		return true
+	}
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, n := range l.TrustedProxies {
+		if n.Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// ProxyProtocolConn is connection accepted by ProxyProtocolListener
+type ProxyProtocolConn struct {
+	net.Conn
+
+	reader *bufio.Reader
+	raddr  net.Addr
+}
+
+// Read reads data after PROXY header
+func (c *ProxyProtocolConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+// RemoteAddr returns client address from PROXY header.
+// In case of LOCAL command or missing header connection address is returned
+func (c *ProxyProtocolConn) RemoteAddr() net.Addr {
+	if c.raddr != nil {
+		return c.raddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// ProxyAddr returns address of proxy (load balancer) connection
+func (c *ProxyProtocolConn) ProxyAddr() net.Addr {
+	return c.Conn.RemoteAddr()
+}
+
+var (
+	errProxyProtocolNoHeader  = fmt.Errorf("%w: no header", ErrProxyProtocolHeader)
+	errProxyProtocolUntrusted = fmt.Errorf("%w: peer is not trusted proxy", ErrProxyProtocolHeader)
+)
+
+// readProxyProtocolHeader returns source address from header. Returns nil address
+// for LOCAL or UNKNOWN connections
+func readProxyProtocolHeader(r *bufio.Reader) (net.Addr, error) {
+	// First bytes are enough to detect version
+	sig, err := r.Peek(len(proxyProtocolV1Prefix))
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.Equal(sig, proxyProtocolV1Prefix) {
+		return readProxyProtocolV1(r)
+	}
+
+	if bytes.Equal(sig, proxyProtocolV2Sig[:len(sig)]) {
+		return readProxyProtocolV2(r)
+	}
+	return nil, errProxyProtocolNoHeader
+}
+
+// readProxyProtocolV1 parses text header
+// PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n
+func readProxyProtocolV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+		if len(line) >= proxyProtocolV1MaxLen {
+			return nil, fmt.Errorf("%w: v1 header too long", ErrProxyProtocolHeader)
+		}
+	}
+
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, fmt.Errorf("%w: v1 header missing CRLF", ErrProxyProtocolHeader)
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("%w: v1 header %q", ErrProxyProtocolHeader, line)
+	}
+
+	switch fields[1] {
+	case "UNKNOWN":
+		return nil, nil
+	case "TCP4", "TCP6":
+	default:
+		return nil, fmt.Errorf("%w: v1 protocol %q", ErrProxyProtocolHeader, fields[1])
+	}
+
+	if len(fields) != 6 {
+		return nil, fmt.Errorf("%w: v1 header %q", ErrProxyProtocolHeader, line)
+	}
+
+	ip := net.ParseIP(fields[2])
+	if ip == nil {
+		return nil, fmt.Errorf("%w: v1 source address %q", ErrProxyProtocolHeader, fields[2])
+	}
+	if (fields[1] == "TCP4") != (ip.To4() != nil) {
+		return nil, fmt.Errorf("%w: v1 source address %q does not match %s", ErrProxyProtocolHeader, fields[2], fields[1])
+	}
+
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("%w: v1 source port %q", ErrProxyProtocolHeader, fields[4])
+	}
+
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// readProxyProtocolV2 parses binary header
+func readProxyProtocolV2(r *bufio.Reader) (net.Addr, error) {
+	hdr := make([]byte, 16)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(hdr[:12], proxyProtocolV2Sig) {
+		return nil, fmt.Errorf("%w: v2 signature", ErrProxyProtocolHeader)
+	}
+
+	verCmd := hdr[12]
+	if verCmd>>4 != 2 {
+		return nil, fmt.Errorf("%w: v2 version %d", ErrProxyProtocolHeader, verCmd>>4)
+	}
+
+	length := binary.BigEndian.Uint16(hdr[14:16])
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+
+	switch verCmd & 0x0F {
+	case 0x0:
+		// LOCAL. Health checks from proxy itself
+		return nil, nil
+	case 0x1:
+		// PROXY
+	default:
+		return nil, fmt.Errorf("%w: v2 command %d", ErrProxyProtocolHeader, verCmd&0x0F)
+	}
+
+	fam := hdr[13]
+	switch fam >> 4 {
+	case 0x1: // AF_INET
+		if len(payload) < 12 {
+			return nil, fmt.Errorf("%w: v2 short ipv4 address", ErrProxyProtocolHeader)
+		}
+		ip := make(net.IP, net.IPv4len)
+		copy(ip, payload[:4])
+		port := binary.BigEndian.Uint16(payload[8:10])
+		return proxyProtocolV2Addr(fam, ip, port), nil
+	case 0x2: // AF_INET6
+		if len(payload) < 36 {
+			return nil, fmt.Errorf("%w: v2 short ipv6 address", ErrProxyProtocolHeader)
+		}
+		ip := make(net.IP, net.IPv6len)
+		copy(ip, payload[:16])
+		port := binary.BigEndian.Uint16(payload[32:34])
+		return proxyProtocolV2Addr(fam, ip, port), nil
+	}
+
+	// AF_UNSPEC or AF_UNIX. Keep connection address
+	return nil, nil
+}
+
+func proxyProtocolV2Addr(fam byte, ip net.IP, port uint16) net.Addr {
+	if fam&0x0F == 0x2 {
+		return &net.UDPAddr{IP: ip, Port: int(port)}
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}
+}
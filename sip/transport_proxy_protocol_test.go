@@ -0,0 +1,237 @@
+package sip
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testProxyProtocolV2Header(cmd byte, fam byte, addr []byte) []byte {
+	hdr := append([]byte{}, proxyProtocolV2Sig...)
+	hdr = append(hdr, 0x20|cmd, fam)
+	hdr = binary.BigEndian.AppendUint16(hdr, uint16(len(addr)))
+	return append(hdr, addr...)
+}
+
+func TestProxyProtocolHeader(t *testing.T) {
+	ipv4 := []byte{10, 0, 0, 1, 10, 0, 0, 2}
+	ipv4 = binary.BigEndian.AppendUint16(ipv4, 5070)
+	ipv4 = binary.BigEndian.AppendUint16(ipv4, 5060)
+	// TLV is ignored
+	ipv4 = append(ipv4, 0x04, 0x00, 0x01, 0xFF)
+
+	ipv6 := append(net.ParseIP("2001:db8::1").To16(), net.ParseIP("2001:db8::2").To16()...)
+	ipv6 = binary.BigEndian.AppendUint16(ipv6, 5070)
+	ipv6 = binary.BigEndian.AppendUint16(ipv6, 5060)
+
+	testCases := []struct {
+		name   string
+		header []byte
+		addr   string
+	}{
+		{name: "V1TCP4", header: []byte("PROXY TCP4 10.0.0.1 10.0.0.2 5070 5060\r\n"), addr: "10.0.0.1:5070"},
+		{name: "V1TCP6", header: []byte("PROXY TCP6 2001:db8::1 2001:db8::2 5070 5060\r\n"), addr: "[2001:db8::1]:5070"},
+		{name: "V1Unknown", header: []byte("PROXY UNKNOWN\r\n")},
+		{name: "V2TCP4", header: testProxyProtocolV2Header(0x1, 0x11, ipv4), addr: "10.0.0.1:5070"},
+		{name: "V2TCP6", header: testProxyProtocolV2Header(0x1, 0x21, ipv6), addr: "[2001:db8::1]:5070"},
+		{name: "V2Local", header: testProxyProtocolV2Header(0x0, 0x00, nil)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data := "OPTIONS sip:bob@example.com SIP/2.0\r\n"
+			r := bufio.NewReader(bytes.NewReader(append(tc.header, data...)))
+			addr, err := readProxyProtocolHeader(r)
+			require.NoError(t, err)
+			if tc.addr == "" {
+				assert.Nil(t, addr)
+			} else {
+				require.NotNil(t, addr)
+				assert.Equal(t, tc.addr, addr.String())
+			}
+
+			rest, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, data, string(rest))
+		})
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, h := range []string{
+			"PROXY TCP4 10.0.0.1 10.0.0.2 5070\r\n",
+			"PROXY TCP4 2001:db8::1 10.0.0.2 5070 5060\r\n",
+			"PROXY TCP4 10.0.0.1 10.0.0.2 5070 5060\n",
+			"OPTIONS sip:bob@example.com SIP/2.0\r\n",
+		} {
+			_, err := readProxyProtocolHeader(bufio.NewReader(bytes.NewBufferString(h)))
+			assert.ErrorIs(t, err, ErrProxyProtocolHeader, h)
+		}
+	})
+}
+
+func TestProxyProtocolListener(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	pl := NewProxyProtocolListener(l)
+	pl.HeaderTimeout = time.Second
+
+	accepted := make(chan net.Conn)
+	go func() {
+		for {
+			conn, err := pl.Accept()
+			if err != nil {
+				close(accepted)
+				return
+			}
+			accepted <- conn
+		}
+	}()
+
+	// Connection without header is dropped
+	bad, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer bad.Close()
+	_, err = bad.Write([]byte("OPTIONS sip:bob@example.com SIP/2.0\r\n"))
+	require.NoError(t, err)
+
+	client, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer client.Close()
+	_, err = client.Write([]byte("PROXY TCP4 10.0.0.1 10.0.0.2 5070 5060\r\nhello"))
+	require.NoError(t, err)
+
+	conn := <-accepted
+	defer conn.Close()
+	assert.Equal(t, "10.0.0.1:5070", conn.RemoteAddr().String())
+	assert.Equal(t, client.LocalAddr().String(), conn.(*ProxyProtocolConn).ProxyAddr().String())
+
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(buf))
+}
+
+func TestProxyProtocolListenerSlowClient(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	pl := NewProxyProtocolListener(l)
+	pl.HeaderTimeout = 10 * time.Second
+
+	// Silent client never sends header
+	silent, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer silent.Close()
+
+	client, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer client.Close()
+	_, err = client.Write([]byte("PROXY TCP4 10.0.0.1 10.0.0.2 5070 5060\r\n"))
+	require.NoError(t, err)
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := pl.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+	}()
+
+	select {
+	case conn := <-accepted:
+		defer conn.Close()
+		assert.Equal(t, "10.0.0.1:5070", conn.RemoteAddr().String())
+	case <-time.After(2 * time.Second):
+		t.Fatal("accept blocked by silent client")
+	}
+
+	require.NoError(t, pl.Close())
+	_, err = pl.Accept()
+	require.ErrorIs(t, err, net.ErrClosed)
+}
+
+func TestProxyProtocolListenerTrustedProxies(t *testing.T) {
+	_, loopback, _ := net.ParseCIDR("127.0.0.0/8")
+	_, other, _ := net.ParseCIDR("10.0.0.0/8")
+
+	serve := func(t *testing.T, trusted *net.IPNet, optional bool) (string, chan net.Conn) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		t.Cleanup(func() { l.Close() })
+
+		pl := NewProxyProtocolListener(l)
+		pl.HeaderTimeout = time.Second
+		pl.TrustedProxies = []*net.IPNet{trusted}
+		pl.Optional = optional
+
+		accepted := make(chan net.Conn, 2)
+		go func() {
+			for {
+				conn, err := pl.Accept()
+				if err != nil {
+					return
+				}
+				t.Cleanup(func() { conn.Close() })
+				accepted <- conn
+			}
+		}()
+		return l.Addr().String(), accepted
+	}
+
+	dial := func(t *testing.T, addr string, data string) net.Conn {
+		c, err := net.Dial("tcp", addr)
+		require.NoError(t, err)
+		t.Cleanup(func() { c.Close() })
+		_, err = c.Write([]byte(data))
+		require.NoError(t, err)
+		return c
+	}
+
+	assertClosed := func(t *testing.T, c net.Conn) {
+		c.SetReadDeadline(time.Now().Add(time.Second))
+		_, err := c.Read(make([]byte, 1))
+		require.Error(t, err)
+		var nerr net.Error
+		require.False(t, errors.As(err, &nerr) && nerr.Timeout(), "connection must be closed")
+	}
+
+	t.Run("Trusted", func(t *testing.T) {
+		addr, accepted := serve(t, loopback, false)
+		dial(t, addr, "PROXY TCP4 10.0.0.1 10.0.0.2 5070 5060\r\n")
+		conn := <-accepted
+		assert.Equal(t, "10.0.0.1:5070", conn.RemoteAddr().String())
+	})
+
+	t.Run("UntrustedRejected", func(t *testing.T) {
+		addr, accepted := serve(t, other, false)
+		c := dial(t, addr, "PROXY TCP4 10.0.0.1 10.0.0.2 5070 5060\r\n")
+		assertClosed(t, c)
+		assert.Empty(t, accepted)
+	})
+
+	t.Run("UntrustedOptional", func(t *testing.T) {
+		addr, accepted := serve(t, other, true)
+		// Spoofing header is rejected
+		spoof := dial(t, addr, "PROXY TCP4 10.0.0.1 10.0.0.2 5070 5060\r\n")
+		assertClosed(t, spoof)
+
+		// Plain client is accepted with its real address
+		plain := dial(t, addr, "OPTIONS sip:bob@example.com SIP/2.0\r\n")
+		conn := <-accepted
+		assert.Equal(t, plain.LocalAddr().String(), conn.RemoteAddr().String())
+		buf := make([]byte, 7)
+		_, err := io.ReadFull(conn, buf)
+		require.NoError(t, err)
+		assert.Equal(t, "OPTIONS", string(buf))
+	})
+}
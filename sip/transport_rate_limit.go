@@ -0,0 +1,446 @@
+package sip
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RateLimitReason is reason for dropping message or connection by TransportRateLimiter
+type RateLimitReason int
+
+const (
+	// RateLimitReasonRate means source exceeded messages rate
+	RateLimitReasonRate RateLimitReason = iota + 1
+	// RateLimitReasonBanned means source is banned
+	RateLimitReasonBanned
+	// RateLimitReasonConnections means source exceeded max stream connections
+	RateLimitReasonConnections
+	// RateLimitReasonSources means new source could not be tracked as MaxSources is reached
+	RateLimitReasonSources
+)
+
+func (r RateLimitReason) String() string {
+	switch r {
+	case RateLimitReasonRate:
+		return "rate"
+	case RateLimitReasonBanned:
+		return "banned"
+	case RateLimitReasonConnections:
+		return "connections"
+	case RateLimitReasonSources:
+		return "sources"
+	}
+	return "unknown"
+}
+
+// rateLimitSweepInterval is how often idle sources are removed
+const rateLimitSweepInterval = time.Minute
+
+// rateLimitShards is number of source shards. Sources are sharded by IP
+// so reads from different sources do not contend on same lock
+const rateLimitShards = 64
+
+// rateLimitMaxSources is default TransportRateLimiter.MaxSources
+const rateLimitMaxSources = 100000
+
+// TransportRateLimiterStats are counters of TransportRateLimiter
+type TransportRateLimiterStats struct {
+	// Allowed is number of reads passed
+	Allowed uint64
+	// RateLimited is number of reads dropped due to rate
+	RateLimited uint64
+	// BannedDropped is number of reads and connections dropped from banned sources
+	BannedDropped uint64
+	// ConnectionsRejected is number of stream connections rejected due to MaxConnsPerIP
+	ConnectionsRejected uint64
+	// Bans is number of bans issued
+	Bans uint64
+	// Sources is number of currently tracked source IPs
+	Sources int
+	// SourcesEvicted is number of sources removed before being idle to make room for new source
+	SourcesEvicted uint64
+	// SourcesRejected is number of reads and connections dropped as new source could not be tracked
+	SourcesRejected uint64
+}
+
+// TransportRateLimiter protects transports from floods (friendly-scanner, sipvicious...)
+// by limiting per source IP before any SIP parsing is done.
+// It applies token bucket per IP on every read (datagram or stream read),
+// caps stream connections (TCP, TLS, WS, WSS) per IP and bans sources that keep exceeding rate.
+//
+// Limiter is shared between transports and it is set with WithTransportLayerRateLimiter.
+// Limit is per read, so rate should count also responses and requests of your trunks, or put them in TrustedNets.
+type TransportRateLimiter struct {
+	// Rate is allowed reads per second per source IP. Zero disables rate limit
+	Rate float64
+	// Burst is token bucket size. Default is Rate
+	Burst int
+	// MaxConnsPerIP limits concurrent accepted stream connections per source IP. Zero is unlimited
+	MaxConnsPerIP int
+	// BanThreshold is number of rate violations after which source is banned for BanDuration.
+	// Violations are reset once source bucket is full again. Zero disables banning
+	BanThreshold int
+	// BanDuration is duration of ban. Default 10 minutes
+	BanDuration time.Duration
+	// RetryAfter enables stateless 503 Service Unavailable with Retry-After on rate limited requests
+	// received on stream transports (TCP, TLS, WS, WSS). Otherwise stream connections are closed.
+	// Datagrams are always silently dropped, as source address is not verified and
+	// answering would make us reflector for spoofed floods.
+	RetryAfter time.Duration
+	// TrustedNets are never limited. For ex. your trunks or internal network
+	TrustedNets []*net.IPNet
+	// MaxSources caps tracked source IPs, so spoofed source floods do not grow memory. Default 100000.
+	// When full, random source without ban or connection is removed for new one.
+	// If none can be removed, reads and connections of new sources are dropped
+	MaxSources int
+	// OnDrop is called for every dropped read or rejected connection. It must not block
+	OnDrop func(props TransportReadProps, reason RateLimitReason)
+
+	shards [rateLimitShards]rateLimitShard
+
+	allowed     atomic.Uint64
+	rateLimited atomic.Uint64
+	bannedDrops atomic.Uint64
+	connsReject atomic.Uint64
+	bans        atomic.Uint64
+	evicted     atomic.Uint64
+	rejected    atomic.Uint64
+}
+
+type rateLimitShard struct {
+	mu        sync.Mutex
+	sources   map[string]*rateLimitSource
+	lastSweep time.Time
+}
+
+type rateLimitSource struct {
+	tokens      float64
+	last        time.Time
+	violations  int
+	bannedUntil time.Time
+	conns       int
+}
+
+// NewTransportRateLimiter creates limiter with rate of reads per second and burst per source IP
+func NewTransportRateLimiter(rate float64, burst int) *TransportRateLimiter {
+	return &TransportRateLimiter{
+		Rate:  rate,
+		Burst: burst,
+	}
+}
+
+// Stats returns current counters
+func (l *TransportRateLimiter) Stats() TransportRateLimiterStats {
+	sources := 0
+	for i := range l.shards {
+		sh := &l.shards[i]
+		sh.mu.Lock()
+		sources += len(sh.sources)
+		sh.mu.Unlock()
+	}
+	return TransportRateLimiterStats{
+		Allowed:             l.allowed.Load(),
+		RateLimited:         l.rateLimited.Load(),
+		BannedDropped:       l.bannedDrops.Load(),
+		ConnectionsRejected: l.connsReject.Load(),
+		Bans:                l.bans.Load(),
+		Sources:             sources,
+		SourcesEvicted:      l.evicted.Load(),
+		SourcesRejected:     l.rejected.Load(),
+	}
+}
+
+// Ban bans source IP for duration
+func (l *TransportRateLimiter) Ban(ip string, d time.Duration) {
+	sh := l.shard(ip)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	s := l.source(sh, ip, time.Now())
+	s.bannedUntil = time.Now().Add(d)
+	l.bans.Add(1)
+}
+
+// Unban removes ban of source IP
+func (l *TransportRateLimiter) Unban(ip string) {
+	sh := l.shard(ip)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if s, exists := sh.sources[ip]; exists {
+		s.bannedUntil = time.Time{}
+		s.violations = 0
+	}
+}
+
+// Banned returns true if source IP is currently banned
+func (l *TransportRateLimiter) Banned(ip string) bool {
+	sh := l.shard(ip)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	s, exists := sh.sources[ip]
+	return exists && time.Now().Before(s.bannedUntil)
+}
+
+func (l *TransportRateLimiter) burst() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	if l.Rate < 1 {
+		return 1
+	}
+	return l.Rate
+}
+
+func (l *TransportRateLimiter) banDuration() time.Duration {
+	if l.BanDuration > 0 {
+		return l.BanDuration
+	}
+	return 10 * time.Minute
+}
+
+func (l *TransportRateLimiter) trusted(ip net.IP) bool {
+	for _, n := range l.TrustedNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// shard returns shard of source IP (FNV-1a)
+func (l *TransportRateLimiter) shard(ip string) *rateLimitShard {
+	h := uint32(2166136261)
+	for i := 0; i < len(ip); i++ {
+		h ^= uint32(ip[i])
+		h *= 16777619
+	}
+	return &l.shards[h%rateLimitShards]
+}
+
+// source returns source state. Must be called under shard lock
+func (l *TransportRateLimiter) source(sh *rateLimitShard, ip string, now time.Time) *rateLimitSource {
+	if sh.sources == nil {
+		sh.sources = make(map[string]*rateLimitSource)
+		sh.lastSweep = now
+	}
+
+	s, exists := sh.sources[ip]
+	if !exists {
+		s = &rateLimitSource{
+			tokens: l.burst(),
+			last:   now,
+		}
+		sh.sources[ip] = s
+	}
+	return s
+}
+
+// trackedSource returns source state, creating it only if shard has room. Must be called under shard lock
+func (l *TransportRateLimiter) trackedSource(sh *rateLimitShard, ip string, now time.Time) *rateLimitSource {
+	if s, exists := sh.sources[ip]; exists {
+		return s
+	}
+	if len(sh.sources) >= l.maxShardSources() && !l.evict(sh, now) {
+		return nil
+	}
+	return l.source(sh, ip, now)
+}
+
+func (l *TransportRateLimiter) maxShardSources() int {
+	max := l.MaxSources
+	if max <= 0 {
+		max = rateLimitMaxSources
+	}
+	return (max + rateLimitShards - 1) / rateLimitShards
+}
+
+// evict removes source without ban or connection to make room in full shard.
+// Must be called under shard lock
+func (l *TransportRateLimiter) evict(sh *rateLimitShard, now time.Time) bool {
+	// Map order is random, so flood can not choose which source is evicted
+	for ip, s := range sh.sources {
+		if s.conns > 0 || now.Before(s.bannedUntil) {
+			continue
+		}
+		delete(sh.sources, ip)
+		l.evicted.Add(1)
+		return true
+	}
+	return false
+}
+
+// sweep removes idle sources of shard. Must be called under shard lock
+func (l *TransportRateLimiter) sweep(sh *rateLimitShard, now time.Time) {
+	if now.Sub(sh.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	sh.lastSweep = now
+
+	// Source is idle once its bucket would be full again
+	idle := rateLimitSweepInterval
+	if l.Rate > 0 {
+		if d := time.Duration(l.burst() / l.Rate * float64(time.Second)); d > idle {
+			idle = d
+		}
+	}
+	for ip, s := range sh.sources {
+		if s.conns > 0 || now.Before(s.bannedUntil) || now.Sub(s.last) < idle {
+			continue
+		}
+		delete(sh.sources, ip)
+	}
+}
+
+// allow takes token for read from source. Returns zero reason if read is allowed
+func (l *TransportRateLimiter) allow(props TransportReadProps) RateLimitReason {
+	ip := rateLimitIP(props.RemoteAddr)
+	if ip == nil || l.trusted(ip) {
+		return 0
+	}
+
+	key := ip.String()
+	now := time.Now()
+	sh := l.shard(key)
+	sh.mu.Lock()
+	l.sweep(sh, now)
+	reason := RateLimitReasonSources
+	if s := l.trackedSource(sh, key, now); s != nil {
+		reason = l.take(s, now)
+	}
+	sh.mu.Unlock()
+
+	l.count(props, reason)
+	return reason
+}
+
+// take must be called under shard lock
+func (l *TransportRateLimiter) take(s *rateLimitSource, now time.Time) RateLimitReason {
+	if now.Before(s.bannedUntil) {
+		return RateLimitReasonBanned
+	}
+
+	if l.Rate <= 0 {
+		s.last = now
+		return 0
+	}
+
+	burst := l.burst()
+	s.tokens += now.Sub(s.last).Seconds() * l.Rate
+	s.last = now
+	if s.tokens >= burst {
+		s.tokens = burst
+		s.violations = 0
+	}
+
+	if s.tokens >= 1 {
+		s.tokens--
+		return 0
+	}
+
+	s.violations++
+	if l.BanThreshold > 0 && s.violations >= l.BanThreshold {
+		s.bannedUntil = now.Add(l.banDuration())
+		s.violations = 0
+		l.bans.Add(1)
+	}
+	return RateLimitReasonRate
+}
+
+// acceptConn checks new stream connection. On success release must be called once connection is closed
+func (l *TransportRateLimiter) acceptConn(props TransportReadProps) (release func(), reason RateLimitReason) {
+	ip := rateLimitIP(props.RemoteAddr)
+	if ip == nil || l.trusted(ip) {
+		return func() {}, 0
+	}
+
+	key := ip.String()
+	now := time.Now()
+	sh := l.shard(key)
+	sh.mu.Lock()
+	l.sweep(sh, now)
+	s := l.trackedSource(sh, key, now)
+	switch {
+	case s == nil:
+		reason = RateLimitReasonSources
+	case now.Before(s.bannedUntil):
+		reason = RateLimitReasonBanned
+	case l.MaxConnsPerIP > 0 && s.conns >= l.MaxConnsPerIP:
+		reason = RateLimitReasonConnections
+	default:
+		s.conns++
+	}
+	sh.mu.Unlock()
+
+	if reason != 0 {
+		l.count(props, reason)
+		return nil, reason
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			sh.mu.Lock()
+			if s, exists := sh.sources[key]; exists && s.conns > 0 {
+				s.conns--
+				s.last = time.Now()
+			}
+			sh.mu.Unlock()
+		})
+	}, 0
+}
+
+func (l *TransportRateLimiter) count(props TransportReadProps, reason RateLimitReason) {
+	switch reason {
+	case 0:
+		l.allowed.Add(1)
+		return
+	case RateLimitReasonRate:
+		l.rateLimited.Add(1)
+	case RateLimitReasonBanned:
+		l.bannedDrops.Add(1)
+	case RateLimitReasonConnections:
+		l.connsReject.Add(1)
+	case RateLimitReasonSources:
+		l.rejected.Add(1)
+	}
+
+	if l.OnDrop != nil {
+		l.OnDrop(props, reason)
+	}
+}
+
+// response builds stateless 503 for rate limited request. Returns nil if nothing should be sent
+func (l *TransportRateLimiter) response(msg Message) []byte {
+	req, ok := msg.(*Request)
+	if !ok || req.IsAck() {
+		return nil
+	}
+
+	res := NewResponseFromRequest(req, StatusServiceUnavailable, "Service Unavailable", nil)
+	retry := int(l.RetryAfter.Round(time.Second) / time.Second)
+	if retry < 1 {
+		retry = 1
+	}
+	res.AppendHeader(NewHeader("Retry-After", strconv.Itoa(retry)))
+	return []byte(res.String())
+}
+
+// rateLimitIP returns IP of address. Nil for addresses without IP like unix sockets
+func rateLimitIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP
+	case *net.TCPAddr:
+		return a.IP
+	case nil:
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}
@@ -0,0 +1,263 @@
+package sip
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransportRateLimiter(t *testing.T) {
+	props := func(addr string) TransportReadProps {
+		raddr, err := net.ResolveUDPAddr("udp", addr)
+		require.NoError(t, err)
+		return TransportReadProps{Transport: "UDP", RemoteAddr: raddr}
+	}
+
+	t.Run("TokenBucket", func(t *testing.T) {
+		l := NewTransportRateLimiter(10, 3)
+		for i := 0; i < 3; i++ {
+			assert.Zero(t, l.allow(props("10.0.0.1:5060")))
+		}
+		assert.Equal(t, RateLimitReasonRate, l.allow(props("10.0.0.1:5060")))
+		// Other source has own bucket
+		assert.Zero(t, l.allow(props("10.0.0.2:5060")))
+
+		// Refill
+		time.Sleep(150 * time.Millisecond)
+		assert.Zero(t, l.allow(props("10.0.0.1:5061")))
+
+		stats := l.Stats()
+		assert.Equal(t, uint64(5), stats.Allowed)
+		assert.Equal(t, uint64(1), stats.RateLimited)
+		assert.Equal(t, 2, stats.Sources)
+	})
+
+	t.Run("Ban", func(t *testing.T) {
+		var dropped []RateLimitReason
+		l := NewTransportRateLimiter(1, 1)
+		l.BanThreshold = 2
+		l.BanDuration = time.Minute
+		l.OnDrop = func(props TransportReadProps, reason RateLimitReason) {
+			dropped = append(dropped, reason)
+		}
+
+		assert.Zero(t, l.allow(props("10.0.0.1:5060")))
+		assert.Equal(t, RateLimitReasonRate, l.allow(props("10.0.0.1:5060")))
+		assert.Equal(t, RateLimitReasonRate, l.allow(props("10.0.0.1:5060")))
+		assert.True(t, l.Banned("10.0.0.1"))
+		assert.Equal(t, RateLimitReasonBanned, l.allow(props("10.0.0.1:5060")))
+		assert.Equal(t, []RateLimitReason{RateLimitReasonRate, RateLimitReasonRate, RateLimitReasonBanned}, dropped)
+
+		l.Unban("10.0.0.1")
+		assert.False(t, l.Banned("10.0.0.1"))
+
+		l.Ban("10.0.0.3", time.Minute)
+		_, reason := l.acceptConn(TransportReadProps{RemoteAddr: &net.TCPAddr{IP: net.ParseIP("10.0.0.3"), Port: 1}})
+		assert.Equal(t, RateLimitReasonBanned, reason)
+		assert.Equal(t, uint64(2), l.Stats().Bans)
+	})
+
+	t.Run("Trusted", func(t *testing.T) {
+		_, trusted, err := net.ParseCIDR("10.1.0.0/16")
+		require.NoError(t, err)
+		l := NewTransportRateLimiter(1, 1)
+		l.TrustedNets = []*net.IPNet{trusted}
+		for i := 0; i < 10; i++ {
+			assert.Zero(t, l.allow(props("10.1.2.3:5060")))
+		}
+		// Unix sockets are not limited
+		assert.Zero(t, l.allow(TransportReadProps{RemoteAddr: &net.UnixAddr{Name: "/tmp/sip.sock", Net: "unix"}}))
+	})
+
+	t.Run("Connections", func(t *testing.T) {
+		l := &TransportRateLimiter{MaxConnsPerIP: 2}
+		p := TransportReadProps{RemoteAddr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1}}
+		release1, reason := l.acceptConn(p)
+		require.Zero(t, reason)
+		release2, reason := l.acceptConn(p)
+		require.Zero(t, reason)
+		_, reason = l.acceptConn(p)
+		assert.Equal(t, RateLimitReasonConnections, reason)
+
+		release1()
+		release1()
+		_, reason = l.acceptConn(p)
+		assert.Zero(t, reason)
+		release2()
+		assert.Equal(t, uint64(1), l.Stats().ConnectionsRejected)
+	})
+}
+
+func TestTransportUDPRateLimit(t *testing.T) {
+	rl := NewTransportRateLimiter(0.001, 1)
+	rl.RetryAfter = 30 * time.Second
+
+	tp := NewTransportLayer(net.DefaultResolver, NewParser(), nil, WithTransportLayerRateLimiter(rl))
+	defer tp.Close()
+
+	received := make(chan Message, 10)
+	tp.OnMessage(func(msg Message) {
+		received <- msg
+	})
+
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go tp.ServeUDP(l)
+
+	client, err := net.Dial("udp", l.LocalAddr().String())
+	require.NoError(t, err)
+	defer client.Close()
+
+	req := testCreateRequest(t, "OPTIONS", "sip:bob@127.0.0.1", "UDP", client.LocalAddr().String())
+	_, err = client.Write([]byte(req.String()))
+	require.NoError(t, err)
+
+	select {
+	case <-received:
+	case <-time.After(2 * time.Second):
+		t.Fatal("first request must pass")
+	}
+
+	// Next request is limited and silently dropped, as datagram source can be spoofed
+	_, err = client.Write([]byte(req.String()))
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return rl.Stats().RateLimited == 1
+	}, 2*time.Second, 10*time.Millisecond)
+
+	client.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	_, err = client.Read(make([]byte, 2048))
+	var nerr net.Error
+	require.ErrorAs(t, err, &nerr)
+	assert.True(t, nerr.Timeout(), "no response expected")
+	assert.Len(t, received, 0)
+}
+
+func TestTransportTCPRateLimitConnections(t *testing.T) {
+	rl := &TransportRateLimiter{MaxConnsPerIP: 1}
+	tp := NewTransportLayer(net.DefaultResolver, NewParser(), nil, WithTransportLayerRateLimiter(rl))
+	defer tp.Close()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go tp.ServeTCP(l)
+
+	first, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer first.Close()
+
+	require.Eventually(t, func() bool {
+		return rl.Stats().Sources == 1
+	}, 2*time.Second, 10*time.Millisecond)
+
+	second, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer second.Close()
+
+	// Rejected connection is closed by server
+	second.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err = second.Read(make([]byte, 1))
+	require.Error(t, err)
+	var nerr net.Error
+	if errors.As(err, &nerr) {
+		assert.False(t, nerr.Timeout(), "expected connection close")
+	}
+	assert.Equal(t, uint64(1), rl.Stats().ConnectionsRejected)
+}
+
+func TestTransportWSRateLimitConnections(t *testing.T) {
+	rl := &TransportRateLimiter{MaxConnsPerIP: 1}
+	tp := NewTransportLayer(net.DefaultResolver, NewParser(), nil, WithTransportLayerRateLimiter(rl))
+	defer tp.Close()
+
+	srv := httptest.NewServer(tp.WSHandler())
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	d := ws.Dialer{Protocols: WebSocketProtocols}
+	first, _, _, err := d.Dial(ctx, "ws://"+srv.Listener.Addr().String())
+	require.NoError(t, err)
+	defer first.Close()
+
+	// Second connection is rejected before upgrade
+	_, _, _, err = d.Dial(ctx, "ws://"+srv.Listener.Addr().String())
+	var serr ws.StatusError
+	require.ErrorAs(t, err, &serr)
+	assert.Equal(t, http.StatusTooManyRequests, int(serr))
+	assert.Equal(t, uint64(1), rl.Stats().ConnectionsRejected)
+}
+
+func TestTransportRateLimiterShards(t *testing.T) {
+	l := NewTransportRateLimiter(1000, 1000)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			raddr := &net.UDPAddr{IP: net.IPv4(10, 0, 0, byte(i)), Port: 5060}
+			for j := 0; j < 100; j++ {
+				l.allow(TransportReadProps{RemoteAddr: raddr})
+			}
+			l.Ban(raddr.IP.String(), time.Minute)
+		}(i)
+	}
+	wg.Wait()
+
+	stats := l.Stats()
+	assert.Equal(t, 8, stats.Sources)
+	assert.Equal(t, uint64(800), stats.Allowed)
+	for i := 0; i < 8; i++ {
+		assert.True(t, l.Banned(net.IPv4(10, 0, 0, byte(i)).String()))
+	}
+}
+
+func TestTransportRateLimiterMaxSources(t *testing.T) {
+	l := NewTransportRateLimiter(1000, 1000)
+	// Single source per shard
+	l.MaxSources = rateLimitShards
+
+	// Spoofed flood from many sources does not grow tracked sources
+	for i := 0; i < 1000; i++ {
+		raddr := &net.UDPAddr{IP: net.IPv4(10, 0, byte(i>>8), byte(i)), Port: 5060}
+		assert.Zero(t, l.allow(TransportReadProps{RemoteAddr: raddr}))
+	}
+	stats := l.Stats()
+	assert.LessOrEqual(t, stats.Sources, rateLimitShards)
+	assert.Equal(t, uint64(1000-stats.Sources), stats.SourcesEvicted)
+
+	// Banned source is not evicted, so new source of same shard can not be tracked
+	l = NewTransportRateLimiter(1000, 1000)
+	l.MaxSources = rateLimitShards
+	banned := "192.168.0.1"
+	l.Ban(banned, time.Minute)
+	var other net.IP
+	for i := 2; other == nil; i++ {
+		ip := net.IPv4(192, 168, byte(i>>8), byte(i))
+		if l.shard(ip.String()) == l.shard(banned) {
+			other = ip
+		}
+	}
+	var dropped []RateLimitReason
+	l.OnDrop = func(props TransportReadProps, reason RateLimitReason) {
+		dropped = append(dropped, reason)
+	}
+	assert.Equal(t, RateLimitReasonSources, l.allow(TransportReadProps{RemoteAddr: &net.UDPAddr{IP: other, Port: 5060}}))
+	_, reason := l.acceptConn(TransportReadProps{RemoteAddr: &net.TCPAddr{IP: other, Port: 5060}})
+	assert.Equal(t, RateLimitReasonSources, reason)
+	assert.Equal(t, []RateLimitReason{RateLimitReasonSources, RateLimitReasonSources}, dropped)
+	assert.Equal(t, uint64(2), l.Stats().SourcesRejected)
+	assert.True(t, l.Banned(banned))
+}
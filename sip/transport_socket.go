@@ -0,0 +1,111 @@
+package sip
+
+import (
+	"net"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// DSCP code points commonly used for SIP signalling
+const (
+	DSCPCS3  = 24
+	DSCPAF31 = 26
+)
+
+// SocketOptions are applied on sockets created by transport, both dialed and listening.
+// They are set per transport with WithTransportLayerSocketOptions or SocketOptions field of transport.
+type SocketOptions struct {
+	// DSCP marks packets with Differentiated Services code point (IP_TOS, IPV6_TCLASS), for ex. DSCPCS3.
+	// Zero leaves system default
+	DSCP int
+	// SendBuffer and ReceiveBuffer set SO_SNDBUF and SO_RCVBUF in bytes. Zero leaves system default
+	SendBuffer    int
+	ReceiveBuffer int
+	// KeepAlive configures TCP keepalive on stream sockets. Zero value keeps Go defaults
+	KeepAlive net.KeepAliveConfig
+	// UserTimeout sets TCP_USER_TIMEOUT on stream sockets (Linux only). Zero leaves system default
+	UserTimeout time.Duration
+	// Control is called for every created socket after options above are applied.
+	// It can set any other socket option
+	Control func(network, address string, c syscall.RawConn) error
+}
+
+// ListenConfig returns listen config applying options. Nil options return empty config
+func (o *SocketOptions) ListenConfig() *net.ListenConfig {
+	lc := &net.ListenConfig{}
+	if o == nil {
+		return lc
+	}
+	lc.Control = o.control
+	lc.KeepAliveConfig = o.KeepAlive
+	return lc
+}
+
+// applyDialer sets options on dialer. Nil options do nothing
+func (o *SocketOptions) applyDialer(d *net.Dialer) {
+	if o == nil {
+		return
+	}
+	d.Control = o.control
+	d.KeepAliveConfig = o.KeepAlive
+}
+
+func (o *SocketOptions) control(network, address string, c syscall.RawConn) error {
+	var serr error
+	err := c.Control(func(fd uintptr) {
+		serr = o.setsockopt(network, fd)
+	})
+	if err != nil {
+		return err
+	}
+	if serr != nil {
+		return serr
+	}
+
+	if o.Control != nil {
+		return o.Control(network, address, c)
+	}
+	return nil
+}
+
+func socketIsStream(network string) bool {
+	return strings.HasPrefix(network, "tcp")
+}
+
+// WithTransportLayerSocketOptions sets socket options for transports networks: udp, tcp, tls, ws, wss.
+// If no network is passed, options are used for all of them.
+// Listeners created by Server use them as well, see TransportLayer.ListenConfig
+func WithTransportLayerSocketOptions(opts SocketOptions, networks ...string) TransportLayerOption {
+	return func(l *TransportLayer) {
+		if len(networks) == 0 {
+			networks = []string{"udp", "tcp", "tls", "ws", "wss"}
+		}
+		if l.socketOptions == nil {
+			l.socketOptions = make(map[string]*SocketOptions)
+		}
+		for _, n := range networks {
+			o := opts
+			l.socketOptions[NetworkToLower(n)] = &o
+		}
+	}
+}
+
+// ListenConfig returns listen config with socket options of transport network.
+// It should be used for creating listeners passed to Serve methods.
+func (l *TransportLayer) ListenConfig(network string) *net.ListenConfig {
+	var opts *SocketOptions
+	switch NetworkToLower(strings.TrimRight(network, "46")) {
+	case "udp":
+		opts = l.udp.SocketOptions
+	case "tcp":
+		opts = l.tcp.SocketOptions
+	case "tls":
+		opts = l.tls.SocketOptions
+	case "ws":
+		opts = l.ws.SocketOptions
+	case "wss":
+		opts = l.wss.SocketOptions
+	}
+	return opts.ListenConfig()
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package sip
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func (o *SocketOptions) setsockopt(network string, fd uintptr) error {
+	if o.DSCP != 0 || o.SendBuffer > 0 || o.ReceiveBuffer > 0 || o.UserTimeout > 0 {
+		return fmt.Errorf("socket options are not supported on %s, use Control", runtime.GOOS)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+//go:build linux
+
+package sip
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func testSockoptInt(t *testing.T, conn syscall.Conn, level, opt int) int {
+	raw, err := conn.SyscallConn()
+	require.NoError(t, err)
+	var val int
+	var serr error
+	require.NoError(t, raw.Control(func(fd uintptr) {
+		val, serr = unix.GetsockoptInt(int(fd), level, opt)
+	}))
+	require.NoError(t, serr)
+	return val
+}
+
+func TestTransportSocketOptions(t *testing.T) {
+	var controlled atomic.Int32
+	opts := SocketOptions{
+		DSCP:          DSCPCS3,
+		ReceiveBuffer: 64 * 1024,
+		UserTimeout:   5 * time.Second,
+		Control: func(network, address string, c syscall.RawConn) error {
+			controlled.Add(1)
+			return nil
+		},
+	}
+	tp := NewTransportLayer(net.DefaultResolver, NewParser(), nil, WithTransportLayerSocketOptions(opts, "udp", "tcp"))
+	defer tp.Close()
+
+	ctx := context.Background()
+
+	t.Run("UDPListen", func(t *testing.T) {
+		conn, err := tp.ListenConfig("udp4").ListenPacket(ctx, "udp4", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer conn.Close()
+
+		udp := conn.(*net.UDPConn)
+		assert.Equal(t, DSCPCS3<<2, testSockoptInt(t, udp, unix.IPPROTO_IP, unix.IP_TOS))
+		// Linux doubles requested buffer size
+		assert.GreaterOrEqual(t, testSockoptInt(t, udp, unix.SOL_SOCKET, unix.SO_RCVBUF), 64*1024)
+	})
+
+	t.Run("TCPDial", func(t *testing.T) {
+		l, err := net.Listen("tcp4", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer l.Close()
+
+		laddr := l.Addr().(*net.TCPAddr)
+		c, err := tp.tcp.CreateConnection(ctx, Addr{}, Addr{IP: laddr.IP, Port: laddr.Port}, tp.handleMessage)
+		require.NoError(t, err)
+
+		tcp := c.(*TCPConnection).Conn.(*net.TCPConn)
+		assert.Equal(t, DSCPCS3<<2, testSockoptInt(t, tcp, unix.IPPROTO_IP, unix.IP_TOS))
+		assert.Equal(t, 5000, testSockoptInt(t, tcp, unix.IPPROTO_TCP, unix.TCP_USER_TIMEOUT))
+	})
+
+	t.Run("NotConfigured", func(t *testing.T) {
+		conn, err := tp.ListenConfig("ws").Listen(ctx, "tcp4", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer conn.Close()
+		assert.Zero(t, testSockoptInt(t, conn.(*net.TCPListener), unix.IPPROTO_IP, unix.IP_TOS))
+	})
+
+	assert.Equal(t, int32(2), controlled.Load())
+}
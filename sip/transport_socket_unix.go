@@ -0,0 +1,44 @@
+//go:build unix
+
+package sip
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+func (o *SocketOptions) setsockopt(network string, fd uintptr) error {
+	s := int(fd)
+	if o.DSCP != 0 {
+		tos := o.DSCP << 2
+		if strings.HasSuffix(network, "6") {
+			if err := unix.SetsockoptInt(s, unix.IPPROTO_IPV6, unix.IPV6_TCLASS, tos); err != nil {
+				return fmt.Errorf("set IPV6_TCLASS: %w", err)
+			}
+			// Dual stack socket can carry IPv4 traffic as well. Not all systems allow it
+			unix.SetsockoptInt(s, unix.IPPROTO_IP, unix.IP_TOS, tos)
+		} else if err := unix.SetsockoptInt(s, unix.IPPROTO_IP, unix.IP_TOS, tos); err != nil {
+			return fmt.Errorf("set IP_TOS: %w", err)
+		}
+	}
+
+	if o.SendBuffer > 0 {
+		if err := unix.SetsockoptInt(s, unix.SOL_SOCKET, unix.SO_SNDBUF, o.SendBuffer); err != nil {
+			return fmt.Errorf("set SO_SNDBUF: %w", err)
+		}
+	}
+	if o.ReceiveBuffer > 0 {
+		if err := unix.SetsockoptInt(s, unix.SOL_SOCKET, unix.SO_RCVBUF, o.ReceiveBuffer); err != nil {
+			return fmt.Errorf("set SO_RCVBUF: %w", err)
+		}
+	}
+
+	if o.UserTimeout > 0 && socketIsStream(network) {
+		if err := setTCPUserTimeout(s, o.UserTimeout); err != nil {
+			return fmt.Errorf("set TCP_USER_TIMEOUT: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+//go:build unix && !linux
+
+package sip
+
+import (
+	"errors"
+	"time"
+)
+
+func setTCPUserTimeout(fd int, d time.Duration) error {
+	return errors.ErrUnsupported
+}
@@ -3,12 +3,14 @@ package sip
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -19,11 +21,16 @@ type TransportTCP struct {
 	log             *slog.Logger
 	connectionReuse bool
 	readFilter      TransportReadFilter
+	rateLimiter     *TransportRateLimiter
+	trace           *connTrace
 
 	pool *connectionPool
 
 	DialerCreate func(laddr net.Addr) net.Dialer
 
+	// SocketOptions are applied on dialed sockets with default DialerCreate
+	SocketOptions *SocketOptions
+
 	onConnClose func(conn Connection)
 }
 
@@ -36,10 +43,12 @@ func (t *TransportTCP) init(par *Parser) {
 	}
 	if t.DialerCreate == nil {
 		t.DialerCreate = func(laddr net.Addr) net.Dialer {
-			return net.Dialer{
+			d := net.Dialer{
 				Timeout:   1 * time.Minute,
 				LocalAddr: laddr,
 			}
+			t.SocketOptions.applyDialer(&d)
+			return d
 		}
 	}
 }
@@ -119,6 +128,7 @@ func (t *TransportTCP) CreateConnection(ctx context.Context, laddr Addr, raddr A
 		c := &TCPConnection{
 			Conn:     conn,
 			refcount: 2 + TransportIdleConnection, // 1 returning + 1 reading + Idle
+			trace:    t.trace.conn(),
 		}
 
 		go t.readConnection(c, c.LocalAddr().String(), c.RemoteAddr().String(), handler)
@@ -136,14 +146,33 @@ func (t *TransportTCP) initConnection(conn net.Conn, raddr string, handler Messa
 	// // conn.SetKeepAlive(true)
 	// conn.SetKeepAlivePeriod(3 * time.Second)
 	laddr := conn.LocalAddr().String()
+	release := func() {}
+	if t.rateLimiter != nil {
+		r, reason := t.rateLimiter.acceptConn(TransportReadProps{
+			Transport:  t.Network(),
+			LocalAddr:  conn.LocalAddr(),
+			RemoteAddr: conn.RemoteAddr(),
+		})
+		if reason != 0 {
+			t.log.Debug("Connection rejected by rate limiter", "raddr", raddr, "reason", reason.String())
+			conn.Close()
+			return nil
+		}
+		release = r
+	}
+
 	t.log.Debug("New connection", "raddr", raddr)
 	c := &TCPConnection{
 		Conn:     conn,
 		refcount: 1 + TransportIdleConnection,
+		trace:    t.trace.conn(),
 	}
 	t.pool.Add(laddr, c)
 	t.pool.Add(raddr, c)
-	go t.readConnection(c, laddr, raddr, handler)
+	go func() {
+		defer release()
+		t.readConnection(c, laddr, raddr, handler)
+	}()
 	return c
 }
 
@@ -164,6 +193,8 @@ func (t *TransportTCP) readConnection(conn *TCPConnection, laddr string, raddr s
 
 	// Create stream parser context
 	par := t.parser.NewSIPStream()
+	// Stream is traced per message with bytes as read
+	par.captureRaw = conn.trace.traced()
 
 	for {
 		num, err := conn.Read(buf)
@@ -182,6 +213,27 @@ func (t *TransportTCP) readConnection(conn *TCPConnection, laddr string, raddr s
 			continue
 		}
 
+		if t.rateLimiter != nil {
+			reason := t.rateLimiter.allow(TransportReadProps{
+				Transport:  t.Network(),
+				LocalAddr:  conn.LocalAddr(),
+				RemoteAddr: conn.RemoteAddr(),
+			})
+			if reason != 0 {
+				if reason != RateLimitReasonRate || t.rateLimiter.RetryAfter == 0 {
+					t.log.Debug("Closing rate limited connection", "raddr", raddr, "reason", reason.String())
+					return
+				}
+				// Stream must stay framed, so requests are parsed and answered with 503
+				par.ParseSIPStream(data, func(msg Message) {
+					if res := t.rateLimiter.response(msg); res != nil {
+						conn.Write(res)
+					}
+				})
+				continue
+			}
+		}
+
 		if t.readFilter != nil {
 			filtered, err := t.readFilter(TransportReadProps{
 				Transport:  t.Network(),
@@ -219,14 +271,17 @@ func (t *TransportTCP) readConnection(conn *TCPConnection, laddr string, raddr s
 		// TODO fallback to parseFull if message size limit is set
 
 		// t.log.Debug().Str("raddr", raddr).Str("data", string(data)).Msg("new message")
-		t.parseStream(par, data, raddr, handler)
+		t.parseStream(par, data, conn, raddr, handler)
 	}
 }
 
-func (t *TransportTCP) parseStream(par *ParserStream, data []byte, src string, handler MessageHandler) {
-	err := par.ParseSIPStream(data, func(msg Message) {
+func (t *TransportTCP) parseStream(par *ParserStream, data []byte, conn *TCPConnection, src string, handler MessageHandler) {
+	tlsState := conn.TLSConnectionState()
+	err := par.parseSIPStreamRaw(data, func(msg Message, raw []byte) {
+		conn.trace.read(conn.LocalAddr(), src, raw, msg)
 		msg.SetTransport(t.Network())
 		msg.SetSource(src)
+		setMessageTLS(msg, tlsState)
 		handler(msg)
 	})
 
@@ -234,6 +289,7 @@ func (t *TransportTCP) parseStream(par *ParserStream, data []byte, src string, h
 		if err == ErrParseSipPartial {
 			return
 		}
+		conn.trace.read(conn.LocalAddr(), src, data, nil)
 		t.log.Error("failed to parse", "error", err, "data", string(data))
 		return
 	}
@@ -244,6 +300,20 @@ type TCPConnection struct {
 
 	mu       sync.RWMutex
 	refcount int
+	tlsState atomic.Pointer[tls.ConnectionState]
+	trace    *connTrace
+}
+
+// TLSConnectionState returns TLS state once handshake is complete. Returns nil for non TLS connection
+func (c *TCPConnection) TLSConnectionState() *tls.ConnectionState {
+	if state := c.tlsState.Load(); state != nil {
+		return state
+	}
+	state := netConnTLSState(c.Conn)
+	if state != nil {
+		c.tlsState.Store(state)
+	}
+	return state
 }
 
 func (c *TCPConnection) Ref(i int) int {
@@ -311,6 +381,7 @@ func (c *TCPConnection) WriteMsg(msg Message) error {
 	if err != nil {
 		return fmt.Errorf("conn %s write err=%w", c.RemoteAddr().String(), err)
 	}
+	c.trace.write(c.LocalAddr(), c.RemoteAddr(), data[:n], msg)
 
 	if n == 0 {
 		return fmt.Errorf("wrote 0 bytes")
@@ -3,33 +3,65 @@ package sip
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"net"
+	"strings"
 )
 
-var ()
+// TLSClientConfigFunc returns TLS config used for dialing remote address.
+// Hostname of address is original host before resolving, which is useful for SNI
+// or picking client certificate per trunk. Returning nil config uses default transport config.
+type TLSClientConfigFunc func(raddr Addr) (*tls.Config, error)
 
 // TLS transport implementation
 type TransportTLS struct {
 	*TransportTCP
 
-	// rootPool *x509.CertPool
-	tlsClient func(conn net.Conn, hostname string) *tls.Conn
+	// ClientConfig allows TLS config per destination. For ex. each carrier trunk with different client cert.
+	// If ServerName is empty, it is set to destination hostname
+	ClientConfig TLSClientConfigFunc
+
+	dialTLSConf *tls.Config
 }
 
 func (t *TransportTLS) init(par *Parser, dialTLSConf *tls.Config) {
 	t.TransportTCP.init(par)
 	t.transport = "TLS"
-	// p.rootPool = roots
-	t.tlsClient = func(conn net.Conn, hostname string) *tls.Conn {
-		config := dialTLSConf
+	t.dialTLSConf = dialTLSConf
+}
+
+func (t *TransportTLS) tlsClient(conn net.Conn, raddr Addr) (*tls.Conn, error) {
+	config, err := tlsClientConfig(t.dialTLSConf, t.ClientConfig, raddr)
+	if err != nil {
+		return nil, err
+	}
+	return tls.Client(conn, config), nil
+}
 
-		if config.ServerName == "" {
-			config = config.Clone()
-			config.ServerName = hostname
+// tlsClientConfig picks config for destination and sets ServerName to hostname if missing
+func tlsClientConfig(defConf *tls.Config, clientConfig TLSClientConfigFunc, raddr Addr) (*tls.Config, error) {
+	config := defConf
+	if clientConfig != nil {
+		conf, err := clientConfig(raddr)
+		if err != nil {
+			return nil, fmt.Errorf("client tls config: %w", err)
+		}
+		if conf != nil {
+			config = conf
+		}
+	}
+
+	if config.ServerName == "" {
+		hostname := raddr.Hostname
+		if hostname == "" {
+			hostname = raddr.IP.String()
 		}
-		return tls.Client(conn, config)
+		config = config.Clone()
+		config.ServerName = hostname
 	}
+	return config, nil
 }
 
 func (t *TransportTLS) String() string {
@@ -40,11 +72,6 @@ func (t *TransportTLS) String() string {
 func (t *TransportTLS) CreateConnection(ctx context.Context, laddr Addr, raddr Addr, handler MessageHandler) (Connection, error) {
 	isNew := false
 	conn, err := t.pool.addSingleflight(raddr, laddr, t.connectionReuse, func() (Connection, error) {
-		hostname := raddr.Hostname
-		if hostname == "" {
-			hostname = raddr.IP.String()
-		}
-
 		var tladdr *net.TCPAddr = nil
 		if laddr.IP != nil {
 			tladdr = &net.TCPAddr{
@@ -68,7 +95,11 @@ func (t *TransportTLS) CreateConnection(ctx context.Context, laddr Addr, raddr A
 			return nil, fmt.Errorf("dial TCP error: %w", err)
 		}
 
-		tlsConn := t.tlsClient(conn, hostname)
+		tlsConn, err := t.tlsClient(conn, raddr)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
 
 		if err := tlsConn.HandshakeContext(ctx); err != nil {
 			return nil, fmt.Errorf("TLS handshake error: %w", err)
@@ -78,6 +109,7 @@ func (t *TransportTLS) CreateConnection(ctx context.Context, laddr Addr, raddr A
 		c := &TCPConnection{
 			Conn:     tlsConn,
 			refcount: 2 + TransportIdleConnection,
+			trace:    t.trace.conn(),
 		}
 		isNew = true
 		return c, nil
@@ -91,3 +123,129 @@ func (t *TransportTLS) CreateConnection(ctx context.Context, laddr Addr, raddr A
 	}
 	return c, nil
 }
+
+var (
+	ErrSIPDomainCertificate = errors.New("certificate does not match SIP domain")
+)
+
+// TLSConnection is implemented by stream connections (TLS, WSS) which can expose peer TLS state.
+// For ex. mutual TLS peer certificate is available with
+//
+//	if c, ok := conn.(TLSConnection); ok { c.TLSConnectionState().PeerCertificates }
+type TLSConnection interface {
+	Connection
+	// TLSConnectionState returns state after handshake is complete. Returns nil if connection is not TLS
+	TLSConnectionState() *tls.ConnectionState
+}
+
+// netConnTLSState unwraps connection and returns TLS state if handshake is complete
+func netConnTLSState(conn net.Conn) *tls.ConnectionState {
+	for conn != nil {
+		switch c := conn.(type) {
+		case interface{ ConnectionState() tls.ConnectionState }:
+			state := c.ConnectionState()
+			if !state.HandshakeComplete {
+				return nil
+			}
+			return &state
+		case *wsBufferedConn:
+			conn = c.Conn
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// SIPDomainIdentities returns SIP domain identities of certificate as described in RFC 5922 section 7.1.
+// Identities are taken from subjectAltName URI entries with sip scheme and no user part,
+// and DNS entries. Only if certificate has no subjectAltName, Common Name is used.
+func SIPDomainIdentities(cert *x509.Certificate) []string {
+	hasSAN := len(cert.URIs) > 0 || len(cert.DNSNames) > 0 || len(cert.IPAddresses) > 0 || len(cert.EmailAddresses) > 0
+	if !hasSAN {
+		if cert.Subject.CommonName == "" {
+			return nil
+		}
+		return []string{strings.ToLower(cert.Subject.CommonName)}
+	}
+
+	identities := make([]string, 0, len(cert.URIs)+len(cert.DNSNames))
+	for _, u := range cert.URIs {
+		// URIs with user part or other schemes are not SIP domain identity
+		if !strings.EqualFold(u.Scheme, "sip") || u.Opaque == "" {
+			continue
+		}
+		if strings.ContainsAny(u.Opaque, "@;?") {
+			continue
+		}
+		identities = append(identities, strings.ToLower(u.Opaque))
+	}
+	for _, name := range cert.DNSNames {
+		identities = append(identities, strings.ToLower(name))
+	}
+	return identities
+}
+
+// VerifySIPDomain checks that certificate is valid for SIP domain following RFC 5922 section 7.
+// Domain is compared with identities returned by SIPDomainIdentities in case insensitive way.
+// Wildcard identities are not matched as SIP domain identity must be exact.
+//
+// It does not verify certificate chain. For outbound it is the host of Request URI or Route,
+// for inbound it is domain peer is claiming, for ex. From header host.
+func VerifySIPDomain(cert *x509.Certificate, domain string) error {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	for _, id := range SIPDomainIdentities(cert) {
+		if id == domain {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: domain=%q", ErrSIPDomainCertificate, domain)
+}
+
+// VerifyPeerSIPDomain checks peer leaf certificate of TLS connection against SIP domain.
+// Use it in handlers with req.TLS() to authenticate mutual TLS peers.
+func VerifyPeerSIPDomain(state *tls.ConnectionState, domain string) error {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return fmt.Errorf("%w: no peer certificate", ErrSIPDomainCertificate)
+	}
+	return VerifySIPDomain(state.PeerCertificates[0], domain)
+}
+
+// TLSConfigVerifySIPDomain returns copy of config where server certificate hostname check
+// is replaced with RFC 5922 SIP domain check. Certificate chain is still verified against RootCAs.
+// Transport sets ServerName to original host before resolving, which is SIP domain.
+//
+// Use it for client (dialing) TLS config passed to transport layer.
+func TLSConfigVerifySIPDomain(conf *tls.Config) *tls.Config {
+	conf = conf.Clone()
+	roots := conf.RootCAs
+	skipChain := conf.InsecureSkipVerify
+	verifyConnection := conf.VerifyConnection
+	conf.InsecureSkipVerify = true
+	conf.VerifyConnection = func(state tls.ConnectionState) error {
+		if len(state.PeerCertificates) == 0 {
+			return fmt.Errorf("%w: no peer certificate", ErrSIPDomainCertificate)
+		}
+		if verifyConnection != nil {
+			if err := verifyConnection(state); err != nil {
+				return err
+			}
+		}
+		if skipChain {
+			return VerifySIPDomain(state.PeerCertificates[0], state.ServerName)
+		}
+
+		opts := x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: x509.NewCertPool(),
+		}
+		for _, cert := range state.PeerCertificates[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+		if _, err := state.PeerCertificates[0].Verify(opts); err != nil {
+			return err
+		}
+		return VerifySIPDomain(state.PeerCertificates[0], state.ServerName)
+	}
+	return conf
+}
@@ -0,0 +1,118 @@
+package sip
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TLSCertificateReloader keeps certificate loaded from cert and key files,
+// and reloads it without restarting listeners or dropping connections.
+// New certificate is used on next TLS handshake.
+//
+//	r, _ := sip.NewTLSCertificateReloader(certFile, keyFile)
+//	go r.Watch(ctx, time.Minute)
+//	conf := &tls.Config{GetCertificate: r.GetCertificate}
+type TLSCertificateReloader struct {
+	certFile string
+	keyFile  string
+
+	cert    atomic.Pointer[tls.Certificate]
+	mu      sync.Mutex
+	modTime time.Time
+}
+
+// NewTLSCertificateReloader loads certificate from files. Error is returned if initial load fails
+func NewTLSCertificateReloader(certFile string, keyFile string) (*TLSCertificateReloader, error) {
+	r := &TLSCertificateReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload loads certificate from files. On failure current certificate is kept
+func (r *TLSCertificateReloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	modTime, err := r.filesModTime()
+	if err != nil {
+		return err
+	}
+	return r.load(modTime)
+}
+
+func (r *TLSCertificateReloader) load(modTime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("fail to load cert. err=%w", err)
+	}
+	r.cert.Store(&cert)
+	r.modTime = modTime
+	return nil
+}
+
+func (r *TLSCertificateReloader) filesModTime() (time.Time, error) {
+	var modTime time.Time
+	for _, f := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(f)
+		if err != nil {
+			return modTime, err
+		}
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+	return modTime, nil
+}
+
+// Watch checks files for modification on every interval and reloads certificate on change.
+// It blocks until context is done
+func (r *TLSCertificateReloader) Watch(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		r.mu.Lock()
+		modTime, err := r.filesModTime()
+		if err == nil && modTime.After(r.modTime) {
+			err = r.load(modTime)
+			if err == nil {
+				DefaultLogger().Info("TLS certificate reloaded", "cert", r.certFile)
+			}
+		}
+		r.mu.Unlock()
+
+		if err != nil {
+			DefaultLogger().Error("TLS certificate reload failed", "cert", r.certFile, "error", err)
+		}
+	}
+}
+
+// Certificate returns currently loaded certificate
+func (r *TLSCertificateReloader) Certificate() *tls.Certificate {
+	return r.cert.Load()
+}
+
+// GetCertificate can be set as tls.Config GetCertificate for listeners
+func (r *TLSCertificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.cert.Load(), nil
+}
+
+// GetClientCertificate can be set as tls.Config GetClientCertificate for dialing with client certificate
+func (r *TLSCertificateReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.cert.Load(), nil
+}
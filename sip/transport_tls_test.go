@@ -0,0 +1,289 @@
+package sip
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testTLSCertificate(t *testing.T, tmpl *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (tls.Certificate, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl.SerialNumber = big.NewInt(time.Now().UnixNano())
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}, cert
+}
+
+func testTLSCA(t *testing.T) (*x509.Certificate, *ecdsa.PrivateKey) {
+	tlsCert, cert := testTLSCertificate(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "sipgo test CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, nil)
+	return cert, tlsCert.PrivateKey.(*ecdsa.PrivateKey)
+}
+
+func TestVerifySIPDomain(t *testing.T) {
+	_, cert := testTLSCertificate(t, &x509.Certificate{
+		Subject: pkix.Name{CommonName: "cn.example.com"},
+		URIs: []*url.URL{
+			{Scheme: "sip", Opaque: "sip.example.com"},
+			{Scheme: "sip", Opaque: "alice@example.com"},
+			{Scheme: "https", Host: "web.example.com"},
+		},
+		DNSNames: []string{"Proxy.Example.com", "*.example.org"},
+	}, nil, nil)
+
+	assert.Equal(t, []string{"sip.example.com", "proxy.example.com", "*.example.org"}, SIPDomainIdentities(cert))
+
+	assert.NoError(t, VerifySIPDomain(cert, "sip.example.com"))
+	assert.NoError(t, VerifySIPDomain(cert, "PROXY.example.com."))
+	// User part URI, other schemes and CN when SAN present must not match
+	assert.ErrorIs(t, VerifySIPDomain(cert, "example.com"), ErrSIPDomainCertificate)
+	assert.ErrorIs(t, VerifySIPDomain(cert, "web.example.com"), ErrSIPDomainCertificate)
+	assert.ErrorIs(t, VerifySIPDomain(cert, "cn.example.com"), ErrSIPDomainCertificate)
+	// No wildcard matching
+	assert.ErrorIs(t, VerifySIPDomain(cert, "sip.example.org"), ErrSIPDomainCertificate)
+
+	_, cnOnly := testTLSCertificate(t, &x509.Certificate{
+		Subject: pkix.Name{CommonName: "cn.example.com"},
+	}, nil, nil)
+	assert.NoError(t, VerifySIPDomain(cnOnly, "cn.example.com"))
+
+	assert.ErrorIs(t, VerifyPeerSIPDomain(nil, "cn.example.com"), ErrSIPDomainCertificate)
+}
+
+func TestTransportTLSPeerIdentity(t *testing.T) {
+	ca, caKey := testTLSCA(t)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	// Server identity is only in SIP URI, so standard hostname verification would fail
+	serverCert, _ := testTLSCertificate(t, &x509.Certificate{
+		URIs:        []*url.URL{{Scheme: "sip", Opaque: "sip.example.com"}},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca, caKey)
+	clientCert, _ := testTLSCertificate(t, &x509.Certificate{
+		URIs:        []*url.URL{{Scheme: "sip", Opaque: "trunk.example.com"}},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, caKey)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	l := tls.NewListener(ln, &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientCAs:    roots,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})
+	defer l.Close()
+
+	server := &TransportTLS{TransportTCP: &TransportTCP{}}
+	server.init(NewParser(), &tls.Config{})
+	defer server.Close()
+
+	received := make(chan *Request, 1)
+	go server.Serve(l, func(msg Message) {
+		if req, ok := msg.(*Request); ok {
+			received <- req
+		}
+	})
+
+	dial := func(conf *tls.Config, hostname string) (Connection, error) {
+		client := &TransportTLS{TransportTCP: &TransportTCP{}}
+		client.init(NewParser(), conf)
+		t.Cleanup(func() { client.Close() })
+
+		host, port, err := ParseAddr(ln.Addr().String())
+		require.NoError(t, err)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return client.CreateConnection(ctx, Addr{}, Addr{IP: net.ParseIP(host), Port: port, Hostname: hostname}, func(msg Message) {})
+	}
+
+	clientConf := &tls.Config{
+		RootCAs:      roots,
+		Certificates: []tls.Certificate{clientCert},
+	}
+
+	t.Run("WrongDomain", func(t *testing.T) {
+		_, err := dial(TLSConfigVerifySIPDomain(clientConf), "other.example.com")
+		require.ErrorIs(t, err, ErrSIPDomainCertificate)
+	})
+
+	t.Run("Verified", func(t *testing.T) {
+		conn, err := dial(TLSConfigVerifySIPDomain(clientConf), "sip.example.com")
+		require.NoError(t, err)
+
+		state := conn.(TLSConnection).TLSConnectionState()
+		require.NotNil(t, state)
+		require.NoError(t, VerifyPeerSIPDomain(state, "sip.example.com"))
+
+		req := testCreateRequest(t, "OPTIONS", "sip:bob@sip.example.com", "TLS", "trunk.example.com")
+		require.NoError(t, conn.WriteMsg(req))
+
+		select {
+		case msg := <-received:
+			require.NotNil(t, msg.TLS())
+			assert.NoError(t, VerifyPeerSIPDomain(msg.TLS(), msg.From().Address.Host))
+			assert.ErrorIs(t, VerifyPeerSIPDomain(msg.TLS(), "sip.example.com"), ErrSIPDomainCertificate)
+		case <-time.After(5 * time.Second):
+			t.Fatal("message not received")
+		}
+	})
+}
+
+func testWriteTLSCertificate(t *testing.T, dir string, cert tls.Certificate) (string, string) {
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+
+	keyDer, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	return certFile, keyFile
+}
+
+func TestTLSCertificateReloader(t *testing.T) {
+	dir := t.TempDir()
+	first, _ := testTLSCertificate(t, &x509.Certificate{DNSNames: []string{"first.example.com"}}, nil, nil)
+	certFile, keyFile := testWriteTLSCertificate(t, dir, first)
+
+	r, err := NewTLSCertificateReloader(certFile, keyFile)
+	require.NoError(t, err)
+	assert.Equal(t, first.Certificate[0], r.Certificate().Certificate[0])
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	l := tls.NewListener(ln, &tls.Config{GetCertificate: r.GetCertificate})
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				conn.(*tls.Conn).Handshake()
+				conn.Close()
+			}()
+		}
+	}()
+
+	peerCert := func() *x509.Certificate {
+		conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+		require.NoError(t, err)
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0]
+	}
+	assert.Equal(t, []string{"first.example.com"}, peerCert().DNSNames)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Watch(ctx, 10*time.Millisecond)
+
+	second, _ := testTLSCertificate(t, &x509.Certificate{DNSNames: []string{"second.example.com"}}, nil, nil)
+	testWriteTLSCertificate(t, dir, second)
+	// Make sure modification time is changed on coarse filesystems
+	future := time.Now().Add(time.Second)
+	require.NoError(t, os.Chtimes(certFile, future, future))
+
+	require.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual(second.Certificate[0], r.Certificate().Certificate[0])
+	}, 2*time.Second, 10*time.Millisecond)
+	// Same listener now serves new certificate
+	assert.Equal(t, []string{"second.example.com"}, peerCert().DNSNames)
+
+	// Broken files keep current certificate
+	require.NoError(t, os.WriteFile(keyFile, []byte("broken"), 0600))
+	require.Error(t, r.Reload())
+	assert.Equal(t, second.Certificate[0], r.Certificate().Certificate[0])
+}
+
+func TestTransportTLSClientConfig(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	serverCert, _ := testTLSCertificate(t, &x509.Certificate{DNSNames: []string{"carrier-a.example.com"}}, nil, nil)
+	clientCertA, _ := testTLSCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "trunk-a"}}, nil, nil)
+
+	type hello struct {
+		serverName string
+		clientCN   string
+	}
+	hellos := make(chan hello, 1)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			tlsConn := tls.Server(conn, &tls.Config{
+				Certificates: []tls.Certificate{serverCert},
+				ClientAuth:   tls.RequireAnyClientCert,
+			})
+			if err := tlsConn.Handshake(); err != nil {
+				conn.Close()
+				continue
+			}
+			state := tlsConn.ConnectionState()
+			hellos <- hello{serverName: state.ServerName, clientCN: state.PeerCertificates[0].Subject.CommonName}
+		}
+	}()
+
+	tp := NewTransportLayer(net.DefaultResolver, NewParser(), nil,
+		WithTransportLayerTLSClientConfig(func(raddr Addr) (*tls.Config, error) {
+			if raddr.Hostname == "carrier-a.example.com" {
+				return &tls.Config{
+					InsecureSkipVerify: true,
+					Certificates:       []tls.Certificate{clientCertA},
+				}, nil
+			}
+			return nil, fmt.Errorf("no config for %s", raddr.Hostname)
+		}),
+	)
+	defer tp.Close()
+
+	host, port, err := ParseAddr(ln.Addr().String())
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err = tp.tls.CreateConnection(ctx, Addr{}, Addr{IP: net.ParseIP(host), Port: port, Hostname: "carrier-b.example.com"}, func(msg Message) {})
+	require.Error(t, err)
+
+	conn, err := tp.tls.CreateConnection(ctx, Addr{}, Addr{IP: net.ParseIP(host), Port: port, Hostname: "carrier-a.example.com"}, func(msg Message) {})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	h := <-hellos
+	assert.Equal(t, "carrier-a.example.com", h.serverName)
+	assert.Equal(t, "trunk-a", h.clientCN)
+}
@@ -0,0 +1,252 @@
+package sip
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// SIPTraceDirection is direction of traced message
+type SIPTraceDirection int
+
+const (
+	SIPTraceRead SIPTraceDirection = iota + 1
+	SIPTraceWrite
+)
+
+func (d SIPTraceDirection) String() string {
+	switch d {
+	case SIPTraceRead:
+		return "read"
+	case SIPTraceWrite:
+		return "write"
+	}
+	return "unknown"
+}
+
+// SIPTraceEvent is SIP message read or written by transport
+type SIPTraceEvent struct {
+	Direction SIPTraceDirection
+	// Transport is UDP, TCP, TLS, WS, WSS, UNIX or UNIXGRAM
+	Transport  string
+	LocalAddr  string
+	RemoteAddr string
+	// ConnID identifies transport connection. It is unique within process
+	ConnID uint64
+	Time   time.Time
+	// Data is SIP message bytes as read or written, before any parsing or serialization.
+	// Stream (TCP, TLS, UNIX) reads are split per message, and for WS, WSS it is frame payload
+	// without websocket framing. Reads that failed to parse carry whole read.
+	// It is only valid during call and must be copied if kept
+	Data []byte
+	// Msg is parsed message. Nil when message failed to parse. It must not be modified
+	Msg Message
+}
+
+// SIPEventTracer receives every SIP message of transport layer with structured metadata.
+// It is called on hot path and must not block.
+type SIPEventTracer interface {
+	SIPTrace(ev *SIPTraceEvent)
+}
+
+// SIPEventTracerFunc is function implementing SIPEventTracer
+type SIPEventTracerFunc func(ev *SIPTraceEvent)
+
+func (f SIPEventTracerFunc) SIPTrace(ev *SIPTraceEvent) {
+	f(ev)
+}
+
+// SIPTraceFilter selects traced messages. Empty field matches all, otherwise all set fields must match
+type SIPTraceFilter struct {
+	CallIDs []string
+	// Methods matches requests by method and responses by CSeq method
+	Methods []RequestMethod
+	// Addrs matches local or remote address, as IP or IP:port
+	Addrs []string
+}
+
+// Match returns true if event passes filter
+func (f *SIPTraceFilter) Match(ev *SIPTraceEvent) bool {
+	if len(f.CallIDs) > 0 {
+		var callID string
+		if ev.Msg != nil {
+			if h := ev.Msg.CallID(); h != nil {
+				callID = h.Value()
+			}
+		} else {
+			callID = string(sipCallIDBytes(ev.Data))
+		}
+		if !slices.Contains(f.CallIDs, callID) {
+			return false
+		}
+	}
+
+	if len(f.Methods) > 0 {
+		var method RequestMethod
+		switch m := ev.Msg.(type) {
+		case *Request:
+			method = m.Method
+		case *Response:
+			if cseq := m.CSeq(); cseq != nil {
+				method = cseq.MethodName
+			}
+		}
+		if method == "" || !slices.Contains(f.Methods, method) {
+			return false
+		}
+	}
+
+	if len(f.Addrs) > 0 && !f.matchAddr(ev.LocalAddr) && !f.matchAddr(ev.RemoteAddr) {
+		return false
+	}
+	return true
+}
+
+func (f *SIPTraceFilter) matchAddr(addr string) bool {
+	host := addr
+	if h, _, err := net.SplitHostPort(addr); err == nil {
+		host = h
+	}
+	for _, a := range f.Addrs {
+		if a == addr || a == host {
+			return true
+		}
+	}
+	return false
+}
+
+// WithTransportLayerTracer adds tracer receiving every SIP message read or written by transports of this layer.
+// Unlike SIPDebugTracer it is not global and it does not require SIPDebug, so each UserAgent can have own tracing.
+// Option can be passed multiple times to have multiple tracers. Filter can be changed with SetSIPTraceFilter
+func WithTransportLayerTracer(t SIPEventTracer) TransportLayerOption {
+	return func(l *TransportLayer) {
+		l.tracers = append(l.tracers, t)
+	}
+}
+
+// WithTransportLayerSIPTracer is WithTransportLayerTracer for tracers with raw SIPTracer interface
+func WithTransportLayerSIPTracer(t SIPTracer) TransportLayerOption {
+	if et, ok := t.(SIPEventTracer); ok {
+		return WithTransportLayerTracer(et)
+	}
+	return WithTransportLayerTracer(SIPEventTracerFunc(func(ev *SIPTraceEvent) {
+		if ev.Direction == SIPTraceRead {
+			t.SIPTraceRead(ev.Transport, ev.LocalAddr, ev.RemoteAddr, ev.Data)
+			return
+		}
+		t.SIPTraceWrite(ev.Transport, ev.LocalAddr, ev.RemoteAddr, ev.Data)
+	}))
+}
+
+// SetSIPTraceFilter changes filter of layer tracers at runtime. Nil traces all messages
+func (l *TransportLayer) SetSIPTraceFilter(f *SIPTraceFilter) {
+	l.trace.filter.Store(f)
+}
+
+// NewSIPTraceLogger returns tracer logging messages with structured attributes on debug level
+func NewSIPTraceLogger(log *slog.Logger) SIPEventTracer {
+	return SIPEventTracerFunc(func(ev *SIPTraceEvent) {
+		if !log.Enabled(context.Background(), slog.LevelDebug) {
+			return
+		}
+		log.Debug("SIP "+ev.Direction.String(),
+			"transport", ev.Transport,
+			"laddr", ev.LocalAddr,
+			"raddr", ev.RemoteAddr,
+			"conn", ev.ConnID,
+			"msg", string(ev.Data),
+		)
+	})
+}
+
+// layerTrace is tracing state shared by transports of layer.
+// It also carries layer metrics as they are reported on same read and write points
+type layerTrace struct {
+	tracers []SIPEventTracer
+	filter  atomic.Pointer[SIPTraceFilter]
+	metrics Metrics
+}
+
+// connTraceID generates connection IDs
+var connTraceID atomic.Uint64
+
+// connTrace passes messages of transport connection to layer tracers and metrics. Nil is no tracing
+type connTrace struct {
+	layer     *layerTrace
+	transport string
+	id        uint64
+}
+
+func newConnTrace(layer *layerTrace, transport string) *connTrace {
+	if len(layer.tracers) == 0 && layer.metrics == nil {
+		return nil
+	}
+	return &connTrace{layer: layer, transport: transport}
+}
+
+// conn returns trace for new connection
+func (t *connTrace) conn() *connTrace {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	c.id = connTraceID.Add(1)
+	return &c
+}
+
+// traced returns true if there are tracers needing message data
+func (t *connTrace) traced() bool {
+	return t != nil && len(t.layer.tracers) > 0
+}
+
+func (t *connTrace) read(laddr net.Addr, raddr string, data []byte, msg Message) {
+	if t == nil {
+		return
+	}
+	if m := t.layer.metrics; m != nil {
+		if msg == nil {
+			m.ParseError(t.transport)
+		} else {
+			metricsMessage(m, true, t.transport, msg)
+		}
+	}
+	if len(t.layer.tracers) == 0 {
+		return
+	}
+	t.trace(SIPTraceRead, laddr.String(), raddr, data, msg)
+}
+
+func (t *connTrace) write(laddr net.Addr, raddr net.Addr, data []byte, msg Message) {
+	if t == nil {
+		return
+	}
+	if m := t.layer.metrics; m != nil {
+		metricsMessage(m, false, t.transport, msg)
+	}
+	if len(t.layer.tracers) == 0 {
+		return
+	}
+	t.trace(SIPTraceWrite, laddr.String(), raddr.String(), data, msg)
+}
+
+func (t *connTrace) trace(dir SIPTraceDirection, laddr string, raddr string, data []byte, msg Message) {
+	ev := SIPTraceEvent{
+		Direction:  dir,
+		Transport:  t.transport,
+		LocalAddr:  laddr,
+		RemoteAddr: raddr,
+		ConnID:     t.id,
+		Time:       time.Now(),
+		Data:       data,
+		Msg:        msg,
+	}
+	if f := t.layer.filter.Load(); f != nil && !f.Match(&ev) {
+		return
+	}
+	for _, tr := range t.layer.tracers {
+		tr.SIPTrace(&ev)
+	}
+}
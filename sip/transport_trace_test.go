@@ -0,0 +1,156 @@
+package sip
+
+import (
+	"bytes"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testTraceEvents struct {
+	mu     sync.Mutex
+	events []SIPTraceEvent
+}
+
+func (e *testTraceEvents) SIPTrace(ev *SIPTraceEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	c := *ev
+	// Data is valid only during call
+	c.Data = bytes.Clone(ev.Data)
+	e.events = append(e.events, c)
+}
+
+func (e *testTraceEvents) get() []SIPTraceEvent {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]SIPTraceEvent(nil), e.events...)
+}
+
+func TestTransportLayerTracer(t *testing.T) {
+	traced := &testTraceEvents{}
+	other := &testTraceEvents{}
+
+	tp := NewTransportLayer(net.DefaultResolver, NewParser(), nil, WithTransportLayerTracer(traced))
+	defer tp.Close()
+	// Other layer in same process has own tracing
+	tpOther := NewTransportLayer(net.DefaultResolver, NewParser(), nil, WithTransportLayerTracer(other))
+	defer tpOther.Close()
+
+	tp.OnMessage(func(msg Message) {
+		req := msg.(*Request)
+		res := NewResponseFromRequest(req, 200, "OK", nil)
+		require.NoError(t, tp.WriteMsg(res))
+	})
+
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go tp.ServeUDP(l)
+
+	client, err := net.Dial("udp", l.LocalAddr().String())
+	require.NoError(t, err)
+	defer client.Close()
+
+	send := func(req *Request) {
+		_, err = client.Write([]byte(req.String()))
+		require.NoError(t, err)
+		client.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, err = client.Read(make([]byte, 2048))
+		require.NoError(t, err)
+	}
+
+	req := testCreateRequest(t, "OPTIONS", "sip:bob@127.0.0.1", "UDP", client.LocalAddr().String())
+	send(req)
+
+	require.Eventually(t, func() bool { return len(traced.get()) == 2 }, time.Second, 10*time.Millisecond)
+	events := traced.get()
+	read, write := events[0], events[1]
+	assert.Equal(t, SIPTraceRead, read.Direction)
+	assert.Equal(t, "UDP", read.Transport)
+	assert.Equal(t, l.LocalAddr().String(), read.LocalAddr)
+	assert.Equal(t, client.LocalAddr().String(), read.RemoteAddr)
+	assert.NotZero(t, read.ConnID)
+	assert.False(t, read.Time.IsZero())
+	require.NotNil(t, read.Msg)
+	assert.Equal(t, req.CallID().Value(), read.Msg.CallID().Value())
+
+	assert.Equal(t, SIPTraceWrite, write.Direction)
+	assert.Equal(t, read.ConnID, write.ConnID)
+	assert.IsType(t, &Response{}, write.Msg)
+	assert.Empty(t, other.get())
+
+	// Runtime filter
+	tp.SetSIPTraceFilter(&SIPTraceFilter{CallIDs: []string{"other"}})
+	send(testCreateRequest(t, "OPTIONS", "sip:bob@127.0.0.1", "UDP", client.LocalAddr().String()))
+	tp.SetSIPTraceFilter(&SIPTraceFilter{Methods: []RequestMethod{INVITE}, Addrs: []string{"127.0.0.1"}})
+	invite, _, _ := testCreateInvite(t, "sip:bob@127.0.0.1", "UDP", client.LocalAddr().String())
+	send(invite)
+	require.Eventually(t, func() bool { return len(traced.get()) == 4 }, time.Second, 10*time.Millisecond)
+}
+
+func TestTransportLayerTracerStream(t *testing.T) {
+	traced := &testTraceEvents{}
+	tp := NewTransportLayer(net.DefaultResolver, NewParser(), nil, WithTransportLayerTracer(traced))
+	defer tp.Close()
+	tp.OnMessage(func(msg Message) {})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go tp.ServeTCP(l)
+
+	client, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer client.Close()
+
+	// Compact and oddly spaced headers are traced as on wire, not as serialized by parser
+	msg := func(method string) string {
+		return method + " sip:bob@127.0.0.1 SIP/2.0\r\n" +
+			"v:  SIP/2.0/TCP " + client.LocalAddr().String() + ";branch=" + GenerateBranch() + "\r\n" +
+			"f: <sip:alice@127.0.0.1>;tag=1\r\n" +
+			"t: <sip:bob@127.0.0.1>\r\n" +
+			"i: stream-trace\r\n" +
+			"CSeq:   1 " + method + "\r\n" +
+			"l: 4\r\n" +
+			"\r\n" +
+			"body"
+	}
+	first, second := msg("OPTIONS"), msg("INFO")
+	// Second message is split over reads
+	_, err = client.Write([]byte(first + second[:20]))
+	require.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+	_, err = client.Write([]byte(second[20:]))
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool { return len(traced.get()) == 2 }, time.Second, 10*time.Millisecond)
+	events := traced.get()
+	assert.Equal(t, first, string(events[0].Data))
+	assert.Equal(t, second, string(events[1].Data))
+	assert.Equal(t, "stream-trace", events[1].Msg.CallID().Value())
+}
+
+func TestSIPTraceFilter(t *testing.T) {
+	req := testCreateRequest(t, "INVITE", "sip:bob@127.0.0.1", "UDP", "10.0.0.1:5060")
+	res := NewResponseFromRequest(req, 200, "OK", nil)
+	ev := func(msg Message) *SIPTraceEvent {
+		return &SIPTraceEvent{Msg: msg, Data: []byte(msg.String()), LocalAddr: "10.0.0.2:5060", RemoteAddr: "10.0.0.1:5060"}
+	}
+
+	assert.True(t, (&SIPTraceFilter{}).Match(ev(req)))
+	assert.True(t, (&SIPTraceFilter{Methods: []RequestMethod{INVITE}}).Match(ev(res)))
+	assert.False(t, (&SIPTraceFilter{Methods: []RequestMethod{BYE}}).Match(ev(req)))
+	assert.True(t, (&SIPTraceFilter{CallIDs: []string{req.CallID().Value()}}).Match(ev(req)))
+	assert.True(t, (&SIPTraceFilter{Addrs: []string{"10.0.0.1:5060"}}).Match(ev(req)))
+	assert.False(t, (&SIPTraceFilter{Addrs: []string{"10.0.0.3"}}).Match(ev(req)))
+
+	// Unparsed message still matches by Call-ID
+	raw := ev(req)
+	raw.Msg = nil
+	assert.True(t, (&SIPTraceFilter{CallIDs: []string{req.CallID().Value()}}).Match(raw))
+}
@@ -8,6 +8,7 @@ import (
 	"log/slog"
 	"net"
 	"sync"
+	"syscall"
 )
 
 var (
@@ -19,16 +20,31 @@ var (
 // UDP transport implementation
 type TransportUDP struct {
 	// listener *net.UDPConn
+	transport       string
 	parser          *Parser
 	pool            *connectionPool
 	log             *slog.Logger
 	connectionReuse bool
 	readFilter      TransportReadFilter
+	rateLimiter     *TransportRateLimiter
+	trace           *connTrace
+
+	// ReadBatchSize enables reading multiple datagrams with single syscall on listeners
+	// (recvmmsg on Linux). Values <= 1 read one datagram at a time
+	ReadBatchSize int
+
+	// WriteBatchSize enables sending up to size concurrently written datagrams with single syscall
+	// (sendmmsg on Linux). Values <= 1 write one datagram at a time
+	WriteBatchSize int
+
+	// SocketOptions are applied on client created sockets
+	SocketOptions *SocketOptions
 }
 
 func (t *TransportUDP) init(par *Parser) {
 	t.parser = par
 	t.pool = newConnectionPool()
+	t.transport = "UDP"
 	if t.log == nil {
 		t.log = DefaultLogger()
 	}
@@ -39,7 +55,7 @@ func (t *TransportUDP) String() string {
 }
 
 func (t *TransportUDP) Network() string {
-	return "UDP"
+	return t.transport
 }
 
 func (t *TransportUDP) Close() error {
@@ -47,6 +63,47 @@ func (t *TransportUDP) Close() error {
 	// Closing listeners is caller thing.
 }
 
+// ListenUDPReusePort opens number of UDP sockets bound to same address with SO_REUSEPORT,
+// so each can be served by own reader. Kernel distributes datagrams by source address,
+// which keeps same peer on same socket. If port is 0, all sockets are bound to port picked by first one.
+// Supported only on unix systems.
+func ListenUDPReusePort(ctx context.Context, network string, addr string, sockets int) ([]net.PacketConn, error) {
+	return ListenUDPReusePortConfig(ctx, &net.ListenConfig{}, network, addr, sockets)
+}
+
+// ListenUDPReusePortConfig is ListenUDPReusePort with listen config, for ex. from TransportLayer.ListenConfig
+func ListenUDPReusePortConfig(ctx context.Context, conf *net.ListenConfig, network string, addr string, sockets int) ([]net.PacketConn, error) {
+	lc := *conf
+	lc.Control = func(network, address string, c syscall.RawConn) error {
+		if err := reusePortControl(network, address, c); err != nil {
+			return err
+		}
+		if conf.Control != nil {
+			return conf.Control(network, address, c)
+		}
+		return nil
+	}
+
+	conns := make([]net.PacketConn, 0, sockets)
+	closeAll := func() {
+		for _, c := range conns {
+			c.Close()
+		}
+	}
+	for i := 0; i < sockets; i++ {
+		conn, err := lc.ListenPacket(ctx, network, addr)
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("listen udp reuseport error. err=%w", err)
+		}
+		if i == 0 {
+			addr = conn.LocalAddr().String()
+		}
+		conns = append(conns, conn)
+	}
+	return conns, nil
+}
+
 // ServeConn is direct way to provide conn on which this worker will listen
 func (t *TransportUDP) Serve(conn net.PacketConn, handler MessageHandler) error {
 	t.log.Debug("begin listening", "network", t.Network(), "addr", conn.LocalAddr().String())
@@ -57,9 +114,12 @@ func (t *TransportUDP) Serve(conn net.PacketConn, handler MessageHandler) error
 		PacketConn: conn,
 		PacketAddr: conn.LocalAddr().String(),
 		Listener:   true,
+		trace:      t.trace.conn(),
 	}
+	c.batch = t.newBatchWriter(conn)
 
-	t.pool.Add(c.PacketAddr, c)
+	// Listeners with SO_REUSEPORT share same address
+	t.pool.addListener(c.PacketAddr, c)
 	t.readListenerConnection(c, c.PacketAddr, handler)
 	return nil
 }
@@ -84,7 +144,7 @@ func (t *TransportUDP) CreateConnection(ctx context.Context, laddr Addr, raddr A
 
 func (t *TransportUDP) createConnection(ctx context.Context, laddr Addr, raddr Addr, handler MessageHandler) (Connection, error) {
 	laddrStr := laddr.String()
-	lc := &net.ListenConfig{}
+	lc := t.SocketOptions.ListenConfig()
 
 	protocol := "udp"
 	if laddr.IP == nil && raddr.IP.To4() != nil {
@@ -104,7 +164,9 @@ func (t *TransportUDP) createConnection(ctx context.Context, laddr Addr, raddr A
 			PacketAddr: udpconn.LocalAddr().String(),
 			// 1 ref for current return , 2 ref for reader
 			refcount: 2 + TransportIdleConnection,
+			trace:    t.trace.conn(),
 		}
+		c.batch = t.newBatchWriter(udpconn)
 		t.log.Debug("New connection", "raddr", addr)
 		go t.readUDPConnection(c, addr, c.PacketAddr, handler)
 		return c, nil
@@ -121,8 +183,19 @@ func (t *TransportUDP) readUDPConnection(conn *UDPConnection, raddr string, ladd
 	t.readListenerConnection(conn, laddr, handler)
 }
 
+// newBatchWriter returns batch writer if WriteBatchSize is set and connection supports it
+func (t *TransportUDP) newBatchWriter(conn net.PacketConn) *udpBatchWriter {
+	if udpConn, ok := udpBatchConn(conn, t.WriteBatchSize); ok {
+		return newUDPBatchWriter(udpConn, t.WriteBatchSize)
+	}
+	return nil
+}
+
 func (t *TransportUDP) readListenerConnection(conn *UDPConnection, laddr string, handler MessageHandler) {
-	buf := make([]byte, TransportBufferReadSize)
+	reader := newUDPPacketReader(conn, t.ReadBatchSize)
+	if conn.batch != nil {
+		defer conn.batch.close()
+	}
 	defer func() {
 		if err := t.pool.CloseAndDelete(conn, laddr); err != nil {
 			t.log.Warn("connection pool not clean cleanup", "error", err)
@@ -143,7 +216,7 @@ func (t *TransportUDP) readListenerConnection(conn *UDPConnection, laddr string,
 	}()
 
 	for {
-		num, raddr, err := conn.ReadFrom(buf)
+		data, raddr, err := reader.ReadPacket()
 		if err != nil {
 			if errors.Is(err, net.ErrClosed) {
 				t.log.Debug("Read connection closed", "laddr", laddr, "error", err)
@@ -153,10 +226,21 @@ func (t *TransportUDP) readListenerConnection(conn *UDPConnection, laddr string,
 			return
 		}
 
-		data := buf[:num]
 		if len(bytes.Trim(data, "\x00")) == 0 {
 			continue
 		}
+		if t.rateLimiter != nil {
+			reason := t.rateLimiter.allow(TransportReadProps{
+				Transport:  t.Network(),
+				LocalAddr:  conn.LocalAddr(),
+				RemoteAddr: raddr,
+			})
+			if reason != 0 {
+				// Never answer, as source can be spoofed
+				continue
+			}
+		}
+
 		rastr := raddr.String()
 		if t.readFilter != nil {
 			filtered, err := t.readFilter(TransportReadProps{
@@ -181,7 +265,7 @@ func (t *TransportUDP) readListenerConnection(conn *UDPConnection, laddr string,
 			acceptedAddr[rastr] = struct{}{}
 		}
 
-		t.parseAndHandle(data, rastr, handler)
+		t.parseAndHandle(data, rastr, conn.trace, conn.LocalAddr(), handler)
 		lastRaddr = rastr
 	}
 }
@@ -214,7 +298,7 @@ func (t *TransportUDP) readListenerConnection(conn *UDPConnection, laddr string,
 	}
 } */
 
-func (t *TransportUDP) parseAndHandle(data []byte, src string, handler MessageHandler) {
+func (t *TransportUDP) parseAndHandle(data []byte, src string, trace *connTrace, laddr net.Addr, handler MessageHandler) {
 	// Check is keep alive
 	if len(data) <= 4 {
 		//One or 2 CRLF
@@ -226,9 +310,11 @@ func (t *TransportUDP) parseAndHandle(data []byte, src string, handler MessageHa
 
 	msg, err := t.parser.ParseSIP(data) //Very expensive operation
 	if err != nil {
+		trace.read(laddr, src, data, nil)
 		t.log.Error("failed to parse", "data", string(data), "error", err)
 		return
 	}
+	trace.read(laddr, src, data, msg)
 
 	msg.SetTransport(t.Network())
 	// Current transaction are taking connection but for UDP they can forward on different src address
@@ -243,6 +329,9 @@ type UDPConnection struct {
 
 	mu       sync.RWMutex
 	refcount int
+	trace    *connTrace
+	// batch sends writes with sendmmsg when set
+	batch *udpBatchWriter
 }
 
 func (c *UDPConnection) close() error {
@@ -310,7 +399,11 @@ func (c *UDPConnection) ReadFrom(b []byte) (n int, addr net.Addr, err error) {
 
 func (c *UDPConnection) WriteTo(b []byte, addr net.Addr) (n int, err error) {
 	// Some debug hook. TODO move to proper way
-	n, err = c.PacketConn.WriteTo(b, addr)
+	if c.batch != nil {
+		n, err = c.batch.WriteTo(b, addr)
+	} else {
+		n, err = c.PacketConn.WriteTo(b, addr)
+	}
 	if SIPDebug && err == nil {
 		logSIPWrite("UDP", c.PacketConn.LocalAddr().String(), addr.String(), b[:n])
 	}
@@ -355,6 +448,7 @@ func (c *UDPConnection) WriteMsg(msg Message) error {
 	if err != nil {
 		return fmt.Errorf("udp conn %s err. %w", c.PacketConn.LocalAddr().String(), err)
 	}
+	c.trace.write(c.PacketConn.LocalAddr(), &raddr, data[:n], msg)
 
 	if n == 0 {
 		return fmt.Errorf("wrote 0 bytes")
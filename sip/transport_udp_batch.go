@@ -0,0 +1,216 @@
+package sip
+
+import (
+	"net"
+	"runtime"
+	"sync"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// udpPacketReader reads single datagram. Returned data is valid until next read
+type udpPacketReader interface {
+	ReadPacket() ([]byte, net.Addr, error)
+}
+
+type udpSingleReader struct {
+	conn *UDPConnection
+	buf  []byte
+}
+
+func (r *udpSingleReader) ReadPacket() ([]byte, net.Addr, error) {
+	num, raddr, err := r.conn.ReadFrom(r.buf)
+	if err != nil {
+		return nil, nil, err
+	}
+	return r.buf[:num], raddr, nil
+}
+
+// udpBatchReader reads multiple datagrams with single syscall (recvmmsg on Linux)
+// and returns them one by one
+type udpBatchReader struct {
+	conn interface {
+		ReadBatch(ms []ipv4.Message, flags int) (int, error)
+	}
+	msgs  []ipv4.Message
+	n     int
+	i     int
+	laddr string
+}
+
+func newUDPBatchReader(conn *net.UDPConn, size int) *udpBatchReader {
+	r := &udpBatchReader{
+		msgs:  make([]ipv4.Message, size),
+		laddr: conn.LocalAddr().String(),
+	}
+	for i := range r.msgs {
+		r.msgs[i].Buffers = [][]byte{make([]byte, TransportBufferReadSize)}
+	}
+
+	if laddr, ok := conn.LocalAddr().(*net.UDPAddr); ok && laddr.IP.To4() == nil && laddr.IP != nil {
+		r.conn = ipv6.NewPacketConn(conn)
+	} else {
+		r.conn = ipv4.NewPacketConn(conn)
+	}
+	return r
+}
+
+func (r *udpBatchReader) ReadPacket() ([]byte, net.Addr, error) {
+	if r.i >= r.n {
+		n, err := r.conn.ReadBatch(r.msgs, 0)
+		if err != nil {
+			return nil, nil, err
+		}
+		r.n = n
+		r.i = 0
+	}
+
+	msg := r.msgs[r.i]
+	r.i++
+	data := msg.Buffers[0][:msg.N]
+	if SIPDebug {
+		logSIPRead("UDP", r.laddr, msg.Addr.String(), data)
+	}
+	return data, msg.Addr, nil
+}
+
+// udpBatchConn returns UDP socket if batching with size can be used on it.
+// Batch API is not implemented on windows
+func udpBatchConn(conn net.PacketConn, size int) (*net.UDPConn, bool) {
+	udpConn, ok := conn.(*net.UDPConn)
+	return udpConn, ok && size > 1 && runtime.GOOS != "windows"
+}
+
+// newUDPPacketReader returns batch reader if batch size is set and connection supports it
+func newUDPPacketReader(conn *UDPConnection, batchSize int) udpPacketReader {
+	if udpConn, ok := udpBatchConn(conn.PacketConn, batchSize); ok {
+		return newUDPBatchReader(udpConn, batchSize)
+	}
+	return &udpSingleReader{
+		conn: conn,
+		buf:  make([]byte, TransportBufferReadSize),
+	}
+}
+
+// udpBatchWriter sends datagrams written concurrently with single syscall (sendmmsg on Linux).
+// Writes are queued and writer goroutine sends all queued at once, so batching happens
+// only under load and single write is not delayed.
+type udpBatchWriter struct {
+	conn interface {
+		WriteBatch(ms []ipv4.Message, flags int) (int, error)
+	}
+	queue chan *udpBatchWrite
+	msgs  []ipv4.Message
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type udpBatchWrite struct {
+	data []byte
+	addr net.Addr
+	err  chan error
+}
+
+func newUDPBatchWriter(conn *net.UDPConn, size int) *udpBatchWriter {
+	w := &udpBatchWriter{
+		queue: make(chan *udpBatchWrite, size),
+		msgs:  make([]ipv4.Message, size),
+		done:  make(chan struct{}),
+	}
+	if laddr, ok := conn.LocalAddr().(*net.UDPAddr); ok && laddr.IP.To4() == nil && laddr.IP != nil {
+		w.conn = ipv6.NewPacketConn(conn)
+	} else {
+		w.conn = ipv4.NewPacketConn(conn)
+	}
+	go w.run()
+	return w
+}
+
+// WriteTo queues datagram and waits until it is sent
+func (w *udpBatchWriter) WriteTo(b []byte, addr net.Addr) (int, error) {
+	// Caller buffer is reused after return, but write can be still queued
+	req := &udpBatchWrite{
+		data: append([]byte(nil), b...),
+		addr: addr,
+		err:  make(chan error, 1),
+	}
+
+	select {
+	case <-w.done:
+		return 0, net.ErrClosed
+	case w.queue <- req:
+	}
+
+	select {
+	case <-w.done:
+		return 0, net.ErrClosed
+	case err := <-req.err:
+		if err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+}
+
+func (w *udpBatchWriter) run() {
+	batch := make([]*udpBatchWrite, 0, len(w.msgs))
+	for {
+		batch = batch[:0]
+		select {
+		case <-w.done:
+			return
+		case req := <-w.queue:
+			batch = append(batch, req)
+		}
+
+		// Take everything queued meanwhile
+	drain:
+		for len(batch) < len(w.msgs) {
+			select {
+			case req := <-w.queue:
+				batch = append(batch, req)
+			default:
+				break drain
+			}
+		}
+
+		w.write(batch)
+	}
+}
+
+func (w *udpBatchWriter) write(batch []*udpBatchWrite) {
+	msgs := w.msgs[:len(batch)]
+	for i, req := range batch {
+		msgs[i] = ipv4.Message{
+			Buffers: [][]byte{req.data},
+			Addr:    req.addr,
+		}
+	}
+
+	sent := 0
+	for sent < len(msgs) {
+		n, err := w.conn.WriteBatch(msgs[sent:], 0)
+		if err != nil {
+			// Failed datagram gets error and rest is retried
+			batch[sent].err <- err
+			sent++
+			continue
+		}
+		for _, req := range batch[sent : sent+n] {
+			req.err <- nil
+		}
+		sent += n
+	}
+
+	for i := range msgs {
+		msgs[i] = ipv4.Message{}
+	}
+}
+
+func (w *udpBatchWriter) close() {
+	w.closeOnce.Do(func() {
+		close(w.done)
+	})
+}
@@ -0,0 +1,122 @@
+//go:build unix
+
+package sip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListenUDPReusePort(t *testing.T) {
+	conns, err := ListenUDPReusePort(context.Background(), "udp", "127.0.0.1:0", 2)
+	require.NoError(t, err)
+	for _, c := range conns {
+		defer c.Close()
+	}
+	require.Equal(t, conns[0].LocalAddr().String(), conns[1].LocalAddr().String())
+}
+
+func TestUDPBatchReader(t *testing.T) {
+	server, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer server.Close()
+
+	r := newUDPPacketReader(&UDPConnection{PacketConn: server}, 4)
+	require.IsType(t, &udpBatchReader{}, r)
+
+	client, err := net.DialUDP("udp", nil, server.LocalAddr().(*net.UDPAddr))
+	require.NoError(t, err)
+	defer client.Close()
+
+	for i := 0; i < 6; i++ {
+		_, err := client.Write([]byte(fmt.Sprintf("msg-%d", i)))
+		require.NoError(t, err)
+	}
+
+	for i := 0; i < 6; i++ {
+		data, raddr, err := r.ReadPacket()
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("msg-%d", i), string(data))
+		assert.Equal(t, client.LocalAddr().String(), raddr.String())
+	}
+}
+
+func TestUDPBatchWriter(t *testing.T) {
+	server, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer server.Close()
+
+	client, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer client.Close()
+
+	w := newUDPBatchWriter(client, 4)
+	defer w.close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			data := []byte(fmt.Sprintf("msg-%d", i))
+			n, err := w.WriteTo(data, server.LocalAddr())
+			assert.NoError(t, err)
+			assert.Equal(t, len(data), n)
+		}(i)
+	}
+	wg.Wait()
+
+	got := map[string]bool{}
+	buf := make([]byte, 100)
+	server.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for i := 0; i < 10; i++ {
+		n, raddr, err := server.ReadFrom(buf)
+		require.NoError(t, err)
+		assert.Equal(t, client.LocalAddr().String(), raddr.String())
+		got[string(buf[:n])] = true
+	}
+	assert.Len(t, got, 10)
+
+	w.close()
+	_, err = w.WriteTo([]byte("closed"), server.LocalAddr())
+	assert.ErrorIs(t, err, net.ErrClosed)
+}
+
+func TestTransportUDPReusePortListeners(t *testing.T) {
+	tp := NewTransportLayer(net.DefaultResolver, NewParser(), nil)
+	defer tp.Close()
+
+	conns, err := ListenUDPReusePort(context.Background(), "udp", "127.0.0.1:0", 2)
+	require.NoError(t, err)
+	defer conns[1].Close()
+	laddr := conns[0].LocalAddr().String()
+
+	served := make(chan struct{}, 2)
+	for _, c := range conns {
+		go func(c net.PacketConn) {
+			tp.udp.Serve(c, func(msg Message) {})
+			served <- struct{}{}
+		}(c)
+	}
+	require.Eventually(t, func() bool {
+		tp.udp.pool.RLock()
+		defer tp.udp.pool.RUnlock()
+		g, exists := tp.udp.pool.groups[laddr]
+		return exists && len(g.conns) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	// Closing one socket keeps other under listening address
+	conns[0].Close()
+	<-served
+	c := tp.udp.GetConnection(laddr)
+	require.NotNil(t, c)
+	defer c.TryClose()
+	assert.Equal(t, conns[1], c.(*UDPConnection).PacketConn)
+}
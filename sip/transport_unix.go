@@ -0,0 +1,342 @@
+package sip
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// Unix socket hops have no IP:port. Socket path is carried as host part of address
+// with port 0, so it can be used in Via, Contact and as message source.
+// For ex: Via: SIP/2.0/UNIX /run/sipgo/b2bua.sock
+// Contact: <sip:b2bua@/run/sipgo/b2bua.sock;transport=unix>
+//
+// Hosts that are not absolute paths are mapped to path with SocketPath on transport.
+
+var unixConnID atomic.Uint64
+
+// unixAddrString formats unix socket name as host:port address
+func unixAddrString(name string) string {
+	return net.JoinHostPort(name, "0")
+}
+
+func unixSocketPath(mapper func(host string) string, host string) string {
+	if mapper == nil || host == "" || filepath.IsAbs(host) {
+		return host
+	}
+	return mapper(host)
+}
+
+// TransportUnix is unix domain socket stream transport
+type TransportUnix struct {
+	*TransportTCP
+
+	// SocketPath maps SIP host to socket path. Absolute paths are used as is.
+	SocketPath func(host string) string
+}
+
+func (t *TransportUnix) init(par *Parser) {
+	t.TransportTCP.init(par)
+	t.transport = "UNIX"
+}
+
+func (t *TransportUnix) String() string {
+	return "Transport<UNIX>"
+}
+
+// Serve is direct way to provide conn on which this worker will listen
+func (t *TransportUnix) Serve(l net.Listener, handler MessageHandler) error {
+	t.log.Debug("begin listening on", "network", t.Network(), "laddr", l.Addr().String())
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			t.log.Debug("Fail to accept conenction", "error", err)
+			return err
+		}
+
+		// Clients are mostly not bound to path, so we need unique source for matching responses
+		raddr := conn.RemoteAddr().String()
+		if raddr == "" || raddr == "@" {
+			raddr = "unix-" + strconv.FormatUint(unixConnID.Add(1), 10)
+		}
+		t.initConnection(conn, unixAddrString(raddr), handler)
+	}
+}
+
+// CreateConnection dials unix socket. Remote host is socket path
+func (t *TransportUnix) CreateConnection(ctx context.Context, laddr Addr, raddr Addr, handler MessageHandler) (Connection, error) {
+	conn, err := t.pool.addSingleflight(raddr, laddr, t.connectionReuse, func() (Connection, error) {
+		path := unixSocketPath(t.SocketPath, raddr.Hostname)
+		t.log.Debug("Dialing new connection", "raddr", path)
+
+		d := net.Dialer{}
+		conn, err := d.DialContext(ctx, "unix", path)
+		if err != nil {
+			return nil, fmt.Errorf("%s dial err=%w", t, err)
+		}
+
+		c := &TCPConnection{
+			Conn:     conn,
+			refcount: 2 + TransportIdleConnection, // 1 returning + 1 reading + Idle
+			trace:    t.trace.conn(),
+		}
+
+		// Dialed socket is mostly not bound to path, so local address is empty.
+		// Unique key is needed as it is removed from pool on close
+		laddr := c.LocalAddr().String()
+		if laddr == "" || laddr == "@" {
+			laddr = unixAddrString("unix-" + strconv.FormatUint(unixConnID.Add(1), 10))
+		}
+		go t.readConnection(c, laddr, raddr.String(), handler)
+		return c, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// TransportUnixgram is unix domain socket datagram transport
+type TransportUnixgram struct {
+	*TransportUDP
+
+	// SocketPath maps SIP host to socket path. Absolute paths are used as is.
+	SocketPath func(host string) string
+}
+
+func (t *TransportUnixgram) init(par *Parser) {
+	t.TransportUDP.init(par)
+	t.transport = "UNIXGRAM"
+}
+
+func (t *TransportUnixgram) String() string {
+	return "transport<UNIXGRAM>"
+}
+
+// Serve is direct way to provide conn on which this worker will listen
+func (t *TransportUnixgram) Serve(conn net.PacketConn, handler MessageHandler) error {
+	t.log.Debug("begin listening", "network", t.Network(), "addr", conn.LocalAddr().String())
+	c := &UnixgramConnection{
+		PacketConn: conn,
+		Listener:   true,
+		socketPath: t.SocketPath,
+		trace:      t.trace.conn(),
+	}
+
+	laddr := conn.LocalAddr().String()
+	t.pool.Add(laddr, c)
+	t.readConnection(c, laddr, handler)
+	return nil
+}
+
+// CreateConnection creates datagram socket for sending requests.
+// Socket is bound to local host path if provided, otherwise temporary path is used
+// as peer needs our path to send responses.
+func (t *TransportUnixgram) CreateConnection(ctx context.Context, laddr Addr, raddr Addr, handler MessageHandler) (Connection, error) {
+	conn, err := t.pool.addSingleflight(raddr, laddr, t.connectionReuse, func() (Connection, error) {
+		path := unixSocketPath(t.SocketPath, laddr.Hostname)
+		unlink := false
+		if path == "" {
+			path = filepath.Join(os.TempDir(), "sipgo-"+GenerateTagN(16)+".sock")
+			unlink = true
+		}
+
+		lc := &net.ListenConfig{}
+		conn, err := lc.ListenPacket(ctx, "unixgram", path)
+		if err != nil {
+			return nil, err
+		}
+
+		c := &UnixgramConnection{
+			PacketConn: conn,
+			socketPath: t.SocketPath,
+			refcount:   2 + TransportIdleConnection,
+			trace:      t.trace.conn(),
+		}
+		if unlink {
+			c.unlinkPath = path
+		}
+
+		t.log.Debug("New connection", "raddr", raddr.String(), "laddr", path)
+		go func() {
+			defer t.pool.Delete(raddr.String())
+			t.readConnection(c, path, handler)
+		}()
+		return c, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (t *TransportUnixgram) readConnection(conn *UnixgramConnection, laddr string, handler MessageHandler) {
+	buf := make([]byte, TransportBufferReadSize)
+	defer func() {
+		if err := t.pool.CloseAndDelete(conn, laddr); err != nil {
+			t.log.Warn("connection pool not clean cleanup", "error", err)
+		}
+	}()
+	defer t.log.Debug("Read listener connection stopped", "laddr", laddr)
+
+	acceptedAddr := make(map[string]struct{})
+	defer func() {
+		addrs := make([]string, 0, len(acceptedAddr))
+		for addr := range acceptedAddr {
+			addrs = append(addrs, addr)
+		}
+		t.pool.DeleteMultiple(addrs)
+	}()
+
+	for {
+		num, raddr, err := conn.PacketConn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				t.log.Debug("Read connection closed", "laddr", laddr, "error", err)
+				return
+			}
+			t.log.Error("Read connection error", "laddr", laddr, "error", err)
+			return
+		}
+
+		data := buf[:num]
+		if len(bytes.Trim(data, "\x00")) == 0 {
+			continue
+		}
+
+		if t.readFilter != nil {
+			filtered, err := t.readFilter(TransportReadProps{
+				Transport:  t.Network(),
+				LocalAddr:  conn.LocalAddr(),
+				RemoteAddr: raddr,
+			}, data)
+			if err != nil {
+				t.log.Error("Read filter error", "laddr", laddr, "error", err)
+				return
+			}
+			if len(filtered) == 0 {
+				continue
+			}
+			data = filtered
+		}
+
+		// Unbound peers can not receive responses, but we still process message
+		var rastr string
+		if raddr != nil {
+			rastr = raddr.String()
+		}
+		rastr = unixAddrString(rastr)
+		if _, exists := acceptedAddr[rastr]; !exists {
+			t.pool.Add(rastr, conn)
+			acceptedAddr[rastr] = struct{}{}
+		}
+
+		t.parseAndHandle(data, rastr, conn.trace, conn.PacketConn.LocalAddr(), handler)
+	}
+}
+
+type UnixgramConnection struct {
+	PacketConn net.PacketConn
+	Listener   bool
+
+	socketPath func(host string) string
+	unlinkPath string
+
+	mu       sync.RWMutex
+	refcount int
+	trace    *connTrace
+}
+
+func (c *UnixgramConnection) close() error {
+	c.mu.Lock()
+	c.refcount = 0
+	c.mu.Unlock()
+
+	if c.Listener {
+		// Closing is done by caller of Serve
+		return nil
+	}
+	DefaultLogger().Debug("UNIXGRAM reference doing hard close", "ip", c.LocalAddr().String(), "ref", 0)
+	err := c.PacketConn.Close()
+	if c.unlinkPath != "" {
+		os.Remove(c.unlinkPath)
+	}
+	return err
+}
+
+func (c *UnixgramConnection) LocalAddr() net.Addr {
+	return c.PacketConn.LocalAddr()
+}
+
+func (c *UnixgramConnection) Ref(i int) int {
+	c.mu.Lock()
+	c.refcount += i
+	ref := c.refcount
+	c.mu.Unlock()
+	return ref
+}
+
+func (c *UnixgramConnection) Close() error {
+	return c.close()
+}
+
+func (c *UnixgramConnection) TryClose() (int, error) {
+	c.mu.Lock()
+	c.refcount--
+	ref := c.refcount
+	c.mu.Unlock()
+
+	if c.Listener {
+		return ref, nil
+	}
+
+	if ref > 0 {
+		return ref, nil
+	}
+
+	if ref < 0 {
+		DefaultLogger().Warn("UNIXGRAM ref went negative on try close", "src", c.LocalAddr().String(), "ref", ref)
+		return 0, nil
+	}
+
+	return ref, c.close()
+}
+
+func (c *UnixgramConnection) WriteMsg(msg Message) error {
+	buf := bufPool.Get().(*bytes.Buffer)
+	defer bufPool.Put(buf)
+	buf.Reset()
+	msg.StringWrite(buf)
+	data := buf.Bytes()
+
+	host, _, err := ParseAddr(msg.Destination())
+	if err != nil {
+		return err
+	}
+
+	raddr := &net.UnixAddr{
+		Name: unixSocketPath(c.socketPath, host),
+		Net:  "unixgram",
+	}
+
+	n, err := c.PacketConn.WriteTo(data, raddr)
+	if err != nil {
+		return fmt.Errorf("unixgram conn %s err. %w", c.PacketConn.LocalAddr().String(), err)
+	}
+	c.trace.write(c.PacketConn.LocalAddr(), raddr, data[:n], msg)
+	if SIPDebug {
+		logSIPWrite("UNIXGRAM", c.PacketConn.LocalAddr().String(), raddr.String(), data[:n])
+	}
+
+	if n != len(data) {
+		return fmt.Errorf("fail to write full message")
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package sip
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransportUnixClientConnections(t *testing.T) {
+	// Socket paths have length limit so we avoid long test temp dirs
+	dir, err := os.MkdirTemp("", "sipgo")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	tp := NewTransportLayer(net.DefaultResolver, NewParser(), nil)
+	defer tp.Close()
+
+	listen := func(name string) Addr {
+		path := filepath.Join(dir, name)
+		l, err := net.Listen("unix", path)
+		require.NoError(t, err)
+		t.Cleanup(func() { l.Close() })
+		go func() {
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				t.Cleanup(func() { conn.Close() })
+			}
+		}()
+		return Addr{Hostname: path}
+	}
+
+	raddr1 := listen("a.sock")
+	raddr2 := listen("b.sock")
+	c1, err := tp.unix.CreateConnection(context.TODO(), Addr{}, raddr1, tp.handleMessage)
+	require.NoError(t, err)
+	c2, err := tp.unix.CreateConnection(context.TODO(), Addr{}, raddr2, tp.handleMessage)
+	require.NoError(t, err)
+
+	// Closing one client connection must not remove other from pool
+	require.NoError(t, c1.Close())
+	require.Eventually(t, func() bool {
+		return tp.unix.GetConnection(raddr1.String()) == nil
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, c2, tp.unix.GetConnection(raddr2.String()))
+}
+
+func TestTransportUnixRequestResponse(t *testing.T) {
+	// Socket paths have length limit so we avoid long test temp dirs
+	dir, err := os.MkdirTemp("", "sipgo")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	socketPath := func(host string) string {
+		return filepath.Join(dir, host+".sock")
+	}
+
+	for _, network := range []string{"unix", "unixgram"} {
+		t.Run(network, func(t *testing.T) {
+			srv := NewTransportLayer(net.DefaultResolver, NewParser(), nil)
+			defer srv.Close()
+			srv.OnMessage(func(msg Message) {
+				req, ok := msg.(*Request)
+				if !ok {
+					return
+				}
+				res := NewResponseFromRequest(req, 200, "OK", nil)
+				assert.NoError(t, srv.WriteMsg(res))
+			})
+
+			path := socketPath(network + "-srv")
+			if network == "unix" {
+				l, err := net.Listen("unix", path)
+				require.NoError(t, err)
+				defer l.Close()
+				go srv.ServeUnix(l)
+			} else {
+				conn, err := net.ListenPacket("unixgram", path)
+				require.NoError(t, err)
+				defer conn.Close()
+				go srv.ServeUnixgram(conn)
+			}
+
+			client := NewTransportLayer(net.DefaultResolver, NewParser(), nil)
+			client.unix.SocketPath = socketPath
+			client.unixgram.SocketPath = socketPath
+			responses := make(chan *Response, 1)
+			client.OnMessage(func(msg Message) {
+				if res, ok := msg.(*Response); ok {
+					responses <- res
+				}
+			})
+
+			// Host is not absolute path so it is mapped with SocketPath
+			req := testCreateRequest(t, "OPTIONS", "sip:bob@"+network+"-srv", NetworkToUpper(network), "localhost")
+			req.CSeq().MethodName = OPTIONS
+
+			conn, err := client.ClientRequestConnection(context.TODO(), req)
+			require.NoError(t, err)
+			require.NoError(t, conn.WriteMsg(req))
+
+			select {
+			case res := <-responses:
+				assert.Equal(t, 200, res.StatusCode)
+				assert.Equal(t, req.CallID().Value(), res.CallID().Value())
+			case <-time.After(2 * time.Second):
+				t.Fatal("expected response over " + network)
+			}
+
+			// Temporary unixgram client socket is removed on close
+			laddr := conn.LocalAddr().String()
+			require.NoError(t, client.Close())
+			if network == "unixgram" {
+				_, err := os.Stat(laddr)
+				assert.True(t, os.IsNotExist(err), "expected %s to be removed", laddr)
+			}
+		})
+	}
+}
+
+func TestTransportUnixReliable(t *testing.T) {
+	tp := NewTransportLayer(net.DefaultResolver, NewParser(), nil)
+	defer tp.Close()
+
+	assert.True(t, tp.IsReliable("unix"))
+	assert.True(t, tp.IsReliable("UNIX"))
+	assert.False(t, tp.IsReliable("unixgram"))
+	assert.False(t, tp.IsReliable("UNIXGRAM"))
+	assert.Equal(t, "unix", NetworkToLower("UNIX"))
+	assert.Equal(t, "unixgram", NetworkToLower("UNIXGRAM"))
+}
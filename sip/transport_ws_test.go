@@ -0,0 +1,271 @@
+package sip
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransportWSHandshake(t *testing.T) {
+	tr := &TransportWS{
+		AllowedOrigins:   []string{"https://example.com"},
+		ProtocolRequired: true,
+		OnUpgrade: func(header http.Header) (http.Header, error) {
+			return http.Header{"X-Server": []string{"sipgo"}}, nil
+		},
+	}
+	tr.init(NewParser())
+
+	t.Run("Negotiated", func(t *testing.T) {
+		h, err := tr.handshake(http.Header{
+			"Origin":                 {"https://example.com"},
+			"Sec-Websocket-Protocol": {"chat, sip"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "sip", h.Get("Sec-WebSocket-Protocol"))
+		assert.Equal(t, "sipgo", h.Get("X-Server"))
+	})
+
+	t.Run("MissingProtocol", func(t *testing.T) {
+		_, err := tr.handshake(http.Header{
+			"Origin": {"https://example.com"},
+		})
+		var herr *wsHandshakeError
+		require.ErrorAs(t, err, &herr)
+		assert.Equal(t, http.StatusBadRequest, herr.status)
+	})
+
+	t.Run("NotRequired", func(t *testing.T) {
+		tr := &TransportWS{Protocols: []string{"sip", "sip.v2"}}
+		tr.init(NewParser())
+		h, err := tr.handshake(http.Header{"Sec-Websocket-Protocol": {"chat"}})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"sip"}, h.Values("Sec-WebSocket-Protocol"), "only single protocol can be returned")
+	})
+
+	t.Run("OriginNotAllowed", func(t *testing.T) {
+		_, err := tr.handshake(http.Header{
+			"Origin":                 {"https://evil.com"},
+			"Sec-Websocket-Protocol": {"sip"},
+		})
+		var herr *wsHandshakeError
+		require.ErrorAs(t, err, &herr)
+		assert.Equal(t, http.StatusForbidden, herr.status)
+	})
+}
+
+func TestTransportWSDialProxy(t *testing.T) {
+	tp := NewTransportLayer(net.DefaultResolver, NewParser(), nil)
+	defer tp.Close()
+
+	upgraded := make(chan http.Header, 1)
+	tp.ws.OnUpgrade = func(header http.Header) (http.Header, error) {
+		upgraded <- header
+		return nil, nil
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/sip", tp.WSHandler())
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	// Simple CONNECT proxy
+	proxyConnects := make(chan string, 1)
+	proxyL, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer proxyL.Close()
+	go func() {
+		conn, err := proxyL.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		req, err := http.ReadRequest(bufio.NewReader(conn))
+		if err != nil {
+			return
+		}
+		proxyConnects <- req.Method + " " + req.Host + " " + req.Header.Get("Proxy-Authorization")
+
+		dst, err := net.Dial("tcp", req.Host)
+		if err != nil {
+			return
+		}
+		defer dst.Close()
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		go io.Copy(dst, conn)
+		io.Copy(conn, dst)
+	}()
+
+	client := &TransportWS{
+		DialHeader: http.Header{"Authorization": {"Bearer token"}},
+		DialProxy:  &url.URL{Scheme: "http", Host: proxyL.Addr().String(), User: url.UserPassword("user", "pass")},
+		DialURI:    func(host string) string { return "ws://" + host + "/sip?tenant=a" },
+	}
+	client.init(NewParser())
+	defer client.Close()
+
+	host, port, err := ParseAddr(srv.Listener.Addr().String())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := client.CreateConnection(ctx, Addr{}, Addr{IP: net.ParseIP(host), Port: port}, func(msg Message) {})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	assert.Equal(t, "CONNECT "+srv.Listener.Addr().String()+" Basic dXNlcjpwYXNz", <-proxyConnects)
+
+	header := <-upgraded
+	assert.Equal(t, "Bearer token", header.Get("Authorization"))
+	assert.Equal(t, "sip", header.Get("Sec-WebSocket-Protocol"))
+}
+
+func TestTransportWSPingLiveness(t *testing.T) {
+	tr := &TransportWS{
+		PingInterval: 50 * time.Millisecond,
+		PingTimeout:  50 * time.Millisecond,
+	}
+	tr.init(NewParser())
+
+	closed := make(chan Connection, 1)
+	tr.onConnClose = func(conn Connection) {
+		closed <- conn
+	}
+
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+
+	c := tr.initConnection(serverConn, "127.0.0.2:5060", false, nil, func(msg Message) {})
+
+	// Answer pings for some time
+	r := wsutil.NewReader(clientConn, ws.StateClientSide)
+	for i := 0; i < 3; i++ {
+		h, err := r.NextFrame()
+		require.NoError(t, err)
+		require.Equal(t, ws.OpPing, h.OpCode)
+		require.NoError(t, wsutil.WriteClientMessage(clientConn, ws.OpPong, nil))
+	}
+
+	select {
+	case <-closed:
+		t.Fatal("connection closed while pong received")
+	default:
+	}
+
+	// Stop answering. Next frames are ping and close with going away
+	var closeCode ws.StatusCode
+	for {
+		h, err := r.NextFrame()
+		require.NoError(t, err)
+		if h.OpCode == ws.OpClose {
+			payload := make([]byte, h.Length)
+			_, err := io.ReadFull(clientConn, payload)
+			require.NoError(t, err)
+			closeCode, _ = ws.ParseCloseFrameData(payload)
+			break
+		}
+	}
+	assert.Equal(t, ws.StatusGoingAway, closeCode)
+
+	select {
+	case conn := <-closed:
+		assert.Equal(t, c, conn)
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected connection close notification")
+	}
+}
+
+func TestTransportWSCloseFrame(t *testing.T) {
+	tr := &TransportWS{}
+	tr.init(NewParser())
+
+	closed := make(chan Connection, 1)
+	tr.onConnClose = func(conn Connection) {
+		closed <- conn
+	}
+
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	tr.initConnection(serverConn, "127.0.0.2:5060", false, nil, func(msg Message) {})
+
+	go wsutil.WriteClientMessage(clientConn, ws.OpClose, ws.NewCloseFrameBody(ws.StatusNormalClosure, "bye"))
+
+	// Close code must be echoed
+	r := wsutil.NewReader(clientConn, ws.StateClientSide)
+	h, err := r.NextFrame()
+	require.NoError(t, err)
+	require.Equal(t, ws.OpClose, h.OpCode)
+	payload := make([]byte, h.Length)
+	_, err = io.ReadFull(clientConn, payload)
+	require.NoError(t, err)
+	code, _ := ws.ParseCloseFrameData(payload)
+	assert.Equal(t, ws.StatusNormalClosure, code)
+
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected connection close notification")
+	}
+}
+
+func TestTransportWSDialHeader(t *testing.T) {
+	tr := &TransportWS{}
+	tr.init(NewParser())
+	assert.Nil(t, tr.DialerCreate(nil).Header)
+
+	// Header set after init is used on next dial
+	tr.DialHeader = http.Header{"Authorization": {"Bearer token"}}
+	assert.Equal(t, ws.HandshakeHeaderHTTP(tr.DialHeader), tr.DialerCreate(nil).Header)
+	assert.Equal(t, ws.HandshakeHeaderHTTP(tr.DialHeader), tr.DialerCreate(&net.TCPAddr{}).Header)
+}
+
+func TestTransportWSHandlerListener(t *testing.T) {
+	tp := NewTransportLayer(net.DefaultResolver, NewParser(), nil)
+	defer tp.Close()
+
+	srv := httptest.NewServer(tp.WSHandler())
+	defer srv.Close()
+	addr := srv.Listener.Addr().String()
+	info := ListenerInfo{Network: "ws", Addr: addr, Handler: true}
+
+	client := &TransportWS{}
+	client.init(NewParser())
+	defer client.Close()
+
+	host, port, err := ParseAddr(addr)
+	require.NoError(t, err)
+	dial := func() Connection {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		conn, err := client.CreateConnection(ctx, Addr{}, Addr{IP: net.ParseIP(host), Port: port}, func(msg Message) {})
+		require.NoError(t, err)
+		return conn
+	}
+
+	// Listener is registered while handler has connections
+	c1 := dial()
+	require.Eventually(t, func() bool { return len(tp.Listeners()) == 1 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []ListenerInfo{info}, tp.Listeners())
+
+	require.NoError(t, c1.Close())
+	require.Eventually(t, func() bool { return len(tp.Listeners()) == 0 }, time.Second, 10*time.Millisecond)
+
+	// Removing handler listener only unregisters it
+	c2 := dial()
+	defer c2.Close()
+	require.Eventually(t, func() bool { return len(tp.Listeners()) == 1 }, time.Second, 10*time.Millisecond)
+	require.NoError(t, tp.CloseListener("ws", addr))
+	assert.Empty(t, tp.Listeners())
+	require.ErrorIs(t, tp.CloseListener("ws", addr), ErrListenerNotFound)
+}
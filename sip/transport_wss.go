@@ -13,23 +13,21 @@ import (
 // TLS transport implementation
 type TransportWSS struct {
 	*TransportWS
+
+	// ClientConfig allows TLS config per destination. See TransportTLS.ClientConfig
+	ClientConfig TLSClientConfigFunc
+
+	dialTLSConf *tls.Config
 }
 
 func (t *TransportWSS) init(par *Parser, dialTLSConf *tls.Config) {
+	if t.DialURI == nil {
+		t.DialURI = func(addr string) string { return "wss://" + addr }
+	}
 	t.TransportWS.init(par)
 	t.TransportWS.transport = "WSS"
 	t.dialer.TLSConfig = dialTLSConf
-
-	t.dialer.TLSClient = func(conn net.Conn, hostname string) net.Conn {
-		// This is just extracted from tls dialer code
-		config := dialTLSConf
-
-		if config.ServerName == "" {
-			config = config.Clone()
-			config.ServerName = hostname
-		}
-		return tls.Client(conn, config)
-	}
+	t.dialTLSConf = dialTLSConf
 
 	if t.log == nil {
 		t.log = DefaultLogger()
@@ -50,7 +48,7 @@ func (t *TransportWSS) CreateConnection(ctx context.Context, laddr Addr, raddr A
 		return nil, fmt.Errorf("remote address IP not resolved")
 	}
 
-	conn, err := t.pool.addSingleflight(laddr, raddr, t.connectionReuse, func() (Connection, error) {
+	conn, err := t.pool.addSingleflight(raddr, laddr, t.connectionReuse, func() (Connection, error) {
 		// We need to distict IPAddr vs address with hostname
 		// Hostname must be passed for TLS if provided due to certificates check
 		hostname := raddr.Hostname
@@ -78,20 +76,26 @@ func (t *TransportWSS) CreateConnection(ctx context.Context, laddr Addr, raddr A
 			traddr.Port = 443
 		}
 
-		netDialer := &net.Dialer{
-			LocalAddr: tladdr,
+		var dladdr net.Addr
+		if tladdr != nil {
+			dladdr = tladdr
 		}
 
 		log.Debug("Dialing new connection", "raddr", traddr.String())
-		conn, err := netDialer.DialContext(ctx, "tcp", traddr.String())
+		conn, err := t.dialContext(ctx, dladdr, traddr.String())
 		if err != nil {
 			return nil, fmt.Errorf("dial TCP error: %w", err)
 		}
 
 		log.Debug("Setuping TLS connection", "hostname", hostname)
-		tlsConn := t.dialer.TLSClient(conn, hostname)
+		config, err := tlsClientConfig(t.dialTLSConf, t.ClientConfig, raddr)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		tlsConn := tls.Client(conn, config)
 
-		u, err := url.ParseRequestURI("wss://" + addr)
+		u, err := url.ParseRequestURI(t.DialURI(addr))
 		if err != nil {
 			return nil, fmt.Errorf("parse request wss uri failed: %w", err)
 		}
@@ -112,6 +116,7 @@ func (t *TransportWSS) CreateConnection(ctx context.Context, laddr Addr, raddr A
 			Conn:       tlsConn,
 			refcount:   2 + TransportIdleConnection,
 			clientSide: true,
+			trace:      t.trace.conn(),
 		}
 		go t.readConnection(c, c.LocalAddr().String(), c.RemoteAddr().String(), handler)
 		return c, nil
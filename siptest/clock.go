@@ -0,0 +1,133 @@
+package siptest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/emiago/sipgo/sip"
+)
+
+// FakeClock is sip.Clock where time moves only by calling Advance.
+// Inject it with sip.WithTransactionLayerClock to test retransmissions and timeouts without sleeping.
+// Timer functions are called synchronously by Advance in order of their expiry.
+type FakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) sip.ClockTimer {
+	t := &fakeTimer{clock: c, f: f}
+	t.Reset(d)
+	return t
+}
+
+func (c *FakeClock) NewTimer(d time.Duration) sip.ClockTimer {
+	t := &fakeTimer{clock: c, c: make(chan time.Time, 1)}
+	t.Reset(d)
+	return t
+}
+
+// Advance moves time forward by d and fires all timers expiring until then.
+// Timers started or reset by fired functions are also fired if they expire within d.
+//
+// Unlike time.AfterFunc, AfterFunc functions are called synchronously on caller goroutine
+// and Advance returns once they are done. This keeps tests deterministic, but caller must not
+// hold locks that these functions take, and functions must not block on caller.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	end := c.now.Add(d)
+	c.mu.Unlock()
+
+	for {
+		c.mu.Lock()
+		t := c.next(end)
+		if t == nil {
+			c.now = end
+			c.mu.Unlock()
+			return
+		}
+		c.now = t.when
+		c.remove(t)
+		now := c.now
+		c.mu.Unlock()
+
+		if t.f != nil {
+			t.f()
+			continue
+		}
+		select {
+		case t.c <- now:
+		default:
+		}
+	}
+}
+
+// Timers returns number of active timers
+func (c *FakeClock) Timers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+// next returns earliest timer expiring until end. Must be called under lock
+func (c *FakeClock) next(end time.Time) *fakeTimer {
+	var next *fakeTimer
+	for _, t := range c.timers {
+		if t.when.After(end) {
+			continue
+		}
+		if next == nil || t.when.Before(next.when) {
+			next = t
+		}
+	}
+	return next
+}
+
+// remove removes timer and returns true if it was active. Must be called under lock
+func (c *FakeClock) remove(t *fakeTimer) bool {
+	for i, tt := range c.timers {
+		if tt == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type fakeTimer struct {
+	clock *FakeClock
+	when  time.Time
+	f     func()
+	c     chan time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	return t.clock.remove(t)
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	active := c.remove(t)
+	t.when = c.now.Add(d)
+	c.timers = append(c.timers, t)
+	return active
+}
@@ -0,0 +1,65 @@
+package siptest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFakeClockAfterFunc(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+
+	var fired []string
+	clock.AfterFunc(2*time.Second, func() { fired = append(fired, "b") })
+	clock.AfterFunc(time.Second, func() {
+		fired = append(fired, "a")
+		assert.Equal(t, start.Add(time.Second), clock.Now())
+		// Started by fired function and expires within same Advance
+		clock.AfterFunc(500*time.Millisecond, func() { fired = append(fired, "a2") })
+	})
+	stopped := clock.AfterFunc(time.Second, func() { fired = append(fired, "stopped") })
+	require.Equal(t, 3, clock.Timers())
+
+	assert.True(t, stopped.Stop())
+	assert.False(t, stopped.Stop())
+
+	clock.Advance(999 * time.Millisecond)
+	assert.Empty(t, fired)
+
+	// Functions are done once Advance returns
+	clock.Advance(5 * time.Second)
+	assert.Equal(t, []string{"a", "a2", "b"}, fired)
+	assert.Equal(t, start.Add(5999*time.Millisecond), clock.Now())
+	assert.Equal(t, 0, clock.Timers())
+}
+
+func TestFakeClockTimerReset(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+
+	timer := clock.NewTimer(time.Second)
+	assert.True(t, timer.Reset(3*time.Second))
+
+	clock.Advance(2 * time.Second)
+	select {
+	case <-timer.C():
+		t.Fatal("timer fired before reset duration")
+	default:
+	}
+
+	clock.Advance(time.Second)
+	select {
+	case now := <-timer.C():
+		assert.Equal(t, clock.Now(), now)
+	default:
+		t.Fatal("timer not fired")
+	}
+	assert.False(t, timer.Stop())
+
+	// Expired timer can be reused
+	assert.False(t, timer.Reset(time.Second))
+	clock.Advance(time.Second)
+	assert.Len(t, timer.C(), 1)
+}
@@ -8,15 +8,20 @@ import (
 )
 
 type UserAgent struct {
-	name        string
-	hostname    string
-	dnsResolver *net.Resolver
-	tlsConfig   *tls.Config
-	parser      *sip.Parser
-	txOptions   []sip.TransactionLayerOption
-	tpOptions   []sip.TransportLayerOption
-	tp          *sip.TransportLayer
-	tx          *sip.TransactionLayer
+	name            string
+	hostname        string
+	dnsResolver     *net.Resolver
+	tlsConfig       *tls.Config
+	tlsClientConfig sip.TLSClientConfigFunc
+	tracers         []sip.SIPEventTracer
+	metrics         sip.Metrics
+	spanTracer      sip.SpanTracer
+	spanHeader      string
+	parser          *sip.Parser
+	txOptions       []sip.TransactionLayerOption
+	tpOptions       []sip.TransportLayerOption
+	tp              *sip.TransportLayer
+	tx              *sip.TransactionLayer
 }
 
 type UserAgentOption func(s *UserAgent) error
@@ -54,6 +59,45 @@ func WithUserAgenTLSConfig(c *tls.Config) UserAgentOption {
 	}
 }
 
+// WithUserAgentTLSClientConfig allows picking TLS config per destination when dialing TLS or WSS.
+// For ex. different client certificate per carrier trunk. Returning nil uses default tls config.
+func WithUserAgentTLSClientConfig(f sip.TLSClientConfigFunc) UserAgentOption {
+	return func(s *UserAgent) error {
+		s.tlsClientConfig = f
+		return nil
+	}
+}
+
+// WithUserAgentSIPTracer adds tracer receiving every SIP message of this user agent transports.
+// Multiple user agents in same process have separate tracing. See sip.WithTransportLayerTracer
+func WithUserAgentSIPTracer(t sip.SIPEventTracer) UserAgentOption {
+	return func(s *UserAgent) error {
+		s.tracers = append(s.tracers, t)
+		return nil
+	}
+}
+
+// WithUserAgentMetrics reports metrics of transport and transaction layer and dialogs
+// created by this user agent to m. See sip.Metrics
+func WithUserAgentMetrics(m sip.Metrics) UserAgentOption {
+	return func(s *UserAgent) error {
+		s.metrics = m
+		return nil
+	}
+}
+
+// WithUserAgentSpanTracer opens span for every transaction and dialog of this user agent.
+// Trace context is propagated with header, where empty is sip.DefaultSpanHeader. See sip.SpanTracer
+//
+// Experimental
+func WithUserAgentSpanTracer(t sip.SpanTracer, header string) UserAgentOption {
+	return func(s *UserAgent) error {
+		s.spanTracer = t
+		s.spanHeader = header
+		return nil
+	}
+}
+
 // WithUserAgentParser allows removing default behavior of parser
 // You can define and remove default headers parser map and pass here.
 // Only use if your benchmarks are better than default
@@ -97,11 +141,32 @@ func NewUA(options ...UserAgentOption) (*UserAgent, error) {
 		}
 	}
 
-	ua.tp = sip.NewTransportLayer(ua.dnsResolver, ua.parser, ua.tlsConfig, ua.tpOptions...)
-	ua.tx = sip.NewTransactionLayer(ua.tp, ua.txOptions...)
+	tpOptions := append([]sip.TransportLayerOption{}, ua.tpOptions...)
+	if ua.tlsClientConfig != nil {
+		tpOptions = append(tpOptions, sip.WithTransportLayerTLSClientConfig(ua.tlsClientConfig))
+	}
+	for _, t := range ua.tracers {
+		tpOptions = append(tpOptions, sip.WithTransportLayerTracer(t))
+	}
+	txOptions := append([]sip.TransactionLayerOption{}, ua.txOptions...)
+	if ua.metrics != nil {
+		tpOptions = append(tpOptions, sip.WithTransportLayerMetrics(ua.metrics))
+		txOptions = append(txOptions, sip.WithTransactionLayerMetrics(ua.metrics))
+	}
+	if ua.spanTracer != nil {
+		txOptions = append(txOptions, sip.WithTransactionLayerSpanTracer(ua.spanTracer, ua.spanHeader))
+	}
+
+	ua.tp = sip.NewTransportLayer(ua.dnsResolver, ua.parser, ua.tlsConfig, tpOptions...)
+	ua.tx = sip.NewTransactionLayer(ua.tp, txOptions...)
 	return ua, nil
 }
 
+// SetSIPTraceFilter changes filter of tracers at runtime. Nil traces all messages
+func (ua *UserAgent) SetSIPTraceFilter(f *sip.SIPTraceFilter) {
+	ua.tp.SetSIPTraceFilter(f)
+}
+
 func (ua *UserAgent) Close() error {
 	// stop transaction layer
 	ua.tx.Close()